@@ -0,0 +1,142 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"text/template"
+)
+
+// ArgValues are the per-command values extra grootfs args can refer to, e.g.
+// --uid-mapping={{.Index}}:1000:1
+type ArgValues struct {
+	// Name of the image the command acts on, empty if none
+	ImageName string
+	// Base image of the image being created, empty for other commands
+	BaseImage string
+	// Number of commands the job built before this one
+	Index int
+}
+
+// ValidateArgs checks extra args are valid templates
+func ValidateArgs(args []string) error {
+	for _, arg := range args {
+		if _, err := expandArg(arg, ArgValues{}); err != nil {
+			return fmt.Errorf("invalid arg `%s`: %s", arg, err)
+		}
+	}
+
+	return nil
+}
+
+// ParseCommandArgs reads per-command args given as <command>:<arg>, e.g.
+// create:--insecure-registry=localhost:5000
+func ParseCommandArgs(expressions []string) (map[string][]string, error) {
+	commandArgs := map[string][]string{}
+	for _, expression := range expressions {
+		parts := strings.SplitN(expression, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid command arg `%s`, expected <command>:<arg>", expression)
+		}
+
+		if err := ValidateArgs(parts[1:]); err != nil {
+			return nil, err
+		}
+		commandArgs[parts[0]] = append(commandArgs[parts[0]], parts[1])
+	}
+
+	return commandArgs, nil
+}
+
+func expandArg(arg string, values ArgValues) (string, error) {
+	if !strings.Contains(arg, "{{") {
+		return arg, nil
+	}
+
+	tmpl, err := template.New("arg").Option("missingkey=error").Parse(arg)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := tmpl.Execute(buffer, values); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// expandArgs fills in the templates of the args. They are validated before
+// the run, so an arg that cannot be expanded is kept as is.
+func expandArgs(args []string, values ArgValues) []string {
+	expanded := []string{}
+	for _, arg := range args {
+		value, err := expandArg(arg, values)
+		if err != nil {
+			value = arg
+		}
+		expanded = append(expanded, value)
+	}
+
+	return expanded
+}
+
+// grootfsArgs builds the args of a grootfs command up to its positional
+// args: the global args, the command and its extra args
+func (j *Job) grootfsArgs(command Command, values ArgValues) []string {
+	args := append(j.globalArgs(values), string(command))
+	if command == j.Command {
+		args = append(args, expandArgs(j.ExtraArgs, values)...)
+	}
+
+	return append(args, expandArgs(j.CommandArgs[string(command)], values)...)
+}
+
+// nextIndex numbers the commands built by the job
+func (j *Job) nextIndex() int {
+	return int(atomic.AddInt64(&j.index, 1) - 1)
+}
+
+// RedactArgs hides the values of password flags, so args can be recorded
+// with the results
+func RedactArgs(args []string) []string {
+	redacted := []string{}
+	hideNext := false
+	for _, arg := range args {
+		switch {
+		case hideNext:
+			arg = "<redacted>"
+			hideNext = false
+		case arg == "--password":
+			hideNext = true
+		case strings.HasPrefix(arg, "--password="):
+			arg = "--password=<redacted>"
+		}
+		redacted = append(redacted, arg)
+	}
+
+	return redacted
+}
+
+// RedactCommandArgs hides the values of password flags given as
+// <command>:<arg>
+func RedactCommandArgs(expressions []string) []string {
+	commands := []string{}
+	args := []string{}
+	for _, expression := range expressions {
+		parts := strings.SplitN(expression, ":", 2)
+		if len(parts) != 2 {
+			parts = append(parts, "")
+		}
+		commands = append(commands, parts[0])
+		args = append(args, parts[1])
+	}
+
+	redacted := []string{}
+	for i, arg := range RedactArgs(args) {
+		redacted = append(redacted, commands[i]+":"+arg)
+	}
+
+	return redacted
+}
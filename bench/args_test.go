@@ -0,0 +1,101 @@
+package bench_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extra args", func() {
+	var (
+		job           *bench.Job
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+	)
+
+	BeforeEach(func() {
+		job = createJob()
+		job.TotalImages = 2
+		job.Concurrency = 1
+		fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+	})
+
+	It("passes the global args to every command, before the command", func() {
+		job.GlobalArgs = []string{"--config", "/etc/grootfs.yml"}
+		job.Run(context.Background())
+
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			Expect(cmd.Args[7:10]).To(Equal([]string{"--config", "/etc/grootfs.yml", "create"}))
+		}
+	})
+
+	It("passes the command args to their command, with the templates filled in", func() {
+		job.CommandArgs = map[string][]string{
+			"create": {"--uid-mapping", "{{.Index}}:1000:1", "--label={{.ImageName}}/{{.BaseImage}}"},
+			"delete": {"--never-used"},
+		}
+		job.Run(context.Background())
+
+		commands := fakeCmdRunner.ExecutedCommands()
+		Expect(commands).To(HaveLen(2))
+		for i, cmd := range commands {
+			imageName := cmd.Args[len(cmd.Args)-1]
+			Expect(cmd.Args[7:]).To(Equal([]string{
+				"create", "--uid-mapping", []string{"0:1000:1", "1:1000:1"}[i], "--label=" + imageName + "/docker:///busybox",
+				"docker:///busybox", imageName,
+			}))
+		}
+	})
+
+	It("passes the command args in lifecycle mode too", func() {
+		job.Command = "lifecycle"
+		job.CommandArgs = map[string][]string{"delete": {"--delete-arg={{.ImageName}}"}}
+		job.Run(context.Background())
+
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			if cmd.Args[7] == "delete" {
+				Expect(cmd.Args[8:]).To(Equal([]string{"--delete-arg=" + cmd.Args[9], cmd.Args[9]}))
+			}
+		}
+	})
+
+	Describe("ValidateArgs", func() {
+		It("accepts the known values", func() {
+			Expect(bench.ValidateArgs([]string{"--plain", "{{.ImageName}}", "{{.BaseImage}}-{{.Index}}"})).To(Succeed())
+		})
+
+		It("rejects invalid templates", func() {
+			Expect(bench.ValidateArgs([]string{"{{.Banana}}"})).To(MatchError(ContainSubstring("invalid arg `{{.Banana}}`")))
+			Expect(bench.ValidateArgs([]string{"{{.Index"})).To(MatchError(ContainSubstring("invalid arg `{{.Index`")))
+		})
+	})
+
+	Describe("ParseCommandArgs", func() {
+		It("groups the args by command", func() {
+			commandArgs, err := bench.ParseCommandArgs([]string{"create:--insecure-registry=localhost:5000", "create:--username=me", "stats:--json"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(commandArgs).To(Equal(map[string][]string{
+				"create": {"--insecure-registry=localhost:5000", "--username=me"},
+				"stats":  {"--json"},
+			}))
+		})
+
+		It("rejects args without a command", func() {
+			_, err := bench.ParseCommandArgs([]string{"--json"})
+			Expect(err).To(MatchError("invalid command arg `--json`, expected <command>:<arg>"))
+		})
+	})
+
+	Describe("RedactArgs", func() {
+		It("hides passwords", func() {
+			Expect(bench.RedactArgs([]string{"--username", "me", "--password", "secret", "--password=secret"})).To(Equal([]string{
+				"--username", "me", "--password", "<redacted>", "--password=<redacted>",
+			}))
+			Expect(bench.RedactCommandArgs([]string{"create:--password", "create:se:cret", "create:--username=me"})).To(Equal([]string{
+				"create:--password", "create:<redacted>", "create:--username=me",
+			}))
+		})
+	})
+})
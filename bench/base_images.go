@@ -0,0 +1,192 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Distributions of the base images among the created images
+const (
+	BaseImagesRoundRobin = "round-robin"
+	BaseImagesWeighted   = "weighted"
+	BaseImagesZipf       = "zipf"
+)
+
+var BaseImageDistributions = []string{BaseImagesRoundRobin, BaseImagesWeighted, BaseImagesZipf}
+
+// DefaultZipfExponent makes the first base image picked about twice as often
+// as the second one
+const DefaultZipfExponent = 1.1
+
+// BaseImageSummary describes how often a base image was used and how long
+// creating images from it took
+type BaseImageSummary struct {
+	BaseImage string       `json:"base_image"`
+	Weight    int          `json:"weight"`
+	Images    int          `json:"images"`
+	Share     float64      `json:"share"`
+	Latency   LatencyStats `json:"latency"`
+}
+
+// ParseBaseImages reads base images, either all plain or all weighted with
+// a `=<weight>` suffix (e.g. docker:///cflinuxfs3=80). The weights are nil
+// when none is given.
+func ParseBaseImages(expressions []string) ([]string, []int, error) {
+	images := []string{}
+	weights := []int{}
+
+	for _, expression := range expressions {
+		image := expression
+		if i := strings.LastIndex(expression, "="); i >= 0 && isDigits(expression[i+1:]) {
+			weight, err := strconv.Atoi(expression[i+1:])
+			if err != nil || weight <= 0 {
+				return nil, nil, fmt.Errorf("parsing base image `%s`: invalid weight `%s`", expression, expression[i+1:])
+			}
+			image = expression[:i]
+			weights = append(weights, weight)
+		}
+		images = append(images, image)
+	}
+
+	if len(weights) == 0 {
+		return images, nil, nil
+	}
+	if len(weights) != len(images) {
+		return nil, nil, fmt.Errorf("either all base images or none must have a weight")
+	}
+
+	return images, weights, nil
+}
+
+// ValidateBaseImageDistribution checks a distribution can pick from the base
+// images. An empty distribution is the round-robin one, or the weighted one
+// with weights.
+func ValidateBaseImageDistribution(distribution string, weights []int, zipfExponent float64) error {
+	switch distribution {
+	case "", BaseImagesRoundRobin:
+		if weights != nil && distribution != "" {
+			return fmt.Errorf("the round-robin distribution does not use weights")
+		}
+	case BaseImagesWeighted:
+		if weights == nil {
+			return fmt.Errorf("the weighted distribution needs a weight for every base image (e.g. docker:///busybox=80)")
+		}
+	case BaseImagesZipf:
+		if weights != nil {
+			return fmt.Errorf("the zipf distribution ranks the base images in the order given and does not use weights")
+		}
+		if zipfExponent <= 1 {
+			return fmt.Errorf("the zipf exponent must be greater than 1, got %g", zipfExponent)
+		}
+	default:
+		return fmt.Errorf("unknown base image distribution `%s`, must be one of: %s", distribution, strings.Join(BaseImageDistributions, ", "))
+	}
+
+	return nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// baseImageDistribution is the distribution the job picks base images with
+func (j *Job) baseImageDistribution() string {
+	if j.BaseImageDistribution != "" {
+		return j.BaseImageDistribution
+	}
+	if j.BaseImageWeights != nil {
+		return BaseImagesWeighted
+	}
+	return BaseImagesRoundRobin
+}
+
+// nextBaseImage picks the base image of the ith image
+func (j *Job) nextBaseImage(i int) string {
+	switch j.baseImageDistribution() {
+	case BaseImagesWeighted:
+		if j.baseImageRandom == nil {
+			j.baseImageRandom = rand.New(rand.NewSource(j.BaseImageSeed))
+		}
+
+		total := 0
+		for _, weight := range j.BaseImageWeights {
+			total += weight
+		}
+
+		pick := j.baseImageRandom.Intn(total)
+		for n, weight := range j.BaseImageWeights {
+			if pick < weight {
+				return j.BaseImages[n]
+			}
+			pick -= weight
+		}
+	case BaseImagesZipf:
+		if j.baseImageZipf == nil {
+			exponent := j.ZipfExponent
+			if exponent == 0 {
+				exponent = DefaultZipfExponent
+			}
+			random := rand.New(rand.NewSource(j.BaseImageSeed))
+			j.baseImageZipf = rand.NewZipf(random, exponent, 1, uint64(len(j.BaseImages)-1))
+		}
+
+		return j.BaseImages[j.baseImageZipf.Uint64()]
+	}
+
+	return j.BaseImages[i%len(j.BaseImages)]
+}
+
+// summarizeBaseImages reports the mix of base images actually used, in the
+// order they were given
+func (j *Job) summarizeBaseImages(results []Result) []BaseImageSummary {
+	if len(j.BaseImages) < 2 {
+		return nil
+	}
+
+	durations := map[string][]time.Duration{}
+	counts := map[string]int{}
+	errors := map[string]int{}
+	for _, res := range results {
+		counts[res.BaseImage]++
+		if res.Err != nil {
+			errors[res.BaseImage]++
+		} else {
+			durations[res.BaseImage] = append(durations[res.BaseImage], res.Duration)
+		}
+	}
+
+	summaries := []BaseImageSummary{}
+	seen := map[string]bool{}
+	for n, baseImage := range j.BaseImages {
+		if seen[baseImage] {
+			continue
+		}
+		seen[baseImage] = true
+
+		summary := BaseImageSummary{
+			BaseImage: baseImage,
+			Images:    counts[baseImage],
+			Latency:   NewLatencyStats(durations[baseImage], errors[baseImage]),
+		}
+		if j.BaseImageWeights != nil {
+			summary.Weight = j.BaseImageWeights[n]
+		}
+		if len(results) > 0 {
+			summary.Share = float64(summary.Images) / float64(len(results))
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
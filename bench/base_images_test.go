@@ -0,0 +1,159 @@
+package bench_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Base images", func() {
+	Describe("ParseBaseImages", func() {
+		It("reads plain base images", func() {
+			images, weights, err := bench.ParseBaseImages([]string{"docker:///busybox", "oci:///fixtures:latest"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images).To(Equal([]string{"docker:///busybox", "oci:///fixtures:latest"}))
+			Expect(weights).To(BeNil())
+		})
+
+		It("reads weighted base images", func() {
+			images, weights, err := bench.ParseBaseImages([]string{"docker:///cflinuxfs3=80", "docker:///busybox=20"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images).To(Equal([]string{"docker:///cflinuxfs3", "docker:///busybox"}))
+			Expect(weights).To(Equal([]int{80, 20}))
+		})
+
+		It("does not mistake other equal signs for weights", func() {
+			images, weights, err := bench.ParseBaseImages([]string{"oci:///images/a=b"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images).To(Equal([]string{"oci:///images/a=b"}))
+			Expect(weights).To(BeNil())
+		})
+
+		It("rejects zero weights", func() {
+			_, _, err := bench.ParseBaseImages([]string{"docker:///busybox=0"})
+			Expect(err).To(MatchError("parsing base image `docker:///busybox=0`: invalid weight `0`"))
+		})
+
+		It("rejects weighting only some base images", func() {
+			_, _, err := bench.ParseBaseImages([]string{"docker:///busybox=1", "docker:///ubuntu"})
+			Expect(err).To(MatchError("either all base images or none must have a weight"))
+		})
+	})
+
+	Describe("ValidateBaseImageDistribution", func() {
+		It("accepts the known distributions", func() {
+			Expect(bench.ValidateBaseImageDistribution("", nil, 0)).To(Succeed())
+			Expect(bench.ValidateBaseImageDistribution("", []int{1}, 0)).To(Succeed())
+			Expect(bench.ValidateBaseImageDistribution(bench.BaseImagesRoundRobin, nil, 0)).To(Succeed())
+			Expect(bench.ValidateBaseImageDistribution(bench.BaseImagesWeighted, []int{1}, 0)).To(Succeed())
+			Expect(bench.ValidateBaseImageDistribution(bench.BaseImagesZipf, nil, 1.5)).To(Succeed())
+		})
+
+		It("rejects distributions that cannot use the weights", func() {
+			Expect(bench.ValidateBaseImageDistribution(bench.BaseImagesWeighted, nil, 0)).To(MatchError(ContainSubstring("needs a weight")))
+			Expect(bench.ValidateBaseImageDistribution(bench.BaseImagesZipf, []int{1}, 1.5)).To(MatchError(ContainSubstring("does not use weights")))
+		})
+
+		It("rejects zipf exponents of 1 or less", func() {
+			Expect(bench.ValidateBaseImageDistribution(bench.BaseImagesZipf, nil, 1)).To(MatchError("the zipf exponent must be greater than 1, got 1"))
+		})
+
+		It("rejects unknown distributions", func() {
+			Expect(bench.ValidateBaseImageDistribution("normal", nil, 0)).To(MatchError("unknown base image distribution `normal`, must be one of: round-robin, weighted, zipf"))
+		})
+	})
+
+	Describe("picking base images", func() {
+		var (
+			job           *bench.Job
+			fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		)
+
+		BeforeEach(func() {
+			job = createJob()
+			job.BaseImages = []string{"docker:///a", "docker:///b", "docker:///c"}
+			job.TotalImages = 300
+			job.Concurrency = 10
+			job.Share(make(chan string, 300), make(chan bool))
+			fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+		})
+
+		counts := func() map[string]int {
+			counts := map[string]int{}
+			for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+				counts[cmd.Args[len(cmd.Args)-2]]++
+			}
+			return counts
+		}
+
+		It("takes them in turn by default", func() {
+			job.Run(context.Background())
+			Expect(counts()).To(Equal(map[string]int{"docker:///a": 100, "docker:///b": 100, "docker:///c": 100}))
+		})
+
+		It("picks them in proportion to their weights", func() {
+			job.BaseImageWeights = []int{8, 1, 1}
+			job.Run(context.Background())
+
+			Expect(counts()["docker:///a"]).To(BeNumerically("~", 240, 30))
+			Expect(counts()["docker:///b"]).To(BeNumerically("~", 30, 20))
+		})
+
+		It("picks them following a zipf distribution", func() {
+			job.BaseImageDistribution = bench.BaseImagesZipf
+			job.ZipfExponent = 2
+			job.Run(context.Background())
+
+			Expect(counts()["docker:///a"]).To(BeNumerically(">", counts()["docker:///b"]))
+			Expect(counts()["docker:///b"]).To(BeNumerically(">", counts()["docker:///c"]))
+		})
+
+		It("picks the same base images with the same seed", func() {
+			job.BaseImageWeights = []int{1, 1, 1}
+			job.BaseImageSeed = 7
+			summary := job.Run(context.Background())
+
+			other := createJob()
+			other.BaseImages = job.BaseImages
+			other.BaseImageWeights = job.BaseImageWeights
+			other.BaseImageSeed = 7
+			other.TotalImages = 300
+			other.Share(make(chan string, 300), make(chan bool))
+			otherSummary := other.Run(context.Background())
+
+			Expect(otherSummary.BaseImages).To(HaveLen(3))
+			for n := range summary.BaseImages {
+				Expect(otherSummary.BaseImages[n].Images).To(Equal(summary.BaseImages[n].Images))
+			}
+		})
+
+		It("reports the mix used", func() {
+			job.TotalImages = 4
+			job.BaseImages = []string{"docker:///a", "docker:///b"}
+			job.BaseImageWeights = []int{3, 1}
+			job.BaseImageDistribution = bench.BaseImagesRoundRobin
+			summary := job.Run(context.Background())
+
+			Expect(summary.BaseImages).To(HaveLen(2))
+			Expect(summary.BaseImages[0].BaseImage).To(Equal("docker:///a"))
+			Expect(summary.BaseImages[0].Weight).To(Equal(3))
+			Expect(summary.BaseImages[0].Images).To(Equal(2))
+			Expect(summary.BaseImages[0].Share).To(Equal(0.5))
+			Expect(summary.BaseImages[0].Latency.Count).To(Equal(2))
+
+			buffer := gbytes.NewBuffer()
+			Expect(bench.NewTextPrinter(buffer, gbytes.NewBuffer()).Print(*summary)).To(Succeed())
+			Expect(buffer).To(gbytes.Say(`Image docker:///a\.*: 2 images \(50\.0%\), avg`))
+			Expect(buffer).To(gbytes.Say(`Image docker:///b\.*: 2 images \(50\.0%\), avg`))
+		})
+
+		It("does not report the mix of a single base image", func() {
+			job.BaseImages = []string{"docker:///a"}
+			Expect(job.Run(context.Background()).BaseImages).To(BeNil())
+		})
+	})
+})
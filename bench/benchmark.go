@@ -0,0 +1,548 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner"
+	"code.cloudfoundry.org/commandrunner/linux_command_runner"
+)
+
+// Seconds between the runs of the parallel commands unless told otherwise
+const (
+	DefaultCleanInterval           = 6
+	DefaultDeleteInterval          = 3
+	DefaultParallelCommandInterval = 2
+)
+
+// Options configure a Benchmark the way the flags of grootfs-bench do. Zero
+// values leave features off; seeds are used as given, 0 included.
+type Options struct {
+	GrootFSBinPath string
+	StorePath      string
+	Driver         string
+	LogLevel       string
+	MetricsEnabled bool
+	// GrootFSArgs are given to every grootfs command, CommandArgs to the
+	// command they are keyed by. Both are templated like the flags.
+	GrootFSArgs []string
+	CommandArgs map[Command][]string
+
+	// Images are created from BaseImages, Concurrency at a time (default:
+	// the number of CPUs)
+	Images                int
+	Concurrency           int
+	BaseImages            []string
+	BaseImageWeights      []int
+	BaseImageDistribution string
+	BaseImageSeed         int64
+	ZipfExponent          float64
+
+	UseQuota              bool
+	Quotas                []QuotaSize
+	QuotaSeed             int64
+	ExcludeImageFromQuota bool
+
+	CacheMode  string
+	DropCaches bool
+
+	// Rootless runs grootfs as UID and GID, mapped to root in the images by
+	// default
+	Rootless    bool
+	UID         uint32
+	GID         uint32
+	UIDMappings []string
+	GIDMappings []string
+
+	Lifecycle     bool
+	WriteBytes    int64
+	DwellTime     time.Duration
+	VerifyRootFS  bool
+	ExpectedFiles []string
+
+	// ParallelClean runs clean and delete every CleanInterval and
+	// DeleteInterval seconds while the images are created, deleting them in
+	// DeleteStrategy order (default: DeleteFIFO)
+	ParallelClean  bool
+	CleanInterval  int
+	DeleteInterval int
+	DeleteStrategy string
+	DeleteSeed     int64
+	KeepLive       int
+
+	// ParallelCommands each run every ParallelCommandInterval seconds.
+	// Intervals default to the Default*Interval constants.
+	ParallelCommands        []ParallelCommand
+	ParallelCommandInterval int
+
+	SkipTeardown  bool
+	TeardownClean bool
+
+	InitStore      bool
+	StoreSizeBytes int64
+	DeleteStore    bool
+
+	// Registry serves the image layouts in this directory on
+	// RegistryAddress (default: DefaultRegistryAddress)
+	Registry        string
+	RegistryAddress string
+	RegistryConfig  RegistryConfig
+
+	// Cgroup runs every grootfs command in a cgroup of its own under
+	// CgroupRoot (default: DefaultCgroupRoot), which needs root: it cannot
+	// be used with Rootless
+	Cgroup       bool
+	CgroupRoot   string
+	CgroupLimits CgroupLimits
+
+	Noise []Noise
+
+	// Runner runs grootfs, a linux command runner by default
+	Runner commandrunner.CommandRunner
+
+	// OnResult is called with every image created, as soon as it is. It is
+	// never called concurrently.
+	OnResult func(Result)
+
+	// Observers are told about the commands of the run as they start and
+	// complete
+	Observers []Observer
+
+	// AbortErrorRate stops the run once more than this percent of the
+	// images failed, from AbortMinImages images (default:
+	// DefaultAbortMinImages). The summary tells why it was aborted.
+	AbortErrorRate float64
+	AbortMinImages int
+}
+
+// ParallelCommand is a grootfs command repeated while the images are created
+type ParallelCommand struct {
+	Command Command
+	Args    []string
+}
+
+func (c ParallelCommand) String() string {
+	return strings.Join(append([]string{string(c.Command)}, c.Args...), " ")
+}
+
+// Benchmark creates images with grootfs and summarizes how it went
+type Benchmark struct {
+	options Options
+}
+
+// NewBenchmark checks the options, filling in their defaults
+func NewBenchmark(options Options) (*Benchmark, error) {
+	if len(options.BaseImages) == 0 {
+		return nil, fmt.Errorf("at least one base image is needed")
+	}
+	if options.Images <= 0 {
+		return nil, fmt.Errorf("the number of images must be positive, got %d", options.Images)
+	}
+	if options.BaseImageDistribution == BaseImagesZipf && options.ZipfExponent == 0 {
+		options.ZipfExponent = DefaultZipfExponent
+	}
+	if err := ValidateBaseImageDistribution(options.BaseImageDistribution, options.BaseImageWeights, options.ZipfExponent); err != nil {
+		return nil, err
+	}
+	if options.BaseImageWeights != nil && len(options.BaseImageWeights) != len(options.BaseImages) {
+		return nil, fmt.Errorf("either all base images or none must have a weight")
+	}
+	if options.BaseImageDistribution == "" {
+		options.BaseImageDistribution = BaseImagesRoundRobin
+		if options.BaseImageWeights != nil {
+			options.BaseImageDistribution = BaseImagesWeighted
+		}
+	}
+
+	if options.DeleteStrategy == "" {
+		options.DeleteStrategy = DeleteFIFO
+	}
+	if options.CleanInterval == 0 {
+		options.CleanInterval = DefaultCleanInterval
+	}
+	if options.DeleteInterval == 0 {
+		options.DeleteInterval = DefaultDeleteInterval
+	}
+	if options.ParallelCommandInterval == 0 {
+		options.ParallelCommandInterval = DefaultParallelCommandInterval
+	}
+	if err := ValidateDeleteStrategy(options.DeleteStrategy); err != nil {
+		return nil, err
+	}
+	for _, parallelCommand := range options.ParallelCommands {
+		if parallelCommand.Command == "" {
+			return nil, fmt.Errorf("parallel command cannot be empty")
+		}
+		if err := ValidateArgs(parallelCommand.Args); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateArgs(options.GrootFSArgs); err != nil {
+		return nil, err
+	}
+	for _, args := range options.CommandArgs {
+		if err := ValidateArgs(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Rootless {
+		if len(options.UIDMappings) == 0 {
+			options.UIDMappings = DefaultMappings(options.UID)
+		}
+		if len(options.GIDMappings) == 0 {
+			options.GIDMappings = DefaultMappings(options.GID)
+		}
+	}
+	if err := ValidateMappings(append(append([]string{}, options.UIDMappings...), options.GIDMappings...)); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateCacheMode(options.CacheMode); err != nil {
+		return nil, err
+	}
+	if options.CacheMode == CacheCold && options.Lifecycle {
+		return nil, fmt.Errorf("the cold cache mode cannot be used in lifecycle mode")
+	}
+	if options.WriteBytes < 0 {
+		return nil, fmt.Errorf("the bytes written in lifecycle mode cannot be negative, got %d", options.WriteBytes)
+	}
+	if len(options.Quotas) > 0 {
+		options.UseQuota = true
+	}
+
+	if options.Registry != "" && options.RegistryAddress == "" {
+		options.RegistryAddress = DefaultRegistryAddress
+	}
+	if err := ValidateRegistryConfig(options.RegistryConfig); err != nil {
+		return nil, err
+	}
+
+	if options.CgroupLimits != (CgroupLimits{}) {
+		options.Cgroup = true
+	}
+	if options.CgroupRoot == "" {
+		options.CgroupRoot = DefaultCgroupRoot
+	}
+	if err := ValidateCgroupLimits(options.CgroupLimits); err != nil {
+		return nil, err
+	}
+	if options.Cgroup && options.Rootless {
+		// the commands move themselves into the cgroups, which a rootless
+		// user cannot do
+		return nil, fmt.Errorf("the cgroups cannot be used in rootless mode")
+	}
+
+	options.Noise = append([]Noise{}, options.Noise...)
+	for i, noise := range options.Noise {
+		if noise.Kind == NoiseDisk && noise.Path == "" {
+			options.Noise[i].Path = filepath.Dir(options.StorePath)
+		}
+		if err := ValidateNoise(options.Noise[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.AbortErrorRate < 0 || options.AbortErrorRate >= 100 {
+		return nil, fmt.Errorf("the abort error rate must be between 0 and 100")
+	}
+	if options.AbortErrorRate > 0 && options.AbortMinImages == 0 {
+		options.AbortMinImages = DefaultAbortMinImages
+	}
+
+	if options.Runner == nil {
+		options.Runner = linux_command_runner.New()
+	}
+
+	return &Benchmark{options: options}, nil
+}
+
+// Run runs the benchmark. It fails when the run cannot start; grootfs
+// failures are counted in the summary instead. When ctx is done before the
+// images are all created, the summary covers the ones that were, and the
+// error is ctx's.
+func (b *Benchmark) Run(ctx context.Context) (Summary, error) {
+	options := b.options
+	if err := ctx.Err(); err != nil {
+		return Summary{}, err
+	}
+	// the store init is part of the run, though the store info is collected
+	// once it exists
+	startedAt := time.Now().UTC()
+
+	commandArgs := map[string][]string{}
+	for command, args := range options.CommandArgs {
+		commandArgs[string(command)] = args
+	}
+
+	var registry *Registry
+	if options.Registry != "" {
+		var err error
+		registry, err = NewRegistry(options.Registry, options.RegistryConfig)
+		if err != nil {
+			return Summary{}, err
+		}
+		address, err := registry.Start(options.RegistryAddress)
+		if err != nil {
+			return Summary{}, err
+		}
+		defer registry.Stop()
+		commandArgs[string(CommandCreate)] = append(append([]string{}, commandArgs[string(CommandCreate)]...), "--insecure-registry="+address)
+	}
+
+	runner := options.Runner
+	var cgroupRunner *CgroupRunner
+	if options.Cgroup {
+		var err error
+		cgroupRunner, err = NewCgroupRunner(options.Runner, options.CgroupRoot, options.CgroupLimits)
+		if err != nil {
+			return Summary{}, err
+		}
+		defer cgroupRunner.Cleanup()
+		runner = cgroupRunner
+	}
+
+	executor := b.executor(runner, commandArgs)
+	mainJob := executor.Jobs[0]
+
+	var store *StoreSummary
+	if options.InitStore || options.DeleteStore {
+		store = &StoreSummary{SizeBytes: options.StoreSizeBytes, ErrorMessages: []string{}}
+	}
+	if options.InitStore {
+		duration, err := mainJob.InitStore(options.StoreSizeBytes)
+		if err != nil {
+			return Summary{}, err
+		}
+		store.Initialized = true
+		store.InitDuration = duration.Seconds()
+	}
+
+	runCtx := ctx
+	var abort *ErrorRateAbort
+	if options.AbortErrorRate > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		abort = &ErrorRateAbort{MaxErrorRate: options.AbortErrorRate, MinImages: options.AbortMinImages, Cancel: cancel}
+		executor.Observers = append(executor.Observers, abort)
+	}
+
+	runInfo := CollectRunInfo(options.Runner, b.runConfig())
+	runInfo.StartedAt = startedAt
+	summary := executor.Run(runCtx)
+	if abort != nil && abort.Aborted() {
+		summary.Aborted = abort.String()
+	}
+	if options.DeleteStore {
+		duration, err := mainJob.DeleteStore()
+		store.Deleted = err == nil
+		store.DeleteDuration = duration.Seconds()
+		if err != nil {
+			store.ErrorMessages = append(store.ErrorMessages, err.Error()+"\n")
+		}
+	}
+	summary.Store = store
+	if cgroupRunner != nil && summary.Cgroup != nil {
+		// the teardown ran commands in cgroups too
+		summary.Cgroup.ErrorMessages = cgroupRunner.Errors()
+	}
+	if registry != nil {
+		registrySummary := registry.Summary()
+		summary.Registry = &registrySummary
+	}
+
+	runInfo.FinishedAt = time.Now().UTC()
+	summary.RanWithParallelClean = options.ParallelClean
+	summary.RunInfo = runInfo
+	return summary, ctx.Err()
+}
+
+// executor builds the jobs of the run, the one creating the images first
+func (b *Benchmark) executor(runner commandrunner.CommandRunner, commandArgs map[string][]string) *JobExecutor {
+	options := b.options
+
+	command := CommandCreate
+	if options.Lifecycle {
+		command = CommandLifecycle
+	}
+
+	mainJob := &Job{
+		Command:               command,
+		UseQuota:              options.UseQuota,
+		Quotas:                options.Quotas,
+		QuotaSeed:             options.QuotaSeed,
+		ExcludeImageFromQuota: options.ExcludeImageFromQuota,
+		CacheMode:             options.CacheMode,
+		DropCaches:            options.DropCaches,
+		WriteBytes:            options.WriteBytes,
+		DwellTime:             options.DwellTime,
+		VerifyRootFS:          options.VerifyRootFS,
+		ExpectedFiles:         options.ExpectedFiles,
+		BaseImages:            options.BaseImages,
+		BaseImageWeights:      options.BaseImageWeights,
+		BaseImageDistribution: options.BaseImageDistribution,
+		BaseImageSeed:         options.BaseImageSeed,
+		ZipfExponent:          options.ZipfExponent,
+		Concurrency:           options.Concurrency,
+		TotalImages:           options.Images,
+		OnResult:              options.OnResult,
+	}
+	executor := &JobExecutor{
+		Jobs:          []*Job{mainJob},
+		Teardown:      !options.SkipTeardown,
+		TeardownClean: !options.SkipTeardown && options.TeardownClean,
+		Observers:     append([]Observer{}, options.Observers...),
+	}
+	if options.ParallelClean {
+		executor.Jobs = append(executor.Jobs,
+			&Job{Command: CommandClean, Interval: options.CleanInterval},
+			&Job{
+				Command:        CommandDelete,
+				Interval:       options.DeleteInterval,
+				DeleteStrategy: options.DeleteStrategy,
+				DeleteSeed:     options.DeleteSeed,
+				KeepLive:       options.KeepLive,
+			})
+	}
+	for _, parallelCommand := range options.ParallelCommands {
+		executor.Jobs = append(executor.Jobs, &Job{
+			Command:   parallelCommand.Command,
+			ExtraArgs: parallelCommand.Args,
+			Interval:  options.ParallelCommandInterval,
+		})
+	}
+
+	for _, job := range executor.Jobs {
+		job.Runner = runner
+		job.GrootFSBinPath = options.GrootFSBinPath
+		job.StorePath = options.StorePath
+		job.Driver = options.Driver
+		job.MetricsEnabled = options.MetricsEnabled
+		job.LogLevel = options.LogLevel
+		job.GlobalArgs = options.GrootFSArgs
+		job.CommandArgs = commandArgs
+		job.Rootless = options.Rootless
+		job.UID = options.UID
+		job.GID = options.GID
+		job.UIDMappings = options.UIDMappings
+		job.GIDMappings = options.GIDMappings
+	}
+
+	for i := range options.Noise {
+		executor.Noise = append(executor.Noise, &options.Noise[i])
+	}
+
+	return executor
+}
+
+// runConfig records the options in the summary, with passwords redacted
+func (b *Benchmark) runConfig() RunConfig {
+	options := b.options
+
+	quotaSizes := []string{}
+	for _, quota := range options.Quotas {
+		size := FormatSize(quota.Bytes)
+		if quota.Weight > 0 {
+			size += "=" + strconv.Itoa(quota.Weight)
+		}
+		quotaSizes = append(quotaSizes, size)
+	}
+
+	commands := []string{}
+	for command := range options.CommandArgs {
+		commands = append(commands, string(command))
+	}
+	sort.Strings(commands)
+	commandArgs := []string{}
+	for _, command := range commands {
+		for _, arg := range options.CommandArgs[Command(command)] {
+			commandArgs = append(commandArgs, command+":"+arg)
+		}
+	}
+
+	parallelCommands := []string{}
+	for _, parallelCommand := range options.ParallelCommands {
+		parallelCommands = append(parallelCommands, parallelCommand.String())
+	}
+
+	config := RunConfig{
+		GrootFSBinPath:          options.GrootFSBinPath,
+		StorePath:               options.StorePath,
+		Driver:                  options.Driver,
+		LogLevel:                options.LogLevel,
+		MetricsEnabled:          options.MetricsEnabled,
+		BaseImages:              options.BaseImages,
+		BaseImageWeights:        options.BaseImageWeights,
+		BaseImageDistribution:   options.BaseImageDistribution,
+		BaseImageSeed:           options.BaseImageSeed,
+		ZipfExponent:            options.ZipfExponent,
+		TotalImages:             options.Images,
+		Concurrency:             options.Concurrency,
+		UseQuota:                options.UseQuota,
+		QuotaSizes:              quotaSizes,
+		QuotaSeed:               options.QuotaSeed,
+		ExcludeImageFromQuota:   options.ExcludeImageFromQuota,
+		Rootless:                options.Rootless,
+		CacheMode:               options.CacheMode,
+		DropCaches:              options.DropCaches,
+		UID:                     options.UID,
+		GID:                     options.GID,
+		UIDMappings:             options.UIDMappings,
+		GIDMappings:             options.GIDMappings,
+		Lifecycle:               options.Lifecycle,
+		WriteBytes:              options.WriteBytes,
+		DwellTime:               options.DwellTime.Seconds(),
+		VerifyRootFS:            options.VerifyRootFS,
+		ExpectedFiles:           options.ExpectedFiles,
+		ParallelClean:           options.ParallelClean,
+		CleanInterval:           options.CleanInterval,
+		DeleteInterval:          options.DeleteInterval,
+		DeleteStrategy:          options.DeleteStrategy,
+		DeleteSeed:              options.DeleteSeed,
+		KeepLive:                options.KeepLive,
+		Teardown:                !options.SkipTeardown,
+		TeardownClean:           !options.SkipTeardown && options.TeardownClean,
+		InitStore:               options.InitStore,
+		StoreSizeBytes:          options.StoreSizeBytes,
+		DeleteStore:             options.DeleteStore,
+		GrootFSArgs:             RedactArgs(options.GrootFSArgs),
+		CommandArgs:             RedactCommandArgs(commandArgs),
+		ParallelCommands:        parallelCommands,
+		ParallelCommandInterval: options.ParallelCommandInterval,
+		Registry:                options.Registry,
+		RegistryLatency:         options.RegistryConfig.Latency.Seconds(),
+		RegistryBandwidthBytes:  options.RegistryConfig.BandwidthBytes,
+		RegistryErrorRate:       options.RegistryConfig.ErrorRate,
+		RegistrySeed:            options.RegistryConfig.Seed,
+		Cgroup:                  options.Cgroup,
+		CgroupRoot:              options.CgroupRoot,
+		CgroupCPUs:              options.CgroupLimits.CPUs,
+		CgroupMemoryBytes:       options.CgroupLimits.MemoryBytes,
+		CgroupIODevice:          options.CgroupLimits.IODevice,
+		CgroupIOReadBytes:       options.CgroupLimits.IOReadBytes,
+		CgroupIOWriteBytes:      options.CgroupLimits.IOWriteBytes,
+		AbortErrorRate:          options.AbortErrorRate,
+		AbortMinImages:          options.AbortMinImages,
+	}
+
+	for _, noise := range options.Noise {
+		switch noise.Kind {
+		case NoiseDisk:
+			config.NoiseDiskPath = noise.Path
+			config.NoiseDiskBytes = noise.BytesPerSecond
+			config.NoiseDiskSyncInterval = noise.SyncInterval.Seconds()
+		case NoiseCPU:
+			config.NoiseCPUs = noise.CPUs
+		case NoiseMemory:
+			config.NoiseMemoryBytes = noise.MemoryBytes
+		}
+	}
+
+	return config
+}
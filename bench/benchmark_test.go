@@ -0,0 +1,252 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Benchmark", func() {
+	var (
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		options       bench.Options
+	)
+
+	BeforeEach(func() {
+		fakeCmdRunner = fake_command_runner.New()
+		options = bench.Options{
+			GrootFSBinPath: "/path/to/grootfs",
+			StorePath:      "/store/path",
+			Driver:         "btrfs",
+			BaseImages:     []string{"docker:///busybox"},
+			Images:         3,
+			Concurrency:    1,
+			Runner:         fakeCmdRunner,
+		}
+	})
+
+	run := func() bench.Summary {
+		benchmark, err := bench.NewBenchmark(options)
+		Expect(err).NotTo(HaveOccurred())
+		summary, err := benchmark.Run(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		return summary
+	}
+
+	commandsRun := func(command string) int {
+		count := 0
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			for _, arg := range cmd.Args {
+				if arg == command {
+					count++
+					break
+				}
+			}
+		}
+		return count
+	}
+
+	It("creates the images", func() {
+		summary := run()
+
+		Expect(summary.TotalImages).To(Equal(3))
+		Expect(summary.ErrorRate).To(BeZero())
+		Expect(commandsRun("create")).To(Equal(3))
+	})
+
+	It("records the options in the run info", func() {
+		options.Quotas = []bench.QuotaSize{{Bytes: 512 << 20, Weight: 3}, {Bytes: 1 << 30, Weight: 1}}
+		options.CommandArgs = map[bench.Command][]string{bench.CommandCreate: {"--username=me", "--password=secret"}}
+		options.ParallelCommands = []bench.ParallelCommand{{Command: bench.CommandList, Args: []string{"--json"}}}
+		options.ParallelCommandInterval = 1
+
+		config := run().RunInfo.Config
+		Expect(config.TotalImages).To(Equal(3))
+		Expect(config.UseQuota).To(BeTrue())
+		Expect(config.QuotaSizes).To(Equal([]string{"512MiB=3", "1GiB=1"}))
+		Expect(config.CommandArgs).To(Equal([]string{"create:--username=me", "create:--password=<redacted>"}))
+		Expect(config.ParallelCommands).To(Equal([]string{"list --json"}))
+		Expect(config.BaseImageDistribution).To(Equal(bench.BaseImagesRoundRobin))
+		Expect(config.Teardown).To(BeTrue())
+	})
+
+	It("calls back with every image created", func() {
+		var (
+			mutex   sync.Mutex
+			results []bench.Result
+		)
+		options.Concurrency = 3
+		options.OnResult = func(result bench.Result) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			results = append(results, result)
+		}
+
+		summary := run()
+		Expect(results).To(HaveLen(3))
+		Expect(summary.Results).To(ConsistOf(results))
+	})
+
+	It("runs lifecycles", func() {
+		options.Lifecycle = true
+		summary := run()
+		Expect(summary.Lifecycle).NotTo(BeNil())
+	})
+
+	It("runs the parallel commands", func() {
+		options.ParallelCommands = []bench.ParallelCommand{{Command: bench.CommandStats, Args: []string{"some-image"}}}
+		options.ParallelCommandInterval = 1
+
+		summary := run()
+		Expect(summary.Commands).To(HaveLen(1))
+		Expect(summary.Commands[0].Command).To(Equal(bench.CommandStats))
+	})
+
+	It("initializes and deletes the store", func() {
+		options.InitStore = true
+		options.DeleteStore = true
+
+		summary := run()
+		Expect(summary.Store.Initialized).To(BeTrue())
+		Expect(summary.Store.Deleted).To(BeTrue())
+	})
+
+	It("starts the run before initializing the store", func() {
+		options.InitStore = true
+		var initializedAt time.Time
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/grootfs"}, func(cmd *exec.Cmd) error {
+			if strings.Contains(strings.Join(cmd.Args, " "), "init-store") {
+				initializedAt = time.Now()
+			}
+			return nil
+		})
+
+		summary := run()
+		Expect(initializedAt).NotTo(BeZero())
+		Expect(summary.RunInfo.StartedAt).To(BeTemporally("<=", initializedAt))
+	})
+
+	It("fails when the store cannot be initialized", func() {
+		options.InitStore = true
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/grootfs"}, func(cmd *exec.Cmd) error {
+			if strings.Contains(strings.Join(cmd.Args, " "), "init-store") {
+				return exec.ErrNotFound
+			}
+			return nil
+		})
+
+		benchmark, err := bench.NewBenchmark(options)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = benchmark.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("initializing store")))
+	})
+
+	It("does not start once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		benchmark, err := bench.NewBenchmark(options)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = benchmark.Run(ctx)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(commandsRun("create")).To(BeZero())
+	})
+
+	It("summarizes the images created before the context is done", func() {
+		options.Concurrency = 1
+		options.Runner = &SlowFakeCommandRunner{Runner: fakeCmdRunner}
+		ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+		defer cancel()
+
+		benchmark, err := bench.NewBenchmark(options)
+		Expect(err).NotTo(HaveOccurred())
+		summary, err := benchmark.Run(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(summary.TotalImages).To(BeNumerically("<", 3))
+		Expect(summary.RunInfo.ID).NotTo(BeEmpty())
+	})
+
+	It("aborts the run when too many images fail", func() {
+		options.Images = 20
+		options.AbortErrorRate = 50
+		options.AbortMinImages = 2
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			return errors.New("o noes")
+		})
+
+		summary := run()
+		Expect(summary.TotalImages).To(Equal(2))
+		Expect(summary.Aborted).To(Equal("error rate 100.00% over 50.00% after 2 images"))
+
+		buffer := gbytes.NewBuffer()
+		Expect(bench.NewTextPrinter(buffer, gbytes.NewBuffer()).Print(summary)).To(Succeed())
+		Expect(buffer).To(gbytes.Say(`Aborted\.*: error rate 100\.00% over 50\.00% after 2 images`))
+	})
+
+	Describe("NewBenchmark", func() {
+		It("maps rootless users to root by default", func() {
+			options.Rootless = true
+			options.UID = 1000
+			options.GID = 1000
+
+			config := run().RunInfo.Config
+			Expect(config.UIDMappings).To(Equal(bench.DefaultMappings(1000)))
+			Expect(config.GIDMappings).To(Equal(bench.DefaultMappings(1000)))
+		})
+
+		It("writes the disk noise next to the store by default", func() {
+			options.Noise = []bench.Noise{{Kind: bench.NoiseDisk, BytesPerSecond: 1024}}
+			Expect(run().RunInfo.Config.NoiseDiskPath).To(Equal("/store"))
+			Expect(options.Noise[0].Path).To(BeEmpty())
+		})
+
+		It("defaults the zipf exponent", func() {
+			options.BaseImages = []string{"docker:///busybox", "docker:///alpine"}
+			options.BaseImageDistribution = bench.BaseImagesZipf
+
+			config := run().RunInfo.Config
+			Expect(config.ZipfExponent).To(Equal(bench.DefaultZipfExponent))
+		})
+
+		DescribeTable("rejects invalid options",
+			func(configure func(*bench.Options), message string) {
+				configure(&options)
+				_, err := bench.NewBenchmark(options)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("no base image", func(o *bench.Options) { o.BaseImages = nil }, "at least one base image is needed"),
+			Entry("no images", func(o *bench.Options) { o.Images = 0 }, "the number of images must be positive, got 0"),
+			Entry("negative images", func(o *bench.Options) { o.Images = -1 }, "the number of images must be positive, got -1"),
+			Entry("zipf exponent", func(o *bench.Options) {
+				o.BaseImageDistribution = bench.BaseImagesZipf
+				o.ZipfExponent = 0.5
+			}, "the zipf exponent must be greater than 1, got 0.5"),
+			Entry("delete strategy", func(o *bench.Options) { o.DeleteStrategy = "random-ish" }, "random-ish"),
+			Entry("empty parallel command", func(o *bench.Options) { o.ParallelCommands = []bench.ParallelCommand{{}} }, "parallel command cannot be empty"),
+			Entry("cache mode", func(o *bench.Options) { o.CacheMode = "lukewarm" }, "lukewarm"),
+			Entry("cold lifecycles", func(o *bench.Options) {
+				o.CacheMode = bench.CacheCold
+				o.Lifecycle = true
+			}, "the cold cache mode cannot be used in lifecycle mode"),
+			Entry("negative lifecycle writes", func(o *bench.Options) { o.WriteBytes = -1 }, "the bytes written in lifecycle mode cannot be negative, got -1"),
+			Entry("base image weights", func(o *bench.Options) { o.BaseImageWeights = []int{1, 2} }, "either all base images or none must have a weight"),
+			Entry("cgroup limits", func(o *bench.Options) { o.CgroupLimits.CPUs = -1 }, "cgroup limits cannot be negative"),
+			Entry("rootless cgroups", func(o *bench.Options) {
+				o.Cgroup = true
+				o.Rootless = true
+			}, "the cgroups cannot be used in rootless mode"),
+			Entry("abort error rate", func(o *bench.Options) { o.AbortErrorRate = 100 }, "the abort error rate must be between 0 and 100"),
+			Entry("noise", func(o *bench.Options) { o.Noise = []bench.Noise{{Kind: bench.NoiseCPU}} }, "the cpu noise must burn a positive number of CPUs"),
+		)
+	})
+})
@@ -0,0 +1,149 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Cache modes, controlling whether the layers of the base images are in the
+// store when the images are created
+const (
+	CacheCold = "cold"
+	CacheWarm = "warm"
+)
+
+// CacheModes lists the modes accepted by ValidateCacheMode, besides the empty
+// mode leaving the cache as it is
+var CacheModes = []string{CacheCold, CacheWarm}
+
+const dropCachesPath = "/proc/sys/vm/drop_caches"
+
+// CacheSummary describes how the cache was prepared. Preparing the cache is
+// not counted in the duration of the run.
+type CacheSummary struct {
+	Mode          string       `json:"mode"`
+	DropCaches    bool         `json:"drop_caches"`
+	Prepare       LatencyStats `json:"prepare"`
+	ErrorMessages []string     `json:"error_messages"`
+}
+
+func ValidateCacheMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+
+	for _, known := range CacheModes {
+		if mode == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown cache mode `%s`, must be one of: %s", mode, strings.Join(CacheModes, ", "))
+}
+
+// warmCache pulls the layers of every base image into the store before the
+// run, by creating and deleting an image of each
+func (j *Job) warmCache(ctx context.Context) {
+	pulled := map[string]bool{}
+	for _, baseImage := range j.BaseImages {
+		if pulled[baseImage] || ctx.Err() != nil {
+			continue
+		}
+		pulled[baseImage] = true
+
+		j.prepareCache(func() error {
+			imageName := newImageName()
+			values := ArgValues{ImageName: imageName, BaseImage: baseImage}
+			createArgs := append(append(j.grootfsArgs(CommandCreate, values), j.mappingArgs()...), baseImage, imageName)
+			if _, err := j.execute(exec.CommandContext(ctx, j.GrootFSBinPath, createArgs...)); err != nil {
+				return fmt.Errorf("pulling `%s`: %s", baseImage, err)
+			}
+
+			deleteArgs := append(j.grootfsArgs(CommandDelete, values), imageName)
+			if _, err := j.execute(exec.Command(j.GrootFSBinPath, deleteArgs...)); err != nil {
+				return fmt.Errorf("deleting the image pulling `%s`: %s", baseImage, err)
+			}
+
+			return nil
+		})
+	}
+}
+
+// coolCache purges the unused layers from the store and, if asked to, the
+// kernel page cache
+func (j *Job) coolCache(ctx context.Context) {
+	j.prepareCache(func() error {
+		if _, err := j.execute(exec.CommandContext(ctx, j.GrootFSBinPath, j.grootfsArgs(CommandClean, ArgValues{})...)); err != nil {
+			return fmt.Errorf("cleaning the store: %s", err)
+		}
+
+		if j.DropCaches {
+			syscall.Sync()
+			if err := ioutil.WriteFile(dropCachesPath, []byte("3"), 0200); err != nil {
+				return fmt.Errorf("dropping the page cache: %s", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// deleteImages removes the images a cold round created, so the next round
+// finds no layer in use
+func (j *Job) deleteImages(cmds []*exec.Cmd) {
+	j.prepareCache(func() error {
+		failed := []string{}
+		for _, cmd := range cmds {
+			imageName := cmd.Args[len(cmd.Args)-1]
+			if !j.images.Remove(imageName) {
+				continue
+			}
+			if _, err := j.execute(exec.Command(j.GrootFSBinPath, append(j.grootfsArgs(CommandDelete, ArgValues{ImageName: imageName}), imageName)...)); err != nil {
+				failed = append(failed, imageName)
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("deleting images %s", strings.Join(failed, ", "))
+		}
+		return nil
+	})
+}
+
+// prepareCache times a cache preparation, keeping it out of the duration of
+// the run
+func (j *Job) prepareCache(prepare func() error) {
+	start := time.Now()
+	err := prepare()
+	duration := time.Since(start)
+
+	j.cacheDuration += duration
+	if err != nil {
+		j.cacheErrors = append(j.cacheErrors, err.Error()+"\n")
+		return
+	}
+	j.cacheDurations = append(j.cacheDurations, duration)
+}
+
+func (j *Job) summarizeCache() *CacheSummary {
+	if j.CacheMode == "" {
+		return nil
+	}
+
+	errors := j.cacheErrors
+	if errors == nil {
+		errors = []string{}
+	}
+
+	return &CacheSummary{
+		Mode:          j.CacheMode,
+		DropCaches:    j.DropCaches,
+		Prepare:       NewLatencyStats(j.cacheDurations, len(j.cacheErrors)),
+		ErrorMessages: errors,
+	}
+}
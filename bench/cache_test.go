@@ -0,0 +1,129 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		job           *bench.Job
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+	)
+
+	BeforeEach(func() {
+		job = createJob()
+		fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+	})
+
+	subcommands := func() []string {
+		names := []string{}
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			names = append(names, cmd.Args[7])
+		}
+		return names
+	}
+
+	Describe("ValidateCacheMode", func() {
+		It("accepts the known modes and no mode", func() {
+			Expect(bench.ValidateCacheMode("")).To(Succeed())
+			Expect(bench.ValidateCacheMode(bench.CacheCold)).To(Succeed())
+			Expect(bench.ValidateCacheMode(bench.CacheWarm)).To(Succeed())
+		})
+
+		It("rejects unknown modes", func() {
+			Expect(bench.ValidateCacheMode("tepid")).To(MatchError("unknown cache mode `tepid`, must be one of: cold, warm"))
+		})
+	})
+
+	Context("without a cache mode", func() {
+		It("only creates the images", func() {
+			job.TotalImages = 2
+			summary := job.Run(context.Background())
+
+			Expect(subcommands()).To(Equal([]string{"create", "create"}))
+			Expect(summary.Cache).To(BeNil())
+		})
+	})
+
+	Context("when the cache is warm", func() {
+		BeforeEach(func() {
+			job.CacheMode = bench.CacheWarm
+			job.BaseImages = []string{"docker:///busybox", "docker:///ubuntu", "docker:///busybox"}
+			job.TotalImages = 3
+		})
+
+		It("creates and deletes an image of every base image before the run", func() {
+			summary := job.Run(context.Background())
+
+			Expect(subcommands()).To(Equal([]string{"create", "delete", "create", "delete", "create", "create", "create"}))
+			executed := fakeCmdRunner.ExecutedCommands()
+			Expect(executed[0].Args[8]).To(Equal("docker:///busybox"))
+			Expect(executed[2].Args[8]).To(Equal("docker:///ubuntu"))
+			Expect(executed[1].Args[8]).To(Equal(executed[0].Args[9]))
+
+			Expect(summary.Cache.Mode).To(Equal(bench.CacheWarm))
+			Expect(summary.Cache.Prepare.Count).To(Equal(2))
+			Expect(summary.TotalImages).To(Equal(3))
+		})
+
+		Context("when pulling fails", func() {
+			It("reports the error", func() {
+				fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("registry is down"))
+					return errors.New("exit status 1")
+				})
+
+				summary := job.Run(context.Background())
+				Expect(summary.Cache.ErrorMessages).To(HaveLen(2))
+				Expect(summary.Cache.ErrorMessages[0]).To(ContainSubstring("pulling `docker:///busybox`: exit status 1, registry is down"))
+			})
+		})
+	})
+
+	Context("when the cache is cold", func() {
+		BeforeEach(func() {
+			job.CacheMode = bench.CacheCold
+			job.TotalImages = 5
+			job.Concurrency = 2
+		})
+
+		It("cleans the store before every round of images and deletes them after it", func() {
+			summary := job.Run(context.Background())
+
+			Expect(subcommands()).To(Equal([]string{
+				"clean", "create", "create", "delete", "delete",
+				"clean", "create", "create", "delete", "delete",
+				"clean", "create", "delete",
+			}))
+			Expect(summary.TotalImages).To(Equal(5))
+			Expect(summary.Cache.Mode).To(Equal(bench.CacheCold))
+			Expect(summary.Cache.Prepare.Count).To(Equal(6))
+			Expect(job.Images().Len()).To(BeZero())
+		})
+
+		It("does not hand the images to the parallel delete", func() {
+			job.Run(context.Background())
+			Expect(job.CreatedImages()).To(BeEmpty())
+		})
+
+		It("does not delete images that failed to be created", func() {
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				if cmd.Args[7] == "create" {
+					return errors.New("exit status 1")
+				}
+				return nil
+			})
+
+			summary := job.Run(context.Background())
+			Expect(subcommands()).NotTo(ContainElement("delete"))
+			Expect(summary.TotalErrorsAmt).To(Equal(5))
+		})
+	})
+})
@@ -0,0 +1,498 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner"
+)
+
+// DefaultCgroupRoot is where the cgroup filesystem is usually mounted
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupPeriod is the cpu period, in microseconds, the cpu quota applies to
+const cgroupPeriod = 100000
+
+var devicePattern = regexp.MustCompile(`^\d+:\d+$`)
+
+// cgroupControllers are enabled for the commands in version 2, to limit them
+// and read their stats
+var cgroupControllers = []string{"cpu", "memory", "io"}
+
+// A cgroup stays busy until its exited process is reaped, so removing it is
+// retried for a while
+const (
+	cgroupRemoveAttempts = 10
+	cgroupRemoveDelay    = 10 * time.Millisecond
+)
+
+// removeCgroup removes an empty cgroup directory
+var removeCgroup = os.Remove
+
+// CgroupLimits constrains the resources of each grootfs command. Zero values
+// mean no limit. The io limits apply to IODevice, a <major>:<minor> block
+// device.
+type CgroupLimits struct {
+	CPUs         float64 `json:"cpus"`
+	MemoryBytes  int64   `json:"memory_bytes"`
+	IODevice     string  `json:"io_device"`
+	IOReadBytes  int64   `json:"io_read_bps"`
+	IOWriteBytes int64   `json:"io_write_bps"`
+}
+
+// CgroupStats is what a grootfs command used, read from its cgroup once it
+// exited. CPU usage and throttled time are in seconds.
+type CgroupStats struct {
+	CPUUsage         float64 `json:"cpu_usage"`
+	MemoryPeakBytes  int64   `json:"memory_peak_bytes"`
+	IOReadBytes      int64   `json:"io_read_bytes"`
+	IOWriteBytes     int64   `json:"io_write_bytes"`
+	ThrottledPeriods int64   `json:"throttled_periods"`
+	ThrottledTime    float64 `json:"throttled_time"`
+}
+
+// CgroupSummary adds up the stats of the images created in cgroups. The
+// memory peak is the highest of them.
+type CgroupSummary struct {
+	Version  int          `json:"version"`
+	Limits   CgroupLimits `json:"limits"`
+	Commands int          `json:"commands"`
+	CgroupStats
+	// ErrorMessages are the cgroups that could not be removed
+	ErrorMessages []string `json:"error_messages,omitempty"`
+}
+
+func ValidateCgroupLimits(limits CgroupLimits) error {
+	if limits.CPUs < 0 || limits.MemoryBytes < 0 || limits.IOReadBytes < 0 || limits.IOWriteBytes < 0 {
+		return fmt.Errorf("cgroup limits cannot be negative")
+	}
+
+	if (limits.IOReadBytes > 0 || limits.IOWriteBytes > 0) && limits.IODevice == "" {
+		return fmt.Errorf("io limits need the <major>:<minor> device they apply to")
+	}
+
+	if limits.IODevice != "" && !devicePattern.MatchString(limits.IODevice) {
+		return fmt.Errorf("invalid device `%s`, must be <major>:<minor>", limits.IODevice)
+	}
+
+	return nil
+}
+
+// CgroupRunner runs each command in a transient cgroup of its own, created
+// under Parent with the limits given and removed once the command exited.
+// The stats of the cgroup are kept until taken with TakeStats. Only Run puts
+// commands in cgroups; the other methods are those of the wrapped runner.
+type CgroupRunner struct {
+	commandrunner.CommandRunner
+
+	// Root is where the cgroup filesystem is mounted, Version 1 or 2
+	Root    string
+	Version int
+	Parent  string
+	Limits  CgroupLimits
+
+	mutex   sync.Mutex
+	counter int
+	stats   map[*exec.Cmd]*CgroupStats
+	errors  []string
+}
+
+// NewCgroupRunner wraps runner, detecting the cgroup version of root
+func NewCgroupRunner(runner commandrunner.CommandRunner, root string, limits CgroupLimits) (*CgroupRunner, error) {
+	if err := ValidateCgroupLimits(limits); err != nil {
+		return nil, err
+	}
+
+	version := 1
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		version = 2
+	}
+
+	cgroupRunner := &CgroupRunner{
+		CommandRunner: runner,
+		Root:          root,
+		Version:       version,
+		Parent:        fmt.Sprintf("grootfs-bench-%d", os.Getpid()),
+		Limits:        limits,
+	}
+
+	return cgroupRunner, cgroupRunner.Setup()
+}
+
+// Setup creates the parent cgroup of the commands
+func (r *CgroupRunner) Setup() error {
+	for _, dir := range r.dirs(r.Parent) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating cgroup: %s", err)
+		}
+	}
+
+	if r.Version == 2 {
+		// only the controllers the limits need must be there, the others
+		// merely provide stats
+		needed := r.limitedControllers()
+		for _, controller := range cgroupControllers {
+			// the controllers are usually enabled at the root already, and
+			// only root may change them there
+			_ = enableController(r.Root, controller)
+			if err := enableController(filepath.Join(r.Root, r.Parent), controller); err != nil && needed[controller] {
+				return fmt.Errorf("enabling the %s cgroup controller: %s", controller, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// limitedControllers are the version 2 controllers the limits need
+func (r *CgroupRunner) limitedControllers() map[string]bool {
+	return map[string]bool{
+		"cpu":    r.Limits.CPUs > 0,
+		"memory": r.Limits.MemoryBytes > 0,
+		"io":     r.Limits.IOReadBytes > 0 || r.Limits.IOWriteBytes > 0,
+	}
+}
+
+// enableController enables a controller in the children of a cgroup. The
+// controllers are enabled one at a time, as the kernel rejects a whole write
+// when any of its controllers is not available.
+func enableController(dir, controller string) error {
+	file, err := os.OpenFile(filepath.Join(dir, "cgroup.subtree_control"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString("+" + controller + "\n")
+	return err
+}
+
+// Cleanup removes the parent cgroup
+func (r *CgroupRunner) Cleanup() error {
+	for _, dir := range r.dirs(r.Parent) {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("removing cgroup: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *CgroupRunner) Run(cmd *exec.Cmd) error {
+	r.mutex.Lock()
+	r.counter++
+	name := filepath.Join(r.Parent, fmt.Sprintf("command-%d", r.counter))
+	r.mutex.Unlock()
+
+	dirs := r.dirs(name)
+	defer r.remove(dirs)
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating cgroup: %s", err)
+		}
+	}
+	if err := r.limit(name); err != nil {
+		return fmt.Errorf("limiting cgroup: %s", err)
+	}
+
+	// the command moves itself into the cgroups before running grootfs, so
+	// nothing it does escapes them
+	script := ""
+	for _, dir := range dirs {
+		script += fmt.Sprintf("echo $$ > %s && ", shellQuote(filepath.Join(dir, "cgroup.procs")))
+	}
+	script += `exec "$0" "$@"`
+
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		shell = "/bin/sh"
+	}
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+
+	runErr := r.CommandRunner.Run(cmd)
+
+	stats := r.readStats(name)
+	r.mutex.Lock()
+	if r.stats == nil {
+		r.stats = map[*exec.Cmd]*CgroupStats{}
+	}
+	r.stats[cmd] = &stats
+	r.mutex.Unlock()
+
+	return runErr
+}
+
+// remove removes the cgroups of a command, recording those left behind
+func (r *CgroupRunner) remove(dirs []string) {
+	for _, dir := range dirs {
+		err := removeCgroup(dir)
+		for attempt := 1; isBusy(err) && attempt < cgroupRemoveAttempts; attempt++ {
+			time.Sleep(cgroupRemoveDelay)
+			err = removeCgroup(dir)
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			r.mutex.Lock()
+			r.errors = append(r.errors, fmt.Sprintf("could not remove cgroup %s: %s\n", dir, err))
+			r.mutex.Unlock()
+		}
+	}
+}
+
+// Errors returns why the cgroups left behind could not be removed
+func (r *CgroupRunner) Errors() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.errors...)
+}
+
+func isBusy(err error) bool {
+	pathErr, ok := err.(*os.PathError)
+	return ok && pathErr.Err == syscall.EBUSY
+}
+
+// shellQuote quotes a word for sh
+func shellQuote(word string) string {
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// TakeStats returns the stats of a command that ran, forgetting them
+func (r *CgroupRunner) TakeStats(cmd *exec.Cmd) *CgroupStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stats := r.stats[cmd]
+	delete(r.stats, cmd)
+	return stats
+}
+
+// dirs are the directories of a cgroup, one per controller in version 1
+func (r *CgroupRunner) dirs(name string) []string {
+	if r.Version == 2 {
+		return []string{filepath.Join(r.Root, name)}
+	}
+
+	return []string{
+		filepath.Join(r.Root, "cpu", name),
+		filepath.Join(r.Root, "cpuacct", name),
+		filepath.Join(r.Root, "memory", name),
+		filepath.Join(r.Root, "blkio", name),
+	}
+}
+
+func (r *CgroupRunner) limit(name string) error {
+	files := map[string]string{}
+	limits := r.Limits
+
+	if r.Version == 2 {
+		if limits.CPUs > 0 {
+			files[filepath.Join(name, "cpu.max")] = fmt.Sprintf("%d %d", int64(limits.CPUs*cgroupPeriod), cgroupPeriod)
+		}
+		if limits.MemoryBytes > 0 {
+			files[filepath.Join(name, "memory.max")] = strconv.FormatInt(limits.MemoryBytes, 10)
+		}
+		if limits.IOReadBytes > 0 || limits.IOWriteBytes > 0 {
+			ioMax := limits.IODevice
+			if limits.IOReadBytes > 0 {
+				ioMax += fmt.Sprintf(" rbps=%d", limits.IOReadBytes)
+			}
+			if limits.IOWriteBytes > 0 {
+				ioMax += fmt.Sprintf(" wbps=%d", limits.IOWriteBytes)
+			}
+			files[filepath.Join(name, "io.max")] = ioMax
+		}
+	} else {
+		if limits.CPUs > 0 {
+			files[filepath.Join("cpu", name, "cpu.cfs_period_us")] = strconv.Itoa(cgroupPeriod)
+			files[filepath.Join("cpu", name, "cpu.cfs_quota_us")] = strconv.FormatInt(int64(limits.CPUs*cgroupPeriod), 10)
+		}
+		if limits.MemoryBytes > 0 {
+			files[filepath.Join("memory", name, "memory.limit_in_bytes")] = strconv.FormatInt(limits.MemoryBytes, 10)
+		}
+		if limits.IOReadBytes > 0 {
+			files[filepath.Join("blkio", name, "blkio.throttle.read_bps_device")] = fmt.Sprintf("%s %d", limits.IODevice, limits.IOReadBytes)
+		}
+		if limits.IOWriteBytes > 0 {
+			files[filepath.Join("blkio", name, "blkio.throttle.write_bps_device")] = fmt.Sprintf("%s %d", limits.IODevice, limits.IOWriteBytes)
+		}
+	}
+
+	// the period has to be set before the quota in version 1
+	names := []string{}
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	for _, file := range names {
+		if err := ioutil.WriteFile(filepath.Join(r.Root, file), []byte(files[file]), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readStats reads the stats of a cgroup, leaving those the kernel does not
+// provide at 0
+func (r *CgroupRunner) readStats(name string) CgroupStats {
+	stats := CgroupStats{}
+
+	if r.Version == 2 {
+		cpu := readKeyValues(filepath.Join(r.Root, name, "cpu.stat"))
+		stats.CPUUsage = float64(cpu["usage_usec"]) / 1e6
+		stats.ThrottledPeriods = cpu["nr_throttled"]
+		stats.ThrottledTime = float64(cpu["throttled_usec"]) / 1e6
+		stats.MemoryPeakBytes = readInt(filepath.Join(r.Root, name, "memory.peak"))
+
+		for _, fields := range readFields(filepath.Join(r.Root, name, "io.stat")) {
+			for _, field := range fields[1:] {
+				parts := strings.SplitN(field, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				value, _ := strconv.ParseInt(parts[1], 10, 64)
+				switch parts[0] {
+				case "rbytes":
+					stats.IOReadBytes += value
+				case "wbytes":
+					stats.IOWriteBytes += value
+				}
+			}
+		}
+
+		return stats
+	}
+
+	stats.CPUUsage = float64(readInt(filepath.Join(r.Root, "cpuacct", name, "cpuacct.usage"))) / 1e9
+	cpu := readKeyValues(filepath.Join(r.Root, "cpu", name, "cpu.stat"))
+	stats.ThrottledPeriods = cpu["nr_throttled"]
+	stats.ThrottledTime = float64(cpu["throttled_time"]) / 1e9
+	stats.MemoryPeakBytes = readInt(filepath.Join(r.Root, "memory", name, "memory.max_usage_in_bytes"))
+
+	for _, fields := range readFields(filepath.Join(r.Root, "blkio", name, "blkio.throttle.io_service_bytes")) {
+		if len(fields) != 3 {
+			continue
+		}
+		value, _ := strconv.ParseInt(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			stats.IOReadBytes += value
+		case "Write":
+			stats.IOWriteBytes += value
+		}
+	}
+
+	return stats
+}
+
+func readInt(path string) int64 {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	value, _ := strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+	return value
+}
+
+func readFields(path string) [][]string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	lines := [][]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	return lines
+}
+
+func readKeyValues(path string) map[string]int64 {
+	values := map[string]int64{}
+	for _, fields := range readFields(path) {
+		if len(fields) == 2 {
+			values[fields[0]], _ = strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+
+	return values
+}
+
+// cgroupStats takes the stats of a command the job ran in a cgroup, nil when
+// it does not use cgroups
+func (j *Job) cgroupStats(cmd *exec.Cmd) *CgroupStats {
+	runner, ok := j.Runner.(*CgroupRunner)
+	if !ok {
+		return nil
+	}
+
+	return runner.TakeStats(cmd)
+}
+
+func (j *Job) summarizeCgroup(results []Result) *CgroupSummary {
+	runner, ok := j.Runner.(*CgroupRunner)
+	if !ok {
+		return nil
+	}
+
+	summary := &CgroupSummary{Version: runner.Version, Limits: runner.Limits}
+	for _, res := range results {
+		if res.Cgroup == nil {
+			continue
+		}
+
+		summary.Commands++
+		summary.CPUUsage += res.Cgroup.CPUUsage
+		summary.IOReadBytes += res.Cgroup.IOReadBytes
+		summary.IOWriteBytes += res.Cgroup.IOWriteBytes
+		summary.ThrottledPeriods += res.Cgroup.ThrottledPeriods
+		summary.ThrottledTime += res.Cgroup.ThrottledTime
+		if res.Cgroup.MemoryPeakBytes > summary.MemoryPeakBytes {
+			summary.MemoryPeakBytes = res.Cgroup.MemoryPeakBytes
+		}
+	}
+
+	return summary
+}
+
+// formatCgroupLimits describes the limits for the text printer
+func formatCgroupLimits(limits CgroupLimits) string {
+	parts := []string{}
+	if limits.CPUs > 0 {
+		parts = append(parts, fmt.Sprintf("%g cpus", limits.CPUs))
+	}
+	if limits.MemoryBytes > 0 {
+		parts = append(parts, FormatSize(limits.MemoryBytes)+" memory")
+	}
+	if limits.IOReadBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%s/s read on %s", FormatSize(limits.IOReadBytes), limits.IODevice))
+	}
+	if limits.IOWriteBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%s/s written on %s", FormatSize(limits.IOWriteBytes), limits.IODevice))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+
+	return strings.Join(parts, ", ")
+}
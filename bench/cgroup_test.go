@@ -0,0 +1,383 @@
+package bench_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"syscall"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/commandrunner/linux_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Cgroups", func() {
+	var (
+		root          string
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		limits        bench.CgroupLimits
+		// cgroup files written by the commands, keyed by name
+		statFiles map[string]string
+		// limits found in the cgroups of the commands, keyed by file name
+		limitFiles map[string]string
+		mutex      sync.Mutex
+		// the cgroups of the tests are plain directories, holding files
+		restoreRemove func()
+	)
+
+	procsPattern := regexp.MustCompile(`echo \$\$ > '([^']+)/cgroup.procs'`)
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+
+		restoreRemove = bench.SetRemoveCgroup(os.RemoveAll)
+		limits = bench.CgroupLimits{}
+		statFiles = map[string]string{}
+		limitFiles = map[string]string{}
+
+		fakeCmdRunner = fake_command_runner.New()
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if len(cmd.Args) < 3 {
+				return nil
+			}
+			for _, match := range procsPattern.FindAllStringSubmatch(cmd.Args[2], -1) {
+				files, err := ioutil.ReadDir(match[1])
+				Expect(err).NotTo(HaveOccurred())
+				for _, file := range files {
+					contents, err := ioutil.ReadFile(filepath.Join(match[1], file.Name()))
+					Expect(err).NotTo(HaveOccurred())
+					limitFiles[file.Name()] = string(contents)
+				}
+
+				for name, contents := range statFiles {
+					Expect(ioutil.WriteFile(filepath.Join(match[1], name), []byte(contents), 0644)).To(Succeed())
+				}
+			}
+			return nil
+		})
+	})
+
+	AfterEach(func() {
+		restoreRemove()
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	newRunner := func() *bench.CgroupRunner {
+		runner, err := bench.NewCgroupRunner(fakeCmdRunner, root, limits)
+		Expect(err).NotTo(HaveOccurred())
+		return runner
+	}
+
+	Describe("ValidateCgroupLimits", func() {
+		It("accepts no limits", func() {
+			Expect(bench.ValidateCgroupLimits(bench.CgroupLimits{})).To(Succeed())
+		})
+
+		It("needs a device for io limits", func() {
+			Expect(bench.ValidateCgroupLimits(bench.CgroupLimits{IOReadBytes: 1024})).To(MatchError("io limits need the <major>:<minor> device they apply to"))
+		})
+
+		It("rejects malformed devices", func() {
+			Expect(bench.ValidateCgroupLimits(bench.CgroupLimits{IOWriteBytes: 1024, IODevice: "sda"})).To(MatchError("invalid device `sda`, must be <major>:<minor>"))
+		})
+
+		It("rejects negative limits", func() {
+			Expect(bench.ValidateCgroupLimits(bench.CgroupLimits{CPUs: -1})).To(MatchError("cgroup limits cannot be negative"))
+		})
+	})
+
+	Context("with cgroup v2", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu io memory"), 0644)).To(Succeed())
+			statFiles["cpu.stat"] = "usage_usec 1500000\nuser_usec 1000000\nnr_periods 20\nnr_throttled 4\nthrottled_usec 250000\n"
+			statFiles["memory.peak"] = "2097152\n"
+			statFiles["io.stat"] = "8:0 rbytes=1024 wbytes=4096 rios=1 wios=2\n8:16 rbytes=1024 wbytes=0 rios=1 wios=0\n"
+		})
+
+		It("detects the version", func() {
+			Expect(newRunner().Version).To(Equal(2))
+		})
+
+		It("enables the controllers of the commands", func() {
+			runner := newRunner()
+			contents, err := ioutil.ReadFile(filepath.Join(root, runner.Parent, "cgroup.subtree_control"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("+cpu\n+memory\n+io\n"))
+		})
+
+		It("names the controller a limit needs that cannot be enabled", func() {
+			limits = bench.CgroupLimits{MemoryBytes: 512 << 20}
+			// a directory cannot be written to, as a missing controller
+			// cannot be enabled
+			Expect(os.MkdirAll(filepath.Join(root, fmt.Sprintf("grootfs-bench-%d", os.Getpid()), "cgroup.subtree_control"), 0755)).To(Succeed())
+
+			_, err := bench.NewCgroupRunner(fakeCmdRunner, root, limits)
+			Expect(err).To(MatchError(HavePrefix("enabling the memory cgroup controller: ")))
+		})
+
+		It("does without the controllers no limit needs", func() {
+			Expect(os.MkdirAll(filepath.Join(root, fmt.Sprintf("grootfs-bench-%d", os.Getpid()), "cgroup.subtree_control"), 0755)).To(Succeed())
+
+			_, err := bench.NewCgroupRunner(fakeCmdRunner, root, limits)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("runs the command from its own cgroup", func() {
+			cmd := exec.Command("/path/to/grootfs", "create", "docker:///busybox", "image")
+			Expect(newRunner().Run(cmd)).To(Succeed())
+
+			Expect(cmd.Args[0]).To(Equal("sh"))
+			Expect(cmd.Args[2]).To(MatchRegexp(`^echo \$\$ > '%s/grootfs-bench-\d+/command-1/cgroup.procs' && exec "\$0" "\$@"$`, root))
+			Expect(cmd.Args[3:]).To(Equal([]string{"/path/to/grootfs", "create", "docker:///busybox", "image"}))
+		})
+
+		It("limits the cgroup", func() {
+			limits = bench.CgroupLimits{CPUs: 0.5, MemoryBytes: 512 << 20, IODevice: "8:0", IOReadBytes: 1 << 20, IOWriteBytes: 2 << 20}
+			Expect(newRunner().Run(exec.Command("/path/to/grootfs"))).To(Succeed())
+
+			Expect(limitFiles).To(Equal(map[string]string{
+				"cpu.max":    "50000 100000",
+				"memory.max": "536870912",
+				"io.max":     "8:0 rbps=1048576 wbps=2097152",
+			}))
+		})
+
+		It("records the stats of the command", func() {
+			runner := newRunner()
+			cmd := exec.Command("/path/to/grootfs")
+			Expect(runner.Run(cmd)).To(Succeed())
+
+			Expect(runner.TakeStats(cmd)).To(Equal(&bench.CgroupStats{
+				CPUUsage:         1.5,
+				MemoryPeakBytes:  2 << 20,
+				IOReadBytes:      2048,
+				IOWriteBytes:     4096,
+				ThrottledPeriods: 4,
+				ThrottledTime:    0.25,
+			}))
+			Expect(runner.TakeStats(cmd)).To(BeNil())
+		})
+
+		It("removes the cgroups", func() {
+			runner := newRunner()
+			Expect(runner.Run(exec.Command("/path/to/grootfs"))).To(Succeed())
+			Expect(filepath.Join(root, runner.Parent, "command-1")).NotTo(BeADirectory())
+
+			Expect(runner.Cleanup()).To(Succeed())
+			Expect(filepath.Join(root, runner.Parent)).NotTo(BeADirectory())
+		})
+
+		It("retries removing the cgroups while they are busy", func() {
+			attempts := 0
+			bench.SetRemoveCgroup(func(dir string) error {
+				attempts++
+				if attempts < 3 {
+					return &os.PathError{Op: "remove", Path: dir, Err: syscall.EBUSY}
+				}
+				return os.RemoveAll(dir)
+			})
+
+			runner := newRunner()
+			Expect(runner.Run(exec.Command("/path/to/grootfs"))).To(Succeed())
+			Expect(filepath.Join(root, runner.Parent, "command-1")).NotTo(BeADirectory())
+			Expect(runner.Errors()).To(BeEmpty())
+		})
+
+		It("reports the cgroups left behind", func() {
+			bench.SetRemoveCgroup(func(dir string) error {
+				return &os.PathError{Op: "remove", Path: dir, Err: syscall.EBUSY}
+			})
+
+			runner := newRunner()
+			Expect(runner.Run(exec.Command("/path/to/grootfs"))).To(Succeed())
+			dir := filepath.Join(root, runner.Parent, "command-1")
+			Expect(runner.Errors()).To(Equal([]string{fmt.Sprintf("could not remove cgroup %s: remove %s: device or resource busy\n", dir, dir)}))
+		})
+
+		It("quotes the cgroup paths for the shell", func() {
+			runner := newRunner()
+			runner.CommandRunner = linux_command_runner.New()
+			runner.Parent = "it's-" + runner.Parent
+			Expect(os.MkdirAll(filepath.Join(root, runner.Parent), 0755)).To(Succeed())
+
+			cmd := exec.Command("true")
+			Expect(runner.Run(cmd)).To(Succeed())
+			Expect(cmd.Args[2]).To(ContainSubstring(`/it'\''s-grootfs-bench-`))
+		})
+
+		It("prints the cgroups left behind with the errors of the run", func() {
+			bench.SetRemoveCgroup(func(dir string) error {
+				return &os.PathError{Op: "remove", Path: dir, Err: syscall.EBUSY}
+			})
+
+			benchmark, err := bench.NewBenchmark(bench.Options{
+				GrootFSBinPath: "/path/to/grootfs",
+				StorePath:      "/store/path",
+				BaseImages:     []string{"docker:///busybox"},
+				Images:         1,
+				Concurrency:    1,
+				SkipTeardown:   true,
+				Cgroup:         true,
+				CgroupRoot:     root,
+				Runner:         fakeCmdRunner,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			summary, err := benchmark.Run(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary.Cgroup.ErrorMessages).To(HaveLen(1))
+
+			errBuffer := gbytes.NewBuffer()
+			Expect(bench.NewTextPrinter(gbytes.NewBuffer(), errBuffer).Print(summary)).To(Succeed())
+			Expect(errBuffer).To(gbytes.Say(`could not remove cgroup .*/command-1: .*device or resource busy`))
+		})
+
+		Describe("a job using it", func() {
+			var job *bench.Job
+
+			BeforeEach(func() {
+				limits = bench.CgroupLimits{CPUs: 2}
+				job = createJob()
+				job.Runner = newRunner()
+				job.TotalImages = 2
+				job.Share(make(chan string, 2), make(chan bool))
+			})
+
+			It("records the stats of every image", func() {
+				summary := job.Run(context.Background())
+
+				Expect(summary.Results).To(HaveLen(2))
+				Expect(summary.Results[0].Cgroup.CPUUsage).To(Equal(1.5))
+				Expect(summary.Cgroup).To(Equal(&bench.CgroupSummary{
+					Version:  2,
+					Limits:   limits,
+					Commands: 2,
+					CgroupStats: bench.CgroupStats{
+						CPUUsage:         3,
+						MemoryPeakBytes:  2 << 20,
+						IOReadBytes:      4096,
+						IOWriteBytes:     8192,
+						ThrottledPeriods: 8,
+						ThrottledTime:    0.5,
+					},
+				}))
+			})
+
+			It("records the stats of the lifecycle images", func() {
+				job.Command = "lifecycle"
+				summary := job.Run(context.Background())
+				Expect(summary.Cgroup.Commands).To(Equal(2))
+			})
+
+			It("forgets the stats of the commands it does not record", func() {
+				job.Command = "lifecycle"
+				job.Run(context.Background())
+				Expect(job.Runner.(*bench.CgroupRunner).PendingStats()).To(BeZero())
+			})
+
+			It("prints them", func() {
+				buffer := gbytes.NewBuffer()
+				Expect(bench.NewTextPrinter(buffer, gbytes.NewBuffer()).Print(*job.Run(context.Background()))).To(Succeed())
+				Expect(buffer).To(gbytes.Say(`Cgroup limits\.*: 2 cpus \(cgroup v2\)`))
+				Expect(buffer).To(gbytes.Say(`Cgroup CPU usage\.*: 3\.000s \(8 throttled periods, 0\.500s throttled\)`))
+				Expect(buffer).To(gbytes.Say(`Cgroup memory peak\.*: 2MiB`))
+				Expect(buffer).To(gbytes.Say(`Cgroup IO\.*: 4KiB read, 8KiB written`))
+			})
+		})
+
+		It("records the stats of the parallel commands", func() {
+			listed := make(chan bool)
+			var once sync.Once
+			fakeCmdRunner = fake_command_runner.New()
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				dir := procsPattern.FindStringSubmatch(cmd.Args[2])[1]
+				Expect(ioutil.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("usage_usec 1500000\n"), 0644)).To(Succeed())
+
+				// the images are created once the list ran, so it runs at
+				// least once before the executor stops it
+				if cmd.Args[len(cmd.Args)-1] == "list" {
+					once.Do(func() { close(listed) })
+				} else {
+					<-listed
+				}
+				return nil
+			})
+
+			runner := newRunner()
+			create := createJob()
+			create.Runner = runner
+			create.TotalImages = 2
+			list := genericJob()
+			list.Command = "list"
+			list.Runner = runner
+
+			summary := (&bench.JobExecutor{Jobs: []*bench.Job{create, list}}).Run(context.Background())
+			Expect(summary.Commands).To(HaveLen(1))
+			Expect(summary.Commands[0].Samples).NotTo(BeEmpty())
+			Expect(summary.Commands[0].Samples[0].Cgroup.CPUUsage).To(Equal(1.5))
+		})
+	})
+
+	Context("with cgroup v1", func() {
+		BeforeEach(func() {
+			statFiles["cpuacct.usage"] = "2000000000\n"
+			statFiles["cpu.stat"] = "nr_periods 10\nnr_throttled 3\nthrottled_time 500000000\n"
+			statFiles["memory.max_usage_in_bytes"] = "1048576\n"
+			statFiles["blkio.throttle.io_service_bytes"] = "8:0 Read 512\n8:0 Write 1024\n8:0 Sync 1536\nTotal 1536\n"
+		})
+
+		It("detects the version", func() {
+			Expect(newRunner().Version).To(Equal(1))
+		})
+
+		It("joins a cgroup of every controller", func() {
+			cmd := exec.Command("/path/to/grootfs")
+			Expect(newRunner().Run(cmd)).To(Succeed())
+
+			dirs := []string{}
+			for _, match := range procsPattern.FindAllStringSubmatch(cmd.Args[2], -1) {
+				dirs = append(dirs, filepath.Base(filepath.Dir(filepath.Dir(match[1]))))
+			}
+			Expect(dirs).To(Equal([]string{"cpu", "cpuacct", "memory", "blkio"}))
+		})
+
+		It("limits the cgroups", func() {
+			limits = bench.CgroupLimits{CPUs: 1.5, MemoryBytes: 1 << 30, IODevice: "8:0", IOReadBytes: 1 << 20}
+			Expect(newRunner().Run(exec.Command("/path/to/grootfs"))).To(Succeed())
+
+			Expect(limitFiles).To(Equal(map[string]string{
+				"cpu.cfs_period_us":              "100000",
+				"cpu.cfs_quota_us":               "150000",
+				"memory.limit_in_bytes":          "1073741824",
+				"blkio.throttle.read_bps_device": "8:0 1048576",
+			}))
+		})
+
+		It("records the stats of the command", func() {
+			runner := newRunner()
+			cmd := exec.Command("/path/to/grootfs")
+			Expect(runner.Run(cmd)).To(Succeed())
+
+			Expect(runner.TakeStats(cmd)).To(Equal(&bench.CgroupStats{
+				CPUUsage:         2,
+				MemoryPeakBytes:  1 << 20,
+				IOReadBytes:      512,
+				IOWriteBytes:     1024,
+				ThrottledPeriods: 3,
+				ThrottledTime:    0.5,
+			}))
+		})
+	})
+})
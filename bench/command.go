@@ -0,0 +1,81 @@
+package bench
+
+import "time"
+
+// Command is what a job runs: a grootfs command, or the lifecycle of images
+type Command string
+
+const (
+	CommandCreate      Command = "create"
+	CommandDelete      Command = "delete"
+	CommandClean       Command = "clean"
+	CommandStats       Command = "stats"
+	CommandList        Command = "list"
+	CommandInitStore   Command = "init-store"
+	CommandDeleteStore Command = "delete-store"
+
+	// CommandLifecycle creates, uses and deletes every image in turn
+	CommandLifecycle Command = "lifecycle"
+)
+
+// CreatesImages tells whether a job running the command is timed, rather than
+// repeated during the run
+func (c Command) CreatesImages() bool {
+	return c == CommandCreate || c == CommandLifecycle
+}
+
+// CommandSummary describes the runs of a command repeated during the run,
+// such as clean, delete or stats
+type CommandSummary struct {
+	Command   Command         `json:"command"`
+	ExtraArgs []string        `json:"extra_args"`
+	Interval  int             `json:"interval"`
+	Latency   LatencyStats    `json:"latency"`
+	Samples   []CommandSample `json:"samples"`
+}
+
+// CommandSample is a single run of a command, with the number of images
+// alive when it started so its latency can be related to the store size
+type CommandSample struct {
+	LiveImages int     `json:"live_images"`
+	Duration   float64 `json:"duration"`
+	Error      string  `json:"error,omitempty"`
+
+	Cgroup *CgroupStats `json:"cgroup,omitempty"`
+}
+
+func (j *Job) recordSample(liveImages int, duration time.Duration, err error, cgroup *CgroupStats) {
+	sample := CommandSample{LiveImages: liveImages, Duration: duration.Seconds(), Cgroup: cgroup}
+	if err != nil {
+		sample.Error = err.Error()
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.samples = append(j.samples, sample)
+}
+
+func (j *Job) commandSummary() CommandSummary {
+	durations := []time.Duration{}
+	errors := 0
+	for _, sample := range j.samples {
+		if sample.Error != "" {
+			errors++
+			continue
+		}
+		durations = append(durations, time.Duration(sample.Duration*float64(time.Second)))
+	}
+
+	samples := j.samples
+	if samples == nil {
+		samples = []CommandSample{}
+	}
+
+	return CommandSummary{
+		Command:   j.Command,
+		ExtraArgs: j.ExtraArgs,
+		Interval:  j.Interval,
+		Latency:   NewLatencyStats(durations, errors),
+		Samples:   samples,
+	}
+}
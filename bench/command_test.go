@@ -0,0 +1,97 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Commands", func() {
+	var (
+		job           *bench.Job
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+	)
+
+	BeforeEach(func() {
+		job = genericJob()
+		job.Interval = 0
+		fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+	})
+
+	runFor := func(job *bench.Job, duration time.Duration) {
+		go job.Run(context.Background())
+		time.Sleep(duration)
+		close(job.Done())
+	}
+
+	It("runs commands that take no image with the extra args", func() {
+		job.Command = "generate-volume-size-metadata"
+		job.ExtraArgs = []string{"--some-flag", "value"}
+		runFor(job, 100*time.Millisecond)
+
+		Eventually(fakeCmdRunner.ExecutedCommands).ShouldNot(BeEmpty())
+		Expect(fakeCmdRunner.ExecutedCommands()[0].Args).To(Equal([]string{
+			"/path/to/grootfs", "--store", "/store/path", "--log-level", "debug", "--driver", "btrfs",
+			"generate-volume-size-metadata", "--some-flag", "value",
+		}))
+	})
+
+	Describe("stats", func() {
+		BeforeEach(func() {
+			job.Command = "stats"
+			job.SetImages(bench.NewImageList())
+		})
+
+		It("gets the stats of the newest image", func() {
+			job.Images().Add("image-0")
+			job.Images().Add("image-1")
+			runFor(job, 100*time.Millisecond)
+
+			Eventually(fakeCmdRunner.ExecutedCommands).ShouldNot(BeEmpty())
+			Expect(fakeCmdRunner.ExecutedCommands()[0].Args[7:]).To(Equal([]string{"stats", "image-1"}))
+		})
+
+		It("waits until there is an image", func() {
+			runFor(job, 100*time.Millisecond)
+			Expect(fakeCmdRunner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Describe("summaries", func() {
+		It("times every run of the repeated commands, with the number of live images", func() {
+			statsRunner := fake_command_runner.New()
+			statsRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				return errors.New("exit status 1")
+			})
+			createRunner := &SlowFakeCommandRunner{Runner: fake_command_runner.New()}
+
+			executor := bench.JobExecutor{Jobs: []*bench.Job{
+				&bench.Job{Command: "create", Runner: createRunner, TotalImages: 3, Concurrency: 1, BaseImages: []string{"image"}},
+				&bench.Job{Command: "list", Runner: fake_command_runner.New(), Interval: 1},
+				&bench.Job{Command: "stats", Runner: statsRunner, Interval: 1},
+			}}
+			summary := executor.Run(context.Background())
+
+			Expect(summary.Commands).To(HaveLen(2))
+			list := summary.Commands[0]
+			Expect(list.Command).To(Equal(bench.CommandList))
+			Expect(list.Interval).To(Equal(1))
+			Expect(list.Latency.Count).To(BeNumerically(">=", 2))
+			Expect(list.Samples).To(HaveLen(list.Latency.Count))
+			Expect(list.Samples[0].LiveImages).To(Equal(0))
+			Expect(list.Samples[len(list.Samples)-1].LiveImages).To(BeNumerically(">", 0))
+
+			stats := summary.Commands[1]
+			Expect(stats.Latency.Count).To(Equal(0))
+			Expect(stats.Latency.Errors).To(BeNumerically(">", 0))
+			Expect(stats.Samples[0].LiveImages).To(BeNumerically(">", 0))
+			Expect(stats.Samples[0].Error).To(HavePrefix("exit status 1"))
+		})
+	})
+})
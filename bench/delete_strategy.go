@@ -0,0 +1,100 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Strategies the parallel delete job can pick the next image to delete with
+const (
+	DeleteFIFO     = "fifo"
+	DeleteLIFO     = "lifo"
+	DeleteRandom   = "random"
+	DeleteKeepLive = "keep-live"
+)
+
+// DeleteStrategies lists the strategies accepted by ValidateDeleteStrategy
+var DeleteStrategies = []string{DeleteFIFO, DeleteLIFO, DeleteRandom, DeleteKeepLive}
+
+func ValidateDeleteStrategy(strategy string) error {
+	for _, known := range DeleteStrategies {
+		if strategy == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown delete strategy `%s`, must be one of: %s", strategy, strings.Join(DeleteStrategies, ", "))
+}
+
+// nextImageToDelete picks the image the delete job removes next, out of the
+// images created so far and not yet deleted. It returns an empty name when
+// there is nothing to delete.
+//
+// fifo, lifo and random wait for an image to be created when none is live.
+// keep-live never waits: it only deletes, oldest first, while more than
+// KeepLive images are live.
+func (j *Job) nextImageToDelete() string {
+	strategy := j.DeleteStrategy
+	if strategy == "" {
+		strategy = DeleteFIFO
+	}
+
+	j.collectCreatedImages(strategy != DeleteKeepLive && len(j.liveImages) == 0)
+	if len(j.liveImages) == 0 {
+		return ""
+	}
+
+	index := 0
+	switch strategy {
+	case DeleteLIFO:
+		index = len(j.liveImages) - 1
+	case DeleteRandom:
+		if j.random == nil {
+			j.random = rand.New(rand.NewSource(j.DeleteSeed))
+		}
+		index = j.random.Intn(len(j.liveImages))
+	case DeleteKeepLive:
+		if len(j.liveImages) <= j.KeepLive {
+			return ""
+		}
+	}
+
+	imageName := j.liveImages[index]
+	j.liveImages = append(j.liveImages[:index], j.liveImages[index+1:]...)
+
+	return imageName
+}
+
+// collectCreatedImages moves the names sent by the create job into the live
+// images, waiting for the first one if wait is set. It stops waiting when the
+// run is done.
+func (j *Job) collectCreatedImages(wait bool) {
+	if wait && !j.createdImagesClosed {
+		select {
+		case imageName := <-j.createdImages:
+			j.addLiveImage(imageName)
+		case <-j.done:
+			return
+		}
+	}
+
+	for !j.createdImagesClosed {
+		select {
+		case imageName := <-j.createdImages:
+			j.addLiveImage(imageName)
+		default:
+			return
+		}
+	}
+}
+
+func (j *Job) addLiveImage(imageName string) {
+	if imageName == "" {
+		// the create job closed the channel
+		j.createdImagesClosed = true
+		return
+	}
+
+	j.liveImages = append(j.liveImages, imageName)
+}
@@ -0,0 +1,91 @@
+package bench_test
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Delete strategies", func() {
+	var job *bench.Job
+
+	BeforeEach(func() {
+		job = deleteJob()
+		job.Interval = 0
+		for _, imageName := range []string{"image-0", "image-1", "image-2", "image-3", "image-4"} {
+			job.CreatedImages() <- imageName
+		}
+		close(job.CreatedImages())
+	})
+
+	deletedImages := func(job *bench.Job, amount int) []string {
+		go job.Run(context.Background())
+		defer close(job.Done())
+
+		fakeCmdRunner := job.Runner.(*fake_command_runner.FakeCommandRunner)
+		Eventually(fakeCmdRunner.ExecutedCommands).Should(HaveLen(amount))
+		Consistently(fakeCmdRunner.ExecutedCommands, 200*time.Millisecond).Should(HaveLen(amount))
+
+		images := []string{}
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			Expect(cmd.Args[7]).To(Equal("delete"))
+			images = append(images, cmd.Args[8])
+		}
+		return images
+	}
+
+	It("deletes the oldest image first by default", func() {
+		Expect(deletedImages(job, 5)).To(Equal([]string{"image-0", "image-1", "image-2", "image-3", "image-4"}))
+	})
+
+	It("deletes the newest image first with lifo", func() {
+		job.DeleteStrategy = bench.DeleteLIFO
+		Expect(deletedImages(job, 5)).To(Equal([]string{"image-4", "image-3", "image-2", "image-1", "image-0"}))
+	})
+
+	It("deletes the images in the same random order for the same seed", func() {
+		job.DeleteStrategy = bench.DeleteRandom
+		job.DeleteSeed = 42
+		images := deletedImages(job, 5)
+		Expect(images).To(ConsistOf("image-0", "image-1", "image-2", "image-3", "image-4"))
+
+		otherJob := deleteJob()
+		otherJob.Interval = 0
+		otherJob.DeleteStrategy = bench.DeleteRandom
+		otherJob.DeleteSeed = 42
+		for _, imageName := range []string{"image-0", "image-1", "image-2", "image-3", "image-4"} {
+			otherJob.CreatedImages() <- imageName
+		}
+		close(otherJob.CreatedImages())
+		Expect(deletedImages(otherJob, 5)).To(Equal(images))
+	})
+
+	It("leaves the requested number of images alive with keep-live", func() {
+		job.DeleteStrategy = bench.DeleteKeepLive
+		job.KeepLive = 2
+		Expect(deletedImages(job, 3)).To(Equal([]string{"image-0", "image-1", "image-2"}))
+	})
+
+	It("deletes every image over the ones to keep alive on each tick with keep-live", func() {
+		job.Interval = 60
+		job.DeleteStrategy = bench.DeleteKeepLive
+		job.KeepLive = 1
+		Expect(deletedImages(job, 4)).To(Equal([]string{"image-0", "image-1", "image-2", "image-3"}))
+	})
+
+	Describe("ValidateDeleteStrategy", func() {
+		It("accepts the known strategies", func() {
+			for _, strategy := range bench.DeleteStrategies {
+				Expect(bench.ValidateDeleteStrategy(strategy)).To(Succeed())
+			}
+		})
+
+		It("rejects unknown strategies", func() {
+			Expect(bench.ValidateDeleteStrategy("banana")).To(MatchError("unknown delete strategy `banana`, must be one of: fifo, lifo, random, keep-live"))
+		})
+	})
+})
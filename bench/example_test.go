@@ -0,0 +1,94 @@
+package bench_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+)
+
+func ExampleBenchmark_Run() {
+	benchmark, err := bench.NewBenchmark(bench.Options{
+		GrootFSBinPath: "/path/to/grootfs",
+		StorePath:      "/var/lib/grootfs",
+		BaseImages:     []string{"docker:///busybox"},
+		Images:         10,
+		Concurrency:    2,
+		// a real run leaves the runner out, to run grootfs
+		Runner: fake_command_runner.New(),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	summary, err := benchmark.Run(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d images, %.0f%% errors\n", summary.TotalImages, summary.ErrorRate)
+	// Output: 10 images, 0% errors
+}
+
+func ExampleOptions_onResult() {
+	failures := 0
+	benchmark, err := bench.NewBenchmark(bench.Options{
+		GrootFSBinPath: "/path/to/grootfs",
+		StorePath:      "/var/lib/grootfs",
+		BaseImages:     []string{"docker:///busybox"},
+		Images:         3,
+		Lifecycle:      true,
+		Quotas:         []bench.QuotaSize{{Bytes: 512 << 20}},
+		ParallelCommands: []bench.ParallelCommand{
+			{Command: bench.CommandStats, Args: []string{"{{.ImageName}}"}},
+		},
+		OnResult: func(result bench.Result) {
+			if result.Err != nil {
+				failures++
+			}
+		},
+		Runner: fake_command_runner.New(),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	summary, err := benchmark.Run(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d failures out of %d lifecycles\n", failures, summary.TotalImages)
+	// Output: 0 failures out of 3 lifecycles
+}
+
+func ExampleNewPrinter() {
+	benchmark, err := bench.NewBenchmark(bench.Options{
+		GrootFSBinPath: "/path/to/grootfs",
+		BaseImages:     []string{"docker:///busybox"},
+		Images:         1,
+		Runner:         fake_command_runner.New(),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	summary, err := benchmark.Run(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	printer, err := bench.NewPrinter("json", nil, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := printer.Print(summary); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -1,11 +1,14 @@
 package bench_test
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"time"
 
 	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/commandrunner/linux_command_runner"
 	"code.cloudfoundry.org/grootfs-bench/bench"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -54,7 +57,7 @@ var _ = Describe("JobExecutor", func() {
 		Describe("when there are no jobs", func() {
 			It("does not fail", func() {
 				executor.Jobs = []*bench.Job{}
-				Expect(executor.Run()).To(Equal(bench.Summary{}))
+				Expect(executor.Run(context.Background())).To(Equal(bench.Summary{}))
 			})
 		})
 
@@ -79,7 +82,7 @@ var _ = Describe("JobExecutor", func() {
 			})
 
 			It("executes them", func() {
-				summary := executor.Run()
+				summary := executor.Run(context.Background())
 				Expect(summary).ToNot(BeNil())
 				Expect(fakeCmdRunner1.ExecutedCommands()).NotTo(HaveLen(0), "create job ran no commands")
 				Expect(fakeCmdRunner2.ExecutedCommands()).NotTo(HaveLen(0), "clean job ran no commands")
@@ -87,11 +90,73 @@ var _ = Describe("JobExecutor", func() {
 			})
 
 			It("reports how many times delete and clean commands ran successfully", func() {
-				summary := executor.Run()
+				summary := executor.Run(context.Background())
 				Expect(summary).ToNot(BeNil())
 				Expect(summary.NumberOfCleans).To(Equal(len(fakeCmdRunner2.ExecutedCommands())))
 				Expect(summary.NumberOfDeletes).To(Equal(len(fakeCmdRunner3.ExecutedCommands())))
 			})
 		})
+
+		Describe("when the context is done", func() {
+			var grootfs string
+
+			BeforeEach(func() {
+				file, err := ioutil.TempFile("", "grootfs")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = file.WriteString("#!/bin/sh\nexec sleep 10\n")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(file.Close()).To(Succeed())
+				Expect(os.Chmod(file.Name(), 0755)).To(Succeed())
+				grootfs = file.Name()
+			})
+
+			AfterEach(func() {
+				Expect(os.Remove(grootfs)).To(Succeed())
+			})
+
+			It("kills the commands in flight and starts no other", func() {
+				executor.Jobs = []*bench.Job{
+					{Command: "create", Runner: linux_command_runner.New(), GrootFSBinPath: grootfs, TotalImages: 5, Concurrency: 2, BaseImages: []string{"image"}},
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				summary := executor.Run(ctx)
+				Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+				Expect(summary.TotalImages).To(Equal(2))
+				Expect(summary.TotalErrorsAmt).To(Equal(2))
+				Expect(summary.ErrorMessages[0]).To(ContainSubstring("signal: killed"))
+			})
+
+			It("stops the loops without waiting for their interval", func() {
+				cleanRunner := fake_command_runner.New()
+				executor.Jobs = []*bench.Job{
+					{Command: "clean", Runner: cleanRunner, Interval: 60},
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				summary := executor.Run(ctx)
+				Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+				Expect(cleanRunner.ExecutedCommands()).To(HaveLen(1))
+				Expect(summary.NumberOfCleans).To(Equal(1))
+			})
+
+			It("summarizes a run that created no image", func() {
+				createRunner := fake_command_runner.New()
+				executor.Jobs = []*bench.Job{
+					{Command: "create", Runner: createRunner, TotalImages: 5, BaseImages: []string{"image"}},
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				summary := executor.Run(ctx)
+				Expect(createRunner.ExecutedCommands()).To(BeEmpty())
+				Expect(summary.TotalImages).To(BeZero())
+				Expect(summary.ErrorRate).To(BeZero())
+			})
+		})
 	})
 })
@@ -0,0 +1,41 @@
+package bench
+
+// Helpers letting the tests run a job on its own, standing in for the
+// executor and the other jobs it shares channels with
+
+// Share gives the job the channels an executor would
+func (j *Job) Share(createdImages chan string, done chan bool) {
+	j.createdImages = createdImages
+	j.done = done
+}
+
+func (j *Job) CreatedImages() chan string {
+	return j.createdImages
+}
+
+func (j *Job) Done() chan bool {
+	return j.done
+}
+
+func (j *Job) Images() *ImageList {
+	return j.images
+}
+
+func (j *Job) SetImages(images *ImageList) {
+	j.images = images
+}
+
+// SetRemoveCgroup replaces how the cgroups are removed, returning a function
+// restoring it
+func SetRemoveCgroup(remove func(string) error) func() {
+	original := removeCgroup
+	removeCgroup = remove
+	return func() { removeCgroup = original }
+}
+
+// PendingStats is how many commands ran whose stats were not taken
+func (r *CgroupRunner) PendingStats() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.stats)
+}
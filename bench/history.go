@@ -0,0 +1,195 @@
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryRecord is a single benchmark run as stored in the history file. The
+// configuration and environment are part of the summary's RunInfo.
+type HistoryRecord struct {
+	Commit  string  `json:"commit"`
+	Summary Summary `json:"summary"`
+}
+
+func NewHistoryRecord(commit string, summary Summary) HistoryRecord {
+	return HistoryRecord{
+		Commit:  commit,
+		Summary: summary,
+	}
+}
+
+// HistoryFilter selects records by their configuration. Empty fields match
+// everything.
+type HistoryFilter struct {
+	Driver    string
+	Image     string
+	Commit    string
+	CacheMode string
+}
+
+func (f HistoryFilter) Matches(record HistoryRecord) bool {
+	config := record.Summary.RunInfo.Config
+
+	if f.Driver != "" && config.Driver != f.Driver {
+		return false
+	}
+
+	if f.Commit != "" && !strings.HasPrefix(record.Commit, f.Commit) {
+		return false
+	}
+
+	if f.CacheMode != "" && config.CacheMode != f.CacheMode {
+		return false
+	}
+
+	if f.Image != "" {
+		for _, image := range config.BaseImages {
+			if image == f.Image {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// History is an append-only file of json encoded records, one per line
+type History struct {
+	path string
+}
+
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+func (h *History) Append(record HistoryRecord) error {
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening history file: %s", err)
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(record)
+}
+
+func (h *History) Records(filter HistoryFilter) ([]HistoryRecord, error) {
+	file, err := os.Open(h.path)
+	if err != nil {
+		return nil, fmt.Errorf("opening history file: %s", err)
+	}
+	defer file.Close()
+
+	records := []HistoryRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var record HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("parsing history file line %d: %s", line, err)
+		}
+
+		if filter.Matches(record) {
+			records = append(records, record)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// MetricValue returns the numeric summary field with the given json name
+func MetricValue(summary Summary, metric string) (float64, error) {
+	encoded, err := json.Marshal(summary)
+	if err != nil {
+		return 0, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return 0, err
+	}
+
+	value, ok := fields[metric].(float64)
+	if !ok {
+		return 0, fmt.Errorf("unknown metric `%s`", metric)
+	}
+
+	return value, nil
+}
+
+func PrintHistory(out io.Writer, records []HistoryRecord) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tCOMMIT\tDRIVER\tIMAGES\tCONCURRENCY\tIMAGES/S\tAVG TIME\tERROR RATE")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%.3f\t%.3fs\t%.3f\n",
+			record.Summary.RunInfo.ID,
+			record.Summary.RunInfo.StartedAt.Format(time.RFC3339),
+			record.Commit,
+			record.Summary.RunInfo.Config.Driver,
+			record.Summary.TotalImages,
+			record.Summary.ConcurrencyFactor,
+			record.Summary.ImagesPerSecond,
+			record.Summary.AverageTimePerImage,
+			record.Summary.ErrorRate,
+		)
+	}
+
+	return w.Flush()
+}
+
+// PrintTrend prints the evolution of a summary metric across the given
+// records, in the order they were recorded
+func PrintTrend(out io.Writer, records []HistoryRecord, metric string) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tDATE\tCOMMIT\t%s\tCHANGE\n", strings.ToUpper(metric))
+
+	var previous, min, max, total float64
+	for i, record := range records {
+		value, err := MetricValue(record.Summary, metric)
+		if err != nil {
+			return err
+		}
+
+		change := "-"
+		if i > 0 && previous != 0 {
+			change = fmt.Sprintf("%+.2f%%", (value-previous)*100/previous)
+		}
+
+		if i == 0 || value < min {
+			min = value
+		}
+		if i == 0 || value > max {
+			max = value
+		}
+		total += value
+		previous = value
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.3f\t%s\n",
+			record.Summary.RunInfo.ID,
+			record.Summary.RunInfo.StartedAt.Format(time.RFC3339),
+			record.Commit,
+			value,
+			change,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(records) > 0 {
+		fmt.Fprintf(out, "\nruns: %d, min: %.3f, max: %.3f, mean: %.3f\n", len(records), min, max, total/float64(len(records)))
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package bench_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("History", func() {
+	var (
+		tmpDir  string
+		history *bench.History
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "history")
+		Expect(err).NotTo(HaveOccurred())
+
+		history = bench.NewHistory(filepath.Join(tmpDir, "history.jsonl"))
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	record := func(commit, driver string, imagesPerSecond float64, images ...string) bench.HistoryRecord {
+		runInfo := bench.CollectRunInfo(fake_command_runner.New(), bench.RunConfig{Driver: driver, BaseImages: images})
+		return bench.NewHistoryRecord(commit, bench.Summary{ImagesPerSecond: imagesPerSecond, TotalImages: 10, RunInfo: runInfo})
+	}
+
+	Describe("Append", func() {
+		It("keeps every record in the order they were appended", func() {
+			Expect(history.Append(record("abc", "btrfs", 1.5, "docker:///busybox"))).To(Succeed())
+			Expect(history.Append(record("def", "overlay-xfs", 2.5, "docker:///busybox"))).To(Succeed())
+
+			records, err := history.Records(bench.HistoryFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Commit).To(Equal("abc"))
+			Expect(records[0].Summary.RunInfo.Config.Driver).To(Equal("btrfs"))
+			Expect(records[0].Summary.ImagesPerSecond).To(Equal(1.5))
+			Expect(records[1].Commit).To(Equal("def"))
+		})
+
+		It("keeps the run information", func() {
+			Expect(history.Append(record("abc", "btrfs", 1.5))).To(Succeed())
+			Expect(history.Append(record("abc", "btrfs", 1.5))).To(Succeed())
+
+			records, err := history.Records(bench.HistoryFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records[0].Summary.RunInfo.ID).NotTo(BeEmpty())
+			Expect(records[0].Summary.RunInfo.ID).NotTo(Equal(records[1].Summary.RunInfo.ID))
+			Expect(records[0].Summary.RunInfo.StartedAt).To(BeTemporally("~", time.Now(), time.Minute))
+			Expect(records[0].Summary.RunInfo.Environment.NumCPU).To(BeNumerically(">", 0))
+		})
+	})
+
+	Describe("Records", func() {
+		BeforeEach(func() {
+			Expect(history.Append(record("abc123", "btrfs", 1, "docker:///busybox"))).To(Succeed())
+			Expect(history.Append(record("def456", "overlay-xfs", 2, "docker:///ubuntu"))).To(Succeed())
+			Expect(history.Append(record("abc789", "overlay-xfs", 3, "docker:///busybox", "docker:///ubuntu"))).To(Succeed())
+		})
+
+		It("filters by driver", func() {
+			records, err := history.Records(bench.HistoryFilter{Driver: "overlay-xfs"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Commit).To(Equal("def456"))
+			Expect(records[1].Commit).To(Equal("abc789"))
+		})
+
+		It("filters by base image", func() {
+			records, err := history.Records(bench.HistoryFilter{Image: "docker:///busybox"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Commit).To(Equal("abc123"))
+			Expect(records[1].Commit).To(Equal("abc789"))
+		})
+
+		It("filters by commit prefix", func() {
+			records, err := history.Records(bench.HistoryFilter{Commit: "abc"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+		})
+
+		It("filters by cache mode", func() {
+			runInfo := bench.CollectRunInfo(fake_command_runner.New(), bench.RunConfig{Driver: "btrfs", CacheMode: bench.CacheCold})
+			Expect(history.Append(bench.NewHistoryRecord("cold1", bench.Summary{RunInfo: runInfo}))).To(Succeed())
+
+			records, err := history.Records(bench.HistoryFilter{CacheMode: bench.CacheCold})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].Commit).To(Equal("cold1"))
+		})
+
+		Context("when the history file does not exist", func() {
+			It("returns an error", func() {
+				_, err := bench.NewHistory(filepath.Join(tmpDir, "nope")).Records(bench.HistoryFilter{})
+				Expect(err).To(MatchError(ContainSubstring("opening history file")))
+			})
+		})
+	})
+
+	Describe("PrintTrend", func() {
+		It("prints the metric value and its change for every run", func() {
+			records := []bench.HistoryRecord{
+				record("abc", "btrfs", 2),
+				record("def", "btrfs", 3),
+			}
+
+			buffer := gbytes.NewBuffer()
+			Expect(bench.PrintTrend(buffer, records, "images_per_second")).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`IMAGES_PER_SECOND`))
+			Expect(buffer).To(gbytes.Say(`abc\s+2\.000\s+-`))
+			Expect(buffer).To(gbytes.Say(`def\s+3\.000\s+\+50\.00%`))
+			Expect(buffer).To(gbytes.Say(`runs: 2, min: 2.000, max: 3.000, mean: 2.500`))
+		})
+
+		Context("when the metric does not exist", func() {
+			It("returns an error", func() {
+				err := bench.PrintTrend(gbytes.NewBuffer(), []bench.HistoryRecord{record("abc", "btrfs", 2)}, "banana")
+				Expect(err).To(MatchError("unknown metric `banana`"))
+			})
+		})
+	})
+})
@@ -0,0 +1,347 @@
+package bench
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth   = 600.0
+	chartHeight  = 200.0
+	chartBuckets = 20
+)
+
+func NewHTMLPrinter(out, err io.Writer) *HTMLPrinter {
+	return &HTMLPrinter{out: out, err: err}
+}
+
+// HTMLPrinter renders the summary as a self-contained html page, charts
+// included, so it can be kept as a build artifact
+type HTMLPrinter struct {
+	out io.Writer
+	err io.Writer
+}
+
+type htmlReport struct {
+	Summary     Summary
+	GeneratedAt string
+	Latency     htmlChart
+	Throughput  htmlChart
+	Errors      []htmlErrorCount
+
+	LifecycleSteps []htmlStep
+}
+
+type htmlStep struct {
+	Name  string
+	Stats LatencyStats
+}
+
+type htmlChart struct {
+	Width  float64
+	Height float64
+	Bars   []htmlBar
+	XLabel string
+	YLabel string
+	XMin   string
+	XMax   string
+	YMax   int
+}
+
+type htmlBar struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Label  string
+	Count  int
+}
+
+type htmlErrorCount struct {
+	Message string
+	Count   int
+}
+
+func (p *HTMLPrinter) Print(summary Summary) error {
+	printErrors(summary, p.err)
+
+	tmpl, err := template.New("groot").Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+
+	report := htmlReport{
+		Summary:     summary,
+		GeneratedAt: time.Now().Format(time.RFC1123),
+		Latency:     latencyHistogram(summary.Results),
+		Throughput:  throughputChart(summary.Results),
+		Errors:      errorBreakdown(summary.Results),
+	}
+
+	if lifecycle := summary.Lifecycle; lifecycle != nil {
+		report.LifecycleSteps = []htmlStep{
+			{Name: StepCreate, Stats: lifecycle.Create},
+			{Name: StepWrite, Stats: lifecycle.Write},
+			{Name: StepDwell, Stats: lifecycle.Dwell},
+			{Name: StepDelete, Stats: lifecycle.Delete},
+			{Name: StepTotal, Stats: lifecycle.Total},
+		}
+	}
+
+	return tmpl.Execute(p.out, report)
+}
+
+// latencyHistogram buckets the duration of every successful image creation
+func latencyHistogram(results []Result) htmlChart {
+	durations := []float64{}
+	for _, res := range results {
+		if res.Err == nil {
+			durations = append(durations, res.Duration.Seconds())
+		}
+	}
+
+	chart := htmlChart{Width: chartWidth, Height: chartHeight, XLabel: "seconds per image", YLabel: "images"}
+	if len(durations) == 0 {
+		return chart
+	}
+	sort.Float64s(durations)
+
+	min, max := durations[0], durations[len(durations)-1]
+	bucketSize := (max - min) / chartBuckets
+	if bucketSize == 0 {
+		bucketSize = 1
+	}
+
+	counts := make([]int, chartBuckets)
+	for _, duration := range durations {
+		bucket := int((duration - min) / bucketSize)
+		if bucket >= chartBuckets {
+			bucket = chartBuckets - 1
+		}
+		counts[bucket]++
+	}
+
+	chart.XMin = fmt.Sprintf("%.3fs", min)
+	chart.XMax = fmt.Sprintf("%.3fs", max)
+	chart.Bars, chart.YMax = bars(counts, func(i int) string {
+		return fmt.Sprintf("%.3fs - %.3fs", min+float64(i)*bucketSize, min+float64(i+1)*bucketSize)
+	})
+
+	return chart
+}
+
+// throughputChart counts how many images finished successfully in each
+// interval of the run
+func throughputChart(results []Result) htmlChart {
+	chart := htmlChart{Width: chartWidth, Height: chartHeight, XLabel: "time since start", YLabel: "images created"}
+	if len(results) == 0 {
+		return chart
+	}
+
+	start := results[0].StartedAt
+	end := results[0].StartedAt.Add(results[0].Duration)
+	for _, res := range results {
+		if res.StartedAt.Before(start) {
+			start = res.StartedAt
+		}
+		if finished := res.StartedAt.Add(res.Duration); finished.After(end) {
+			end = finished
+		}
+	}
+
+	bucketSize := end.Sub(start) / chartBuckets
+	if bucketSize < time.Millisecond {
+		bucketSize = time.Millisecond
+	}
+
+	counts := make([]int, chartBuckets)
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+
+		bucket := int(res.StartedAt.Add(res.Duration).Sub(start) / bucketSize)
+		if bucket >= chartBuckets {
+			bucket = chartBuckets - 1
+		}
+		counts[bucket]++
+	}
+
+	chart.XMin = "0s"
+	chart.XMax = end.Sub(start).String()
+	chart.Bars, chart.YMax = bars(counts, func(i int) string {
+		return fmt.Sprintf("%s - %s", time.Duration(i)*bucketSize, time.Duration(i+1)*bucketSize)
+	})
+
+	return chart
+}
+
+func bars(counts []int, label func(int) string) ([]htmlBar, int) {
+	highest := 0
+	for _, count := range counts {
+		if count > highest {
+			highest = count
+		}
+	}
+	if highest == 0 {
+		return nil, 0
+	}
+
+	width := chartWidth / float64(len(counts))
+	bars := []htmlBar{}
+	for i, count := range counts {
+		height := math.Floor(float64(count) * chartHeight / float64(highest))
+		bars = append(bars, htmlBar{
+			X:      float64(i) * width,
+			Y:      chartHeight - height,
+			Width:  width - 1,
+			Height: height,
+			Label:  label(i),
+			Count:  count,
+		})
+	}
+
+	return bars, highest
+}
+
+var (
+	errorPathPattern      = regexp.MustCompile("(^|[\\s'\"`=(])/[^\\s'\"`,:)]+")
+	errorImageNamePattern = regexp.MustCompile(`base-image-\d+`)
+)
+
+// errorBreakdown groups the failures by the kind of their error, most
+// frequent first
+func errorBreakdown(results []Result) []htmlErrorCount {
+	counts := map[string]int{}
+	for _, res := range results {
+		if res.Err != nil {
+			counts[errorKind(res.Err.Error())]++
+		}
+	}
+
+	breakdown := []htmlErrorCount{}
+	for message, count := range counts {
+		breakdown = append(breakdown, htmlErrorCount{Message: message, Count: count})
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Count == breakdown[j].Count {
+			return breakdown[i].Message < breakdown[j].Message
+		}
+		return breakdown[i].Count > breakdown[j].Count
+	})
+
+	return breakdown
+}
+
+// errorKind is the first line of an error message with the paths and image
+// names left out, so failures of the same kind are counted together
+func errorKind(message string) string {
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			line = errorPathPattern.ReplaceAllString(line, "${1}<path>")
+			return errorImageNamePattern.ReplaceAllString(line, "<image>")
+		}
+	}
+
+	return ""
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>grootfs-bench report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #f0f0f0; }
+svg { background: #fafafa; border: 1px solid #ccc; }
+rect { fill: #4a90d9; }
+.axis { font-size: 12px; color: #666; }
+pre { white-space: pre-wrap; margin: 0; }
+</style>
+</head>
+<body>
+<h1>grootfs-bench report</h1>
+<p class="axis">Generated at {{.GeneratedAt}}</p>
+
+<h2>Run configuration</h2>
+{{with .Summary.RunInfo}}
+<table>
+<tr><th>Run ID</th><td>{{.ID}}</td></tr>
+<tr><th>Started at</th><td>{{.StartedAt}}</td></tr>
+<tr><th>Finished at</th><td>{{.FinishedAt}}</td></tr>
+<tr><th>grootfs</th><td>{{.Config.GrootFSBinPath}} {{.GrootFSVersion}}</td></tr>
+<tr><th>Driver</th><td>{{.Config.Driver}}</td></tr>
+<tr><th>Store</th><td>{{.Config.StorePath}} ({{.Store.FilesystemType}} on {{.Store.MountPoint}}, {{.Store.MountOptions}})</td></tr>
+<tr><th>Base images</th><td>{{range .Config.BaseImages}}{{.}} {{end}}</td></tr>
+<tr><th>Log level</th><td>{{.Config.LogLevel}}</td></tr>
+<tr><th>Host</th><td>{{.Environment.Hostname}} ({{.Environment.OS}}/{{.Environment.Arch}}, kernel {{.Environment.KernelVersion}}, {{.Environment.NumCPU}} cpus, {{.Environment.MemoryBytes}} bytes of memory)</td></tr>
+</table>
+{{end}}
+<table>
+<tr><th>Total images requested</th><td>{{.Summary.TotalImages}}</td></tr>
+<tr><th>Concurrency factor</th><td>{{.Summary.ConcurrencyFactor}}</td></tr>
+<tr><th>Using quota?</th><td>{{.Summary.RanWithQuota}}</td></tr>
+<tr><th>Rootless?</th><td>{{.Summary.RanRootless}}</td></tr>
+<tr><th>Parallel clean?</th><td>{{.Summary.RanWithParallelClean}}</td></tr>
+</table>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Total duration</th><td>{{.Summary.TotalDuration}}</td></tr>
+<tr><th>Images per second</th><td>{{printf "%.3f" .Summary.ImagesPerSecond}}</td></tr>
+<tr><th>Average time per image</th><td>{{printf "%.3f" .Summary.AverageTimePerImage}}s</td></tr>
+<tr><th>Latency p50 / p90 / p95 / p99 / max</th><td>{{printf "%.3f" .Summary.LatencyP50}}s / {{printf "%.3f" .Summary.LatencyP90}}s / {{printf "%.3f" .Summary.LatencyP95}}s / {{printf "%.3f" .Summary.LatencyP99}}s / {{printf "%.3f" .Summary.LatencyMax}}s</td></tr>
+<tr><th>Number of cleans</th><td>{{.Summary.NumberOfCleans}}</td></tr>
+<tr><th>Number of deletes</th><td>{{.Summary.NumberOfDeletes}}</td></tr>
+<tr><th>Total errors</th><td>{{.Summary.TotalErrorsAmt}}</td></tr>
+<tr><th>Invalid rootfs</th><td>{{.Summary.InvalidRootFSAmt}}</td></tr>
+<tr><th>Error rate</th><td>{{printf "%.3f" .Summary.ErrorRate}}</td></tr>
+</table>
+
+{{with .Summary.Lifecycle}}
+<h2>Lifecycle</h2>
+<p>{{.WriteBytes}} bytes written into each image, kept for {{.DwellTime}}s.</p>
+<table>
+<tr><th>Step</th><th>Count</th><th>Errors</th><th>Average</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>Max</th></tr>
+{{range $.LifecycleSteps}}<tr><td>{{.Name}}</td>{{with .Stats}}<td>{{.Count}}</td><td>{{.Errors}}</td><td>{{printf "%.3f" .Average}}s</td><td>{{printf "%.3f" .P50}}s</td><td>{{printf "%.3f" .P90}}s</td><td>{{printf "%.3f" .P95}}s</td><td>{{printf "%.3f" .P99}}s</td><td>{{printf "%.3f" .Max}}s</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+
+{{define "chart"}}
+{{if .Bars}}
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}: {{.Count}}</title></rect>
+{{end}}</svg>
+<p class="axis">{{.XLabel}}: {{.XMin}} to {{.XMax}} &mdash; {{.YLabel}}: 0 to {{.YMax}}</p>
+{{else}}
+<p>No successful images.</p>
+{{end}}
+{{end}}
+
+<h2>Latency histogram</h2>
+{{template "chart" .Latency}}
+
+<h2>Throughput over time</h2>
+{{template "chart" .Throughput}}
+
+<h2>Errors</h2>
+{{if .Errors}}
+<table>
+<tr><th>Count</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{.Count}}</td><td><pre>{{.Message}}</pre></td></tr>
+{{end}}</table>
+{{else}}
+<p>No errors.</p>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,117 @@
+package bench_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("HTMLPrinter", func() {
+	var (
+		summary   bench.Summary
+		outBuffer *gbytes.Buffer
+		errBuffer *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		start := time.Now()
+		summary = bench.Summary{
+			TotalDuration:        3 * time.Second,
+			ImagesPerSecond:      0.88,
+			RanWithQuota:         true,
+			RanWithParallelClean: false,
+			NumberOfCleans:       5,
+			NumberOfDeletes:      7,
+			AverageTimePerImage:  2,
+			TotalErrorsAmt:       3,
+			ErrorRate:            4,
+			TotalImages:          5,
+			ConcurrencyFactor:    6,
+			ErrorMessages:        []string{"o noes"},
+			RunInfo: bench.RunInfo{
+				ID:             "1234",
+				GrootFSVersion: "0.16.0",
+				Config: bench.RunConfig{
+					GrootFSBinPath: "/bin/grootfs",
+					Driver:         "overlay-xfs",
+					BaseImages:     []string{"docker:///busybox"},
+				},
+			},
+			Results: []bench.Result{
+				{Duration: time.Second, StartedAt: start},
+				{Duration: 2 * time.Second, StartedAt: start.Add(time.Second)},
+				{Err: errors.New("exit status 1, <disk full>"), Duration: time.Second, StartedAt: start},
+				{Err: errors.New("exit status 1, <disk full>"), Duration: time.Second, StartedAt: start},
+				{Err: errors.New("exit status 2, timeout"), Duration: time.Second, StartedAt: start},
+			},
+		}
+
+		outBuffer = gbytes.NewBuffer()
+		errBuffer = gbytes.NewBuffer()
+	})
+
+	It("prints the configuration and the summary", func() {
+		Expect(bench.NewHTMLPrinter(outBuffer, errBuffer).Print(summary)).To(Succeed())
+
+		Expect(outBuffer).To(gbytes.Say(`<!DOCTYPE html>`))
+		Expect(outBuffer).To(gbytes.Say(`Run ID</th><td>1234</td>`))
+		Expect(outBuffer).To(gbytes.Say(`grootfs</th><td>/bin/grootfs 0.16.0</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Driver</th><td>overlay-xfs</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Base images</th><td>docker:///busybox </td>`))
+		Expect(outBuffer).To(gbytes.Say(`Total images requested</th><td>5</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Concurrency factor</th><td>6</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Using quota\?</th><td>true</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Total duration</th><td>3s</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Images per second</th><td>0.880</td>`))
+		Expect(outBuffer).To(gbytes.Say(`Error rate</th><td>4.000</td>`))
+	})
+
+	It("draws the latency histogram and the throughput chart", func() {
+		Expect(bench.NewHTMLPrinter(outBuffer, errBuffer).Print(summary)).To(Succeed())
+
+		Expect(outBuffer).To(gbytes.Say(`Latency histogram`))
+		Expect(outBuffer).To(gbytes.Say(`<rect x="0" y="0" width="29" height="200"><title>1.000s - 1.050s: 1</title></rect>`))
+		Expect(outBuffer).To(gbytes.Say(`seconds per image: 1.000s to 2.000s`))
+		Expect(outBuffer).To(gbytes.Say(`Throughput over time`))
+		Expect(outBuffer).To(gbytes.Say(`<svg`))
+		Expect(outBuffer).To(gbytes.Say(`time since start: 0s to 3s`))
+	})
+
+	It("groups the errors by message, escaping them", func() {
+		Expect(bench.NewHTMLPrinter(outBuffer, errBuffer).Print(summary)).To(Succeed())
+
+		Expect(outBuffer).To(gbytes.Say(`<td>2</td><td><pre>exit status 1, &lt;disk full&gt;</pre></td>`))
+		Expect(outBuffer).To(gbytes.Say(`<td>1</td><td><pre>exit status 2, timeout</pre></td>`))
+	})
+
+	It("groups the errors of the same kind, whatever their image", func() {
+		summary.Results = []bench.Result{
+			{Err: errors.New("exit status 1, creating base-image-1: open /store/images/base-image-1/rootfs: no space left\n{\"log\":1}"), Duration: time.Second},
+			{Err: errors.New("exit status 1, creating base-image-2: open /store/images/base-image-2/rootfs: no space left\n{\"log\":2}"), Duration: time.Second},
+			{Err: errors.New("exit status 1, pulling docker:///busybox: timeout"), Duration: time.Second},
+		}
+		Expect(bench.NewHTMLPrinter(outBuffer, errBuffer).Print(summary)).To(Succeed())
+
+		Expect(outBuffer).To(gbytes.Say(`<td>2</td><td><pre>exit status 1, creating &lt;image&gt;: open &lt;path&gt;: no space left</pre></td>`))
+		Expect(outBuffer).To(gbytes.Say(`<td>1</td><td><pre>exit status 1, pulling docker:///busybox: timeout</pre></td>`))
+	})
+
+	It("prints the error messages if something went wrong", func() {
+		Expect(bench.NewHTMLPrinter(outBuffer, errBuffer).Print(summary)).To(Succeed())
+
+		Expect(errBuffer).To(gbytes.Say("o noes"))
+	})
+
+	Context("when there are no results", func() {
+		It("still renders the report", func() {
+			Expect(bench.NewHTMLPrinter(outBuffer, errBuffer).Print(bench.Summary{})).To(Succeed())
+
+			Expect(outBuffer).To(gbytes.Say(`No successful images.`))
+			Expect(outBuffer).To(gbytes.Say(`No errors.`))
+		})
+	})
+})
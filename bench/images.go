@@ -0,0 +1,67 @@
+package bench
+
+import "sync"
+
+// ImageList holds the images of a run that are alive, in the order they were
+// created. It is shared by the jobs of a run, a nil list is always empty.
+type ImageList struct {
+	mutex sync.Mutex
+	names []string
+}
+
+func NewImageList() *ImageList {
+	return &ImageList{}
+}
+
+func (l *ImageList) Add(imageName string) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.names = append(l.names, imageName)
+}
+
+// Remove takes an image out of the list, returning whether it was in it
+func (l *ImageList) Remove(imageName string) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, name := range l.names {
+		if name == imageName {
+			l.names = append(l.names[:i], l.names[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Newest returns the last image created, or an empty name if there is none
+func (l *ImageList) Newest() string {
+	if l == nil {
+		return ""
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.names) == 0 {
+		return ""
+	}
+
+	return l.names[len(l.names)-1]
+}
+
+func (l *ImageList) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.names)
+}
@@ -2,9 +2,12 @@ package bench
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math/rand"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,9 +16,23 @@ import (
 
 type JobExecutor struct {
 	Jobs []*Job
+
+	// Teardown deletes the images the run left behind once every job is done
+	Teardown bool
+	// TeardownClean runs a final clean after the teardown
+	TeardownClean bool
+
+	// Noise loads the host while the jobs run
+	Noise []*Noise
+
+	// Observers are told about the commands of the jobs as they run
+	Observers []Observer
 }
 
-func (e *JobExecutor) Run() Summary {
+// Run runs the jobs until the images are created or ctx is done, in which
+// case commands in flight are killed and the summary covers the images
+// created so far. The teardown runs either way, so images are not leaked.
+func (e *JobExecutor) Run(ctx context.Context) Summary {
 	if len(e.Jobs) == 0 {
 		return Summary{}
 	}
@@ -23,106 +40,298 @@ func (e *JobExecutor) Run() Summary {
 	var wg sync.WaitGroup
 	wg.Add(len(e.Jobs))
 
+	totalImages := 0
+	for _, job := range e.Jobs {
+		totalImages += job.TotalImages
+	}
+
 	summaryChannel := make(chan Summary, len(e.Jobs))
 	doneChannel := make(chan bool)
-	createdImagesChannel := make(chan string, e.Jobs[0].TotalImages)
+	createdImagesChannel := make(chan string, totalImages)
+	liveImages := NewImageList()
 
+	observerMutex := &sync.Mutex{}
+	stopNoise := runNoise(e.Noise)
 	for _, job := range e.Jobs {
-		job.Done = doneChannel
-		job.Mutex = &sync.Mutex{}
-		job.CreatedImages = createdImagesChannel
+		job.done = doneChannel
+		job.mutex = &sync.Mutex{}
+		job.observers = e.Observers
+		job.observerMutex = observerMutex
+		job.createdImages = createdImagesChannel
+		job.images = liveImages
 		go func(job *Job) {
 			defer wg.Done()
-			summary := job.Run()
-			if job.Command == "create" {
+			summary := job.Run(ctx)
+			if summary != nil {
 				summaryChannel <- *summary
 			}
 		}(job)
 	}
 
 	wg.Wait()
-	finalSummary := <-summaryChannel
+	var finalSummary Summary
+	select {
+	case finalSummary = <-summaryChannel:
+	default:
+		// no job creates images, only the repeated commands ran
+	}
+	finalSummary.Noise = stopNoise()
 
+	leftImages := []string{}
 	for _, job := range e.Jobs {
-		job.Mutex.Lock()
-		if job.Command == "clean" {
-			finalSummary.NumberOfCleans = job.RunCounter
+		job.mutex.Lock()
+		if job.Command == CommandClean {
+			finalSummary.NumberOfCleans = job.runCounter
+		}
+
+		if job.Command == CommandDelete {
+			finalSummary.NumberOfDeletes = job.runCounter
+			finalSummary.DeleteStrategy = job.DeleteStrategy
+			if finalSummary.DeleteStrategy == "" {
+				finalSummary.DeleteStrategy = DeleteFIFO
+			}
+			leftImages = append(leftImages, job.liveImages...)
 		}
 
-		if job.Command == "delete" {
-			finalSummary.NumberOfDeletes = job.RunCounter
+		if !job.Command.CreatesImages() {
+			finalSummary.Commands = append(finalSummary.Commands, job.commandSummary())
 		}
-		job.Mutex.Unlock()
+		job.mutex.Unlock()
+	}
+
+	if e.Teardown {
+		leftImages = append(leftImages, drainImages(createdImagesChannel)...)
+		finalSummary.Teardown = e.summaryJob().teardown(leftImages, e.TeardownClean)
 	}
+
 	return finalSummary
 }
 
+// summaryJob is the job timing the images, whose settings the teardown uses
+func (e *JobExecutor) summaryJob() *Job {
+	for _, job := range e.Jobs {
+		if job.Command.CreatesImages() {
+			return job
+		}
+	}
+
+	return e.Jobs[0]
+}
+
+func drainImages(images chan string) []string {
+	names := []string{}
+	for {
+		select {
+		case imageName := <-images:
+			if imageName == "" {
+				return names
+			}
+			names = append(names, imageName)
+		default:
+			return names
+		}
+	}
+}
+
 type Result struct {
 	// Original error from grootfs if it occurrs
 	Err error
 
 	// Duration took by grootfs bin to run
 	Duration time.Duration
+
+	// Time at which grootfs bin was invoked
+	StartedAt time.Time
+
+	// Duration of each step in lifecycle mode, keyed by step name
+	Steps map[string]time.Duration
+
+	// Step that failed in lifecycle mode
+	FailedStep string
+
+	// Rootfs and mounts returned by grootfs create
+	RootFSPath string
+	Mounts     []Mount
+
+	// Disk limit the image was created with, 0 without quota
+	QuotaBytes int64
+
+	// Base image the image was created from
+	BaseImage string
+
+	// Resources grootfs create used, when run in a cgroup
+	Cgroup *CgroupStats
 }
 
-// Summary represents some metrics while running grootfs with given input
+// Summary represents some metrics while running grootfs with given input. Its
+// json encoding is described by schema/summary-v1.json, durations are encoded
+// in seconds.
 type Summary struct {
 	TotalDuration        time.Duration `json:"total_duration"`
 	ImagesPerSecond      float64       `json:"images_per_second"`
 	RanWithQuota         bool          `json:"ran_with_quota"`
+	RanRootless          bool          `json:"ran_rootless"`
 	RanWithParallelClean bool          `json:"ran_with_parallel_clean"`
 	NumberOfCleans       int           `json:"number_of_cleans"`
 	NumberOfDeletes      int           `json:"number_of_deletes"`
+	DeleteStrategy       string        `json:"delete_strategy"`
 	AverageTimePerImage  float64       `json:"average_time_per_image"`
+	LatencyP50           float64       `json:"latency_p50"`
+	LatencyP90           float64       `json:"latency_p90"`
+	LatencyP95           float64       `json:"latency_p95"`
+	LatencyP99           float64       `json:"latency_p99"`
+	LatencyMax           float64       `json:"latency_max"`
 	TotalErrorsAmt       int           `json:"total_errors_amt"`
+	InvalidRootFSAmt     int           `json:"invalid_rootfs_amt"`
 	ErrorRate            float64       `json:"error_rate"`
 	TotalImages          int           `json:"total_images"`
 	ConcurrencyFactor    int           `json:"concurrency_factor"`
-	ErrorMessages        []string      `json:"-"`
+	ErrorMessages        []string      `json:"error_messages"`
+	Results              []Result      `json:"-"`
+	RunInfo              RunInfo       `json:"run_info"`
+
+	Lifecycle  *LifecycleSummary  `json:"lifecycle,omitempty"`
+	Teardown   *TeardownSummary   `json:"teardown,omitempty"`
+	Commands   []CommandSummary   `json:"commands,omitempty"`
+	Quotas     []QuotaSummary     `json:"quotas,omitempty"`
+	BaseImages []BaseImageSummary `json:"base_images,omitempty"`
+	Cache      *CacheSummary      `json:"cache,omitempty"`
+	Registry   *RegistrySummary   `json:"registry,omitempty"`
+	Cgroup     *CgroupSummary     `json:"cgroup,omitempty"`
+	Noise      []NoiseSummary     `json:"noise,omitempty"`
+	Aborted    string             `json:"aborted,omitempty"`
+	Store      *StoreSummary      `json:"store_lifecycle,omitempty"`
+	Images     []ImageSummary     `json:"images,omitempty"`
 }
 
 type Job struct {
-	Runner         commandrunner.CommandRunner
-	GrootFSBinPath string
-	StorePath      string
-	Driver         string
-	MetricsEnabled bool
-	LogLevel       string
-	Command        string
-	BaseImages     []string
-	Interval       int
-	UseQuota       bool
-	Concurrency    int
-	TotalImages    int
-	CreatedImages  chan string
-	Done           chan bool
-	Results        chan *Result
-	StartTime      time.Time
-	Duration       time.Duration
-
-	RunCounter int
-	Mutex      *sync.Mutex
+	Runner                commandrunner.CommandRunner
+	GrootFSBinPath        string
+	StorePath             string
+	Driver                string
+	MetricsEnabled        bool
+	LogLevel              string
+	Command               Command
+	ExtraArgs             []string
+	GlobalArgs            []string
+	CommandArgs           map[string][]string
+	BaseImages            []string
+	BaseImageWeights      []int
+	BaseImageDistribution string
+	BaseImageSeed         int64
+	ZipfExponent          float64
+	Interval              int
+	DeleteStrategy        string
+	DeleteSeed            int64
+	KeepLive              int
+	UseQuota              bool
+	Quotas                []QuotaSize
+	QuotaSeed             int64
+	ExcludeImageFromQuota bool
+	Rootless              bool
+	UID                   uint32
+	GID                   uint32
+	UIDMappings           []string
+	GIDMappings           []string
+	CacheMode             string
+	DropCaches            bool
+	WriteBytes            int64
+	DwellTime             time.Duration
+	VerifyRootFS          bool
+	ExpectedFiles         []string
+	Concurrency           int
+	TotalImages           int
+	StartTime             time.Time
+	Duration              time.Duration
+
+	// OnResult is called with every image created or cycled, as soon as it
+	// is. It is never called concurrently.
+	OnResult func(Result)
+
+	// shared by the jobs of an executor: the images created, for the delete
+	// job, the live images and the end of the run
+	createdImages chan string
+	images        *ImageList
+	done          chan bool
+	mutex         *sync.Mutex
+
+	results       chan *Result
+	runCounter    int
+	onResultMutex sync.Mutex
+
+	// observers of the executor, never called concurrently
+	observers     []Observer
+	observerMutex *sync.Mutex
+
+	// images created and not deleted yet, as seen by the delete job
+	liveImages          []string
+	createdImagesClosed bool
+	random              *rand.Rand
+
+	// runs of a repeated command
+	samples []CommandSample
+	index   int64
+
+	// time spent preparing the cache, not counted in Duration
+	cacheDuration  time.Duration
+	cacheDurations []time.Duration
+	cacheErrors    []string
+
+	baseImageRandom *rand.Rand
+	baseImageZipf   *rand.Zipf
+
+	quotaMutex   sync.Mutex
+	quotaCounter int
+	quotaRandom  *rand.Rand
 }
 
-func (j *Job) Run() *Summary {
+// Run runs the job until it is done or ctx is. Images created are deleted
+// without ctx, so a cancelled job does not leak them.
+func (j *Job) Run(ctx context.Context) *Summary {
 	if j.Concurrency == 0 {
 		j.Concurrency = runtime.NumCPU()
 	}
 
+	if j.images == nil {
+		j.images = NewImageList()
+	}
+	if j.done == nil {
+		j.done = make(chan bool)
+	}
+	if j.mutex == nil {
+		j.mutex = &sync.Mutex{}
+	}
+	if j.observerMutex == nil {
+		j.observerMutex = &sync.Mutex{}
+	}
+	if j.createdImages == nil {
+		j.createdImages = make(chan string, j.TotalImages)
+	}
+
+	if j.CacheMode == CacheWarm {
+		j.warmCache(ctx)
+	}
+
 	j.StartTime = time.Now()
-	if j.Command == "create" {
-		j.runWorkers()
-		close(j.Done)
+	if j.Command == CommandCreate {
+		j.runWorkers(ctx)
+		close(j.done)
+	} else if j.Command == CommandLifecycle {
+		j.runLifecycleWorkers(ctx)
+		close(j.done)
 	} else {
-		j.runLoop(j.Done)
+		j.runLoop(ctx, j.done)
 	}
 	j.Duration = time.Since(j.StartTime)
+	if j.CacheMode == CacheCold {
+		j.Duration -= j.cacheDuration
+	}
 
 	return j.summarizeResults()
 }
 
 func (j *Job) summarizeResults() *Summary {
-	if j.Command != "create" {
+	if !j.Command.CreatesImages() {
 		return nil
 	}
 
@@ -130,111 +339,270 @@ func (j *Job) summarizeResults() *Summary {
 		ConcurrencyFactor: j.Concurrency,
 		TotalDuration:     j.Duration,
 		RanWithQuota:      j.UseQuota,
+		RanRootless:       j.Rootless,
 	}
 
 	errors := []string{}
 
 	averageTimePerImage := 0.0
+	durations := []time.Duration{}
 
-	for res := range j.Results {
+	for res := range j.results {
 		summary.TotalImages++
+		summary.Results = append(summary.Results, *res)
 
 		if res.Err != nil {
 			summary.TotalErrorsAmt++
-			errors = append(errors, fmt.Sprintf("could not create image %d: %s\n", summary.TotalImages, res.Err))
+			if isInvalidRootFS(res.Err) {
+				summary.InvalidRootFSAmt++
+			}
+
+			if j.Command == CommandLifecycle {
+				errors = append(errors, fmt.Sprintf("lifecycle of image %d failed: %s\n", summary.TotalImages, res.Err))
+			} else {
+				errors = append(errors, fmt.Sprintf("could not create image %d: %s\n", summary.TotalImages, res.Err))
+			}
 		} else {
 			averageTimePerImage += res.Duration.Seconds()
+			durations = append(durations, res.Duration)
 		}
 	}
 
 	createdImages := float64(summary.TotalImages - summary.TotalErrorsAmt)
 	summary.ImagesPerSecond = createdImages / j.Duration.Seconds()
-	summary.ErrorRate = float64(summary.TotalErrorsAmt*100) / float64(summary.TotalImages)
+	if summary.TotalImages > 0 {
+		// a cancelled run may not have created any
+		summary.ErrorRate = float64(summary.TotalErrorsAmt*100) / float64(summary.TotalImages)
+	}
 	if createdImages == float64(0) {
 		summary.AverageTimePerImage = float64(-1)
 	} else {
 		summary.AverageTimePerImage = averageTimePerImage / createdImages
 	}
+	summary.LatencyP50 = percentile(durations, 50)
+	summary.LatencyP90 = percentile(durations, 90)
+	summary.LatencyP95 = percentile(durations, 95)
+	summary.LatencyP99 = percentile(durations, 99)
+	summary.LatencyMax = percentile(durations, 100)
 	summary.TotalDuration = j.Duration
 	summary.ErrorMessages = errors
+	if j.Command == CommandLifecycle {
+		summary.Lifecycle = j.summarizeLifecycle(summary.Results)
+	}
+	if j.UseQuota {
+		summary.Quotas = summarizeQuotas(summary.Results)
+	}
+	summary.BaseImages = j.summarizeBaseImages(summary.Results)
+	summary.Images = summarizeImages(summary.Results)
+	summary.Cache = j.summarizeCache()
+	summary.Cgroup = j.summarizeCgroup(summary.Results)
 	return &summary
 }
 
-func (j *Job) runLoop(done chan bool) {
-	go func() {
+// runLoop runs the command every Interval seconds until done is closed or
+// ctx is done. A keep-live delete job deletes every image over KeepLive on
+// each tick.
+func (j *Job) runLoop(ctx context.Context, done chan bool) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
 		for {
-			select {
-			case <-done:
-				return
-			default:
-				cmd := j.grootfsCmd("")
-				if cmd != nil {
-					j.runCommand(cmd)
-					j.Mutex.Lock()
-					j.RunCounter++
-					j.Mutex.Unlock()
-				}
-				time.Sleep(time.Second * time.Duration(j.Interval))
+			cmd := j.grootfsCmd(ctx, "")
+			if cmd == nil {
+				break
+			}
+			j.runCommand(cmd)
+			j.mutex.Lock()
+			j.runCounter++
+			j.mutex.Unlock()
+
+			if j.Command != CommandDelete || j.DeleteStrategy != DeleteKeepLive || ctx.Err() != nil {
+				break
 			}
 		}
-	}()
-}
 
-func (j *Job) runWorkers() {
-	var wg sync.WaitGroup
-	wg.Add(j.Concurrency)
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * time.Duration(j.Interval)):
+		}
+	}
+}
 
-	cmds := make(chan *exec.Cmd, j.TotalImages)
-	n := 0
+// runWorkers creates the images, Concurrency at a time, until they are all
+// created or ctx is done
+func (j *Job) runWorkers(ctx context.Context) {
+	cmds := []*exec.Cmd{}
 	for i := 0; i < j.TotalImages; i++ {
-		n = i % len(j.BaseImages)
-		cmd := j.grootfsCmd(j.BaseImages[n])
+		cmd := j.grootfsCmd(ctx, j.nextBaseImage(i))
 		if cmd != nil {
-			cmds <- cmd
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	j.results = make(chan *Result, j.TotalImages)
+
+	if j.CacheMode == CacheCold {
+		// each round of images starts from a store with no layer, and its
+		// images are deleted so the next one does too
+		for start := 0; start < len(cmds) && ctx.Err() == nil; start += j.Concurrency {
+			end := start + j.Concurrency
+			if end > len(cmds) {
+				end = len(cmds)
+			}
+
+			j.coolCache(ctx)
+			j.runConcurrently(ctx, cmds[start:end])
+			j.deleteImages(cmds[start:end])
 		}
+	} else {
+		j.runConcurrently(ctx, cmds)
 	}
-	close(cmds)
 
-	j.Results = make(chan *Result, j.TotalImages)
+	close(j.results)
+}
+
+// runConcurrently runs the commands, leaving the ones not started yet when
+// ctx is done
+func (j *Job) runConcurrently(ctx context.Context, cmds []*exec.Cmd) {
+	var wg sync.WaitGroup
+	wg.Add(j.Concurrency)
+
+	queue := make(chan *exec.Cmd, len(cmds))
+	for _, cmd := range cmds {
+		queue <- cmd
+	}
+	close(queue)
 
 	for i := 0; i < j.Concurrency; i++ {
 		go func(number int) {
 			defer wg.Done()
-			for cmd := range cmds {
+			for cmd := range queue {
+				if ctx.Err() != nil {
+					return
+				}
 				j.runCommand(cmd)
 			}
 		}(i)
 	}
 
 	wg.Wait()
-
-	close(j.Results)
 }
 
 func (j *Job) runCommand(cmd *exec.Cmd) {
 	start := time.Now()
+	event := j.observeStart(cmd.Args[1:], start)
+
+	if j.Command != CommandCreate {
+		liveImages := j.images.Len()
+		_, cgroup, err := j.measure(cmd)
+		duration := time.Since(start)
+		j.recordSample(liveImages, duration, err, cgroup)
+		j.observeCompletion(event, Result{Err: err, Duration: duration, StartedAt: start, Cgroup: cgroup})
+		return
+	}
+
+	image, cgroup, cmdErr := j.createImage(cmd)
+	duration := time.Since(start)
+
+	imageName := cmd.Args[len(cmd.Args)-1]
+	if cmdErr == nil || isInvalidRootFS(cmdErr) {
+		if j.CacheMode != CacheCold {
+			// cold rounds delete their own images
+			j.createdImages <- imageName
+		}
+		j.images.Add(imageName)
+	}
 
-	buffer := bytes.NewBuffer([]byte{})
-	cmd.Stdout = buffer
-	cmd.Stderr = buffer
+	j.report(event, &Result{
+		Err:        cmdErr,
+		Duration:   duration,
+		StartedAt:  start,
+		RootFSPath: image.RootFSPath,
+		Mounts:     image.Mounts,
+		QuotaBytes: quotaOf(cmd.Args),
+		BaseImage:  cmd.Args[len(cmd.Args)-2],
+		Cgroup:     cgroup,
+	})
+}
 
-	var cmdErr error
-	if err := j.Runner.Run(cmd); err != nil {
-		cmdErr = fmt.Errorf("%s, %s", err, buffer.String())
+// report hands a result to the summary, the observers and OnResult
+func (j *Job) report(event CommandEvent, result *Result) {
+	j.observeCompletion(event, *result)
+	if j.OnResult != nil {
+		j.onResultMutex.Lock()
+		j.OnResult(*result)
+		j.onResultMutex.Unlock()
 	}
 
-	if j.Command == "create" {
-		imageName := cmd.Args[len(cmd.Args)-1]
-		j.CreatedImages <- imageName
+	j.results <- result
+}
+
+// execute runs the command, returning its stdout. Errors include everything
+// grootfs printed.
+func (j *Job) execute(cmd *exec.Cmd) (string, error) {
+	stdout, _, err := j.measure(cmd)
+	return stdout, err
+}
+
+// measure runs the command like execute, also returning the stats of its
+// cgroup, nil when the job does not use cgroups
+func (j *Job) measure(cmd *exec.Cmd) (string, *CgroupStats, error) {
+	stdout := bytes.NewBuffer([]byte{})
+	stderr := bytes.NewBuffer([]byte{})
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	j.runAs(cmd)
+
+	err := j.Runner.Run(cmd)
+	cgroup := j.cgroupStats(cmd)
+	if err != nil {
+		return stdout.String(), cgroup, fmt.Errorf("%s, %s%s", err, stdout.String(), stderr.String())
+	}
 
-		j.Results <- &Result{
-			Err:      cmdErr,
-			Duration: time.Since(start),
+	return stdout.String(), cgroup, nil
+}
+
+// grootfsCmd builds the command the job runs. Commands acting on an image
+// are given one of the run's images, and are skipped (nil) while there is
+// none; any other command gets only the global and extra args. The command
+// is killed when ctx is done.
+func (j *Job) grootfsCmd(ctx context.Context, baseImage string) *exec.Cmd {
+	values := ArgValues{Index: j.nextIndex()}
+
+	switch j.Command {
+	case CommandCreate:
+		values.ImageName = newImageName()
+		values.BaseImage = baseImage
+		args := append(j.grootfsArgs(j.Command, values), j.createArgs(baseImage, values.ImageName)...)
+		return exec.CommandContext(ctx, j.GrootFSBinPath, args...)
+	case CommandDelete:
+		values.ImageName = j.nextImageToDelete()
+		if values.ImageName == "" {
+			return nil
 		}
+		j.images.Remove(values.ImageName)
+	case CommandStats:
+		values.ImageName = j.images.Newest()
+		if values.ImageName == "" {
+			return nil
+		}
+	default:
+		return exec.CommandContext(ctx, j.GrootFSBinPath, j.grootfsArgs(j.Command, values)...)
 	}
+
+	return exec.CommandContext(ctx, j.GrootFSBinPath, append(j.grootfsArgs(j.Command, values), values.ImageName)...)
 }
 
-func (j *Job) grootfsCmd(baseImage string) *exec.Cmd {
+func (j *Job) globalArgs(values ArgValues) []string {
 	args := []string{
 		"--store",
 		j.StorePath,
@@ -250,25 +618,21 @@ func (j *Job) grootfsCmd(baseImage string) *exec.Cmd {
 		args = append(args, "--driver", j.Driver)
 	}
 
-	args = append(args, j.Command)
+	return append(args, expandArgs(j.GlobalArgs, values)...)
+}
 
-	if j.Command == "create" {
-		if j.UseQuota {
-			args = append(args, "--disk-limit-size-bytes", "1019430400")
-		}
-		imageName := fmt.Sprintf("base-image-%d", time.Now().UnixNano())
-		args = append(args,
-			baseImage,
-			imageName,
-		)
-
-	} else if j.Command == "delete" {
-		imageName := <-j.CreatedImages
-		if imageName == "" {
-			return nil
+func (j *Job) createArgs(baseImage, imageName string) []string {
+	args := j.mappingArgs()
+	if j.UseQuota {
+		args = append(args, "--disk-limit-size-bytes", strconv.FormatInt(j.nextQuota(), 10))
+		if j.ExcludeImageFromQuota {
+			args = append(args, "--exclude-image-from-quota")
 		}
-		args = append(args, imageName)
 	}
 
-	return exec.Command(j.GrootFSBinPath, args...)
+	return append(args, baseImage, imageName)
+}
+
+func newImageName() string {
+	return fmt.Sprintf("base-image-%d", time.Now().UnixNano())
 }
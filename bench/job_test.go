@@ -1,11 +1,11 @@
 package bench_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
 	"runtime"
-	"sync"
 	"time"
 
 	"code.cloudfoundry.org/commandrunner/fake_command_runner"
@@ -23,7 +23,7 @@ var _ = Describe("Job", func() {
 
 			fakeCmdRunner := job.Runner.(*fake_command_runner.FakeCommandRunner)
 
-			job.Run()
+			job.Run(context.Background())
 
 			executedCommands := fakeCmdRunner.ExecutedCommands()
 			Expect(len(executedCommands)).To(Equal(11))
@@ -50,7 +50,7 @@ var _ = Describe("Job", func() {
 
 				fakeCmdRunner := job.Runner.(*fake_command_runner.FakeCommandRunner)
 
-				job.Run()
+				job.Run(context.Background())
 
 				executedCommands := fakeCmdRunner.ExecutedCommands()
 				Expect(len(executedCommands)).To(Equal(11))
@@ -86,13 +86,18 @@ var _ = Describe("Job", func() {
 			})
 
 			It("returns the errors", func() {
-				summary := job.Run()
+				summary := job.Run(context.Background())
 
 				Expect(summary.ErrorMessages).To(HaveLen(10))
 				for _, message := range summary.ErrorMessages {
 					Expect(message).To(ContainSubstring("groot failed to make a image"))
 				}
 			})
+
+			It("does not hand the failed images to the delete job", func() {
+				job.Run(context.Background())
+				Expect(job.CreatedImages()).To(BeEmpty())
+			})
 		})
 
 		Context("when not providing concurrency level", func() {
@@ -100,7 +105,7 @@ var _ = Describe("Job", func() {
 				job := createJob()
 				job.Concurrency = 0
 
-				summary := job.Run()
+				summary := job.Run(context.Background())
 
 				Expect(summary.ConcurrencyFactor).To(Equal(runtime.NumCPU()))
 			})
@@ -113,7 +118,7 @@ var _ = Describe("Job", func() {
 			fakeCmdRunner := job.Runner.(*fake_command_runner.FakeCommandRunner)
 
 			jobAssassin(job)
-			job.Run()
+			job.Run(context.Background())
 
 			Eventually(fakeCmdRunner.ExecutedCommands, 5*time.Second).ShouldNot(BeEmpty())
 
@@ -138,18 +143,18 @@ var _ = Describe("Job", func() {
 
 		JustBeforeEach(func() {
 			job = deleteJob()
-			job.CreatedImages <- "image-0"
-			job.CreatedImages <- "image-1"
-			job.CreatedImages <- "image-2"
-			job.CreatedImages <- "image-3"
-			close(job.CreatedImages)
+			job.CreatedImages() <- "image-0"
+			job.CreatedImages() <- "image-1"
+			job.CreatedImages() <- "image-2"
+			job.CreatedImages() <- "image-3"
+			close(job.CreatedImages())
 
 			fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
 		})
 
 		It("deletes the expected images", func() {
 			jobAssassin(job)
-			job.Run()
+			job.Run(context.Background())
 
 			Eventually(fakeCmdRunner.ExecutedCommands, 5*time.Second).Should(HaveLen(4))
 
@@ -172,7 +177,7 @@ var _ = Describe("Job", func() {
 
 				Expect(fakeCmdRunner.ExecutedCommands()).Should(HaveLen(0))
 				jobAssassin(job)
-				job.Run()
+				job.Run(context.Background())
 				Eventually(fakeCmdRunner.ExecutedCommands, 5*time.Second).Should(HaveLen(3))
 			})
 		})
@@ -183,13 +188,24 @@ var _ = Describe("Job", func() {
 			job := createJob()
 			job.Concurrency = 2
 			job.TotalImages = 2
-			summary := job.Run()
+			summary := job.Run(context.Background())
 
 			Expect(summary.TotalImages).To(Equal(2))
 			Expect(summary.TotalDuration).To(BeNumerically("~", time.Second*20, time.Second*21))
 			Expect(summary.ConcurrencyFactor).To(Equal(2))
 		})
 
+		It("returns the latency percentiles of the created images", func() {
+			job := createJob()
+			job.TotalImages = 4
+			job.Runner = &SlowFakeCommandRunner{Runner: fake_command_runner.New()}
+			summary := job.Run(context.Background())
+
+			Expect(summary.LatencyP50).To(BeNumerically("~", 1, 0.5))
+			Expect(summary.LatencyP95).To(BeNumerically(">=", summary.LatencyP50))
+			Expect(summary.LatencyMax).To(BeNumerically(">=", summary.LatencyP95))
+		})
+
 		Context("when there are 0 images created", func() {
 			var job *bench.Job
 
@@ -205,10 +221,18 @@ var _ = Describe("Job", func() {
 			})
 
 			It("sets the average time per image to -1", func() {
-				summary := job.Run()
+				summary := job.Run(context.Background())
 
 				Expect(summary.AverageTimePerImage).To(Equal(float64(-1)))
 			})
+
+			It("sets the latency percentiles to -1", func() {
+				summary := job.Run(context.Background())
+
+				Expect(summary.LatencyP50).To(Equal(float64(-1)))
+				Expect(summary.LatencyP95).To(Equal(float64(-1)))
+				Expect(summary.LatencyMax).To(Equal(float64(-1)))
+			})
 		})
 
 		Context("when command fails", func() {
@@ -226,19 +250,19 @@ var _ = Describe("Job", func() {
 			})
 
 			It("returns the total errors", func() {
-				summary := job.Run()
+				summary := job.Run(context.Background())
 				Expect(summary.TotalErrorsAmt).To(Equal(10))
 			})
 
 			It("returns the error rate", func() {
-				summary := job.Run()
+				summary := job.Run(context.Background())
 				// 33.33 because we're creating 2 in the outer BeforeEach
 				Expect(summary.ErrorRate).To(BeNumerically(">", 33.33))
 			})
 
 			It("sets RanWithQuota to true if quota was applied", func() {
 				job.UseQuota = true
-				summary := job.Run()
+				summary := job.Run(context.Background())
 				Expect(summary.RanWithQuota).To(BeTrue())
 			})
 		})
@@ -264,7 +288,7 @@ func cleanJob() *bench.Job {
 }
 
 func genericJob() *bench.Job {
-	return &bench.Job{
+	job := &bench.Job{
 		Runner:         fake_command_runner.New(),
 		GrootFSBinPath: "/path/to/grootfs",
 		StorePath:      "/store/path",
@@ -273,15 +297,14 @@ func genericJob() *bench.Job {
 		BaseImages:     []string{"docker:///busybox"},
 		Interval:       1,
 		Concurrency:    1,
-		CreatedImages:  make(chan string, 100),
-		Done:           make(chan bool),
-		Mutex:          new(sync.Mutex),
 	}
+	job.Share(make(chan string, 100), make(chan bool))
+	return job
 }
 
 func jobAssassin(job *bench.Job) {
 	go func() {
 		time.Sleep(5 * time.Second)
-		close(job.Done)
+		close(job.Done())
 	}()
 }
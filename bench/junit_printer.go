@@ -0,0 +1,106 @@
+package bench
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+func NewJUnitPrinter(out, err io.Writer, slos []SLO) *JUnitPrinter {
+	return &JUnitPrinter{out: out, err: err, slos: slos}
+}
+
+// JUnitPrinter reports every SLO as a test case, so CI systems can render
+// which thresholds the run did not meet
+type JUnitPrinter struct {
+	out  io.Writer
+	err  io.Writer
+	slos []SLO
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+	SystemErr  string          `xml:"system-err,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+func (p *JUnitPrinter) Print(summary Summary) error {
+	printErrors(summary, p.err)
+
+	suite := junitTestSuite{
+		Name: "grootfs-bench",
+		Time: formatFloat(summary.TotalDuration.Seconds()),
+	}
+
+	header, row := summaryRow(summary)
+	for i := range header {
+		suite.Properties = append(suite.Properties, junitProperty{Name: header[i], Value: row[i]})
+	}
+
+	for _, result := range CheckSLOs(summary, p.slos) {
+		testCase := junitTestCase{
+			Name:      result.SLO.String(),
+			ClassName: "grootfs-bench.slo",
+			Time:      "0",
+		}
+
+		if result.Err != nil {
+			suite.Errors++
+			testCase.Error = &junitFailure{Message: result.Err.Error(), Type: "error"}
+		} else if !result.Passed {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%s was %.3f, expected %s", result.SLO.Metric, result.Value, result.SLO),
+				Type:    "slo",
+			}
+		}
+
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	for _, message := range summary.ErrorMessages {
+		suite.SystemErr += message
+	}
+
+	if _, err := io.WriteString(p.out, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(p.out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(p.out, "\n")
+	return err
+}
@@ -0,0 +1,211 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Steps of an image lifecycle, in the order they run
+const (
+	StepCreate = "create"
+	StepWrite  = "write"
+	StepDwell  = "dwell"
+	StepDelete = "delete"
+	StepTotal  = "total"
+)
+
+const lifecycleDataFile = "grootfs-bench-data"
+
+// LifecycleSummary breaks the lifecycle of the images down by step. Total is
+// the end-to-end time of the lifecycles that fully succeeded.
+type LifecycleSummary struct {
+	WriteBytes int64        `json:"write_bytes"`
+	DwellTime  float64      `json:"dwell_time"`
+	Create     LatencyStats `json:"create"`
+	Write      LatencyStats `json:"write"`
+	Dwell      LatencyStats `json:"dwell"`
+	Delete     LatencyStats `json:"delete"`
+	Total      LatencyStats `json:"total"`
+}
+
+// runLifecycleWorkers cycles the images, Concurrency at a time, until they
+// are all cycled or ctx is done
+func (j *Job) runLifecycleWorkers(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(j.Concurrency)
+
+	baseImages := make(chan string, j.TotalImages)
+	for i := 0; i < j.TotalImages; i++ {
+		baseImages <- j.nextBaseImage(i)
+	}
+	close(baseImages)
+
+	j.results = make(chan *Result, j.TotalImages)
+
+	for i := 0; i < j.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for baseImage := range baseImages {
+				if ctx.Err() != nil {
+					return
+				}
+				event, result := j.lifecycle(ctx, baseImage)
+				j.report(event, result)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	close(j.results)
+}
+
+// lifecycle creates an image, writes into its rootfs, holds it and deletes
+// it. The image is deleted even if it is invalid, writing fails or ctx is
+// done, so it does not leak.
+func (j *Job) lifecycle(ctx context.Context, baseImage string) (CommandEvent, *Result) {
+	result := &Result{
+		StartedAt: time.Now(),
+		Steps:     map[string]time.Duration{},
+		BaseImage: baseImage,
+	}
+	imageName := newImageName()
+	values := ArgValues{ImageName: imageName, BaseImage: baseImage, Index: j.nextIndex()}
+
+	createCmd := exec.CommandContext(ctx, j.GrootFSBinPath, append(j.grootfsArgs(CommandCreate, values), j.createArgs(baseImage, imageName)...)...)
+	result.QuotaBytes = quotaOf(createCmd.Args)
+	event := j.observeStart(createCmd.Args[1:], result.StartedAt)
+	err := j.timeStep(result, StepCreate, func() error {
+		image, cgroup, err := j.createImage(createCmd)
+		result.Cgroup = cgroup
+		result.RootFSPath = image.RootFSPath
+		result.Mounts = image.Mounts
+		return err
+	})
+	result.Duration = result.Steps[StepCreate]
+	if err != nil && !isInvalidRootFS(err) {
+		return event, result
+	}
+	j.images.Add(imageName)
+
+	if result.Err == nil && j.WriteBytes > 0 {
+		j.timeStep(result, StepWrite, func() error {
+			return writeData(result.RootFSPath, j.WriteBytes)
+		})
+	}
+
+	if result.Err == nil && j.DwellTime > 0 {
+		j.timeStep(result, StepDwell, func() error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(j.DwellTime):
+				return nil
+			}
+		})
+	}
+
+	deleteCmd := exec.Command(j.GrootFSBinPath, append(j.grootfsArgs(CommandDelete, values), imageName)...)
+	j.images.Remove(imageName)
+	j.timeStep(result, StepDelete, func() error {
+		_, err := j.execute(deleteCmd)
+		return err
+	})
+
+	if result.Err == nil {
+		result.Steps[StepTotal] = time.Since(result.StartedAt)
+	}
+
+	return event, result
+}
+
+// timeStep runs a step, recording its duration and, if it is the first
+// failure of the lifecycle, its error
+func (j *Job) timeStep(result *Result, step string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	result.Steps[step] = time.Since(start)
+
+	if err != nil && result.Err == nil {
+		result.Err = stepError{step: step, err: err}
+		result.FailedStep = step
+	}
+
+	return err
+}
+
+// stepError prefixes an error with the lifecycle step it happened in, keeping
+// the original around so invalid rootfs errors can still be told apart
+type stepError struct {
+	step string
+	err  error
+}
+
+func (e stepError) Error() string {
+	return fmt.Sprintf("%s: %s", e.step, e.err)
+}
+
+func (j *Job) summarizeLifecycle(results []Result) *LifecycleSummary {
+	durations := map[string][]time.Duration{}
+	errors := map[string]int{}
+
+	for _, res := range results {
+		if res.FailedStep != "" {
+			errors[res.FailedStep]++
+			errors[StepTotal]++
+		}
+
+		for step, duration := range res.Steps {
+			if step != res.FailedStep {
+				durations[step] = append(durations[step], duration)
+			}
+		}
+	}
+
+	return &LifecycleSummary{
+		WriteBytes: j.WriteBytes,
+		DwellTime:  j.DwellTime.Seconds(),
+		Create:     NewLatencyStats(durations[StepCreate], errors[StepCreate]),
+		Write:      NewLatencyStats(durations[StepWrite], errors[StepWrite]),
+		Dwell:      NewLatencyStats(durations[StepDwell], errors[StepDwell]),
+		Delete:     NewLatencyStats(durations[StepDelete], errors[StepDelete]),
+		Total:      NewLatencyStats(durations[StepTotal], errors[StepTotal]),
+	}
+}
+
+// writeData fills a file in the rootfs with incompressible data and syncs it
+func writeData(rootfs string, size int64) error {
+	if rootfs == "" {
+		return errors.New("grootfs create did not return a rootfs path")
+	}
+
+	file, err := os.Create(filepath.Join(rootfs, lifecycleDataFile))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	chunk := make([]byte, 1024*1024)
+	rand.Read(chunk)
+
+	for written := int64(0); written < size; {
+		n := int64(len(chunk))
+		if size-written < n {
+			n = size - written
+		}
+
+		if _, err := file.Write(chunk[:n]); err != nil {
+			return err
+		}
+		written += n
+	}
+
+	return file.Sync()
+}
@@ -0,0 +1,177 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lifecycle", func() {
+	var (
+		job           *bench.Job
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		rootfsDir     string
+
+		mutex        sync.Mutex
+		dataAtDelete map[string]int64
+	)
+
+	BeforeEach(func() {
+		var err error
+		rootfsDir, err = ioutil.TempDir("", "rootfs")
+		Expect(err).NotTo(HaveOccurred())
+
+		job = genericJob()
+		job.Command = "lifecycle"
+		job.TotalImages = 3
+		job.Concurrency = 2
+
+		dataAtDelete = map[string]int64{}
+		fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			imageName := cmd.Args[len(cmd.Args)-1]
+			rootfs := filepath.Join(rootfsDir, imageName)
+
+			switch cmd.Args[len(cmd.Args)-2] {
+			case "delete":
+				mutex.Lock()
+				defer mutex.Unlock()
+				if info, err := os.Stat(filepath.Join(rootfs, "grootfs-bench-data")); err == nil {
+					dataAtDelete[imageName] = info.Size()
+				}
+				return os.RemoveAll(rootfs)
+			default:
+				if err := os.MkdirAll(rootfs, 0755); err != nil {
+					return err
+				}
+				cmd.Stdout.Write([]byte(`{"root":{"path":"` + rootfs + `"}}`))
+				return nil
+			}
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootfsDir)).To(Succeed())
+	})
+
+	It("creates and then deletes every image", func() {
+		summary := job.Run(context.Background())
+		Expect(summary.TotalImages).To(Equal(3))
+		Expect(summary.TotalErrorsAmt).To(Equal(0))
+
+		created := map[string]bool{}
+		deleted := []string{}
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			Expect(cmd.Args[:8]).To(Equal([]string{"/path/to/grootfs", "--store", "/store/path", "--log-level", "debug", "--driver", "btrfs", cmd.Args[7]}))
+			if cmd.Args[7] == "create" {
+				Expect(cmd.Args[8]).To(Equal("docker:///busybox"))
+				created[cmd.Args[9]] = true
+			} else {
+				Expect(cmd.Args[7]).To(Equal("delete"))
+				deleted = append(deleted, cmd.Args[8])
+			}
+		}
+		Expect(created).To(HaveLen(3))
+		Expect(deleted).To(HaveLen(3))
+		for _, imageName := range deleted {
+			Expect(created).To(HaveKey(imageName))
+		}
+	})
+
+	It("writes the requested amount of data into each rootfs before deleting it", func() {
+		job.WriteBytes = 3*1024*1024 + 5
+		summary := job.Run(context.Background())
+		Expect(summary.TotalErrorsAmt).To(Equal(0))
+
+		Expect(dataAtDelete).To(HaveLen(3))
+		for _, size := range dataAtDelete {
+			Expect(size).To(Equal(job.WriteBytes))
+		}
+		Expect(summary.Lifecycle.WriteBytes).To(Equal(job.WriteBytes))
+		Expect(summary.Lifecycle.Write.Count).To(Equal(3))
+	})
+
+	It("holds each image for the dwell time", func() {
+		job.DwellTime = 500 * time.Millisecond
+		summary := job.Run(context.Background())
+
+		Expect(summary.Lifecycle.DwellTime).To(Equal(0.5))
+		Expect(summary.Lifecycle.Dwell.Count).To(Equal(3))
+		Expect(summary.Lifecycle.Dwell.P50).To(BeNumerically(">=", 0.5))
+		Expect(summary.Lifecycle.Total.Average).To(BeNumerically(">=", 0.5))
+	})
+
+	It("times every step", func() {
+		summary := job.Run(context.Background())
+
+		Expect(summary.Lifecycle.Create.Count).To(Equal(3))
+		Expect(summary.Lifecycle.Delete.Count).To(Equal(3))
+		Expect(summary.Lifecycle.Total.Count).To(Equal(3))
+		Expect(summary.Lifecycle.Write.Count).To(Equal(0))
+		Expect(summary.Lifecycle.Write.Average).To(Equal(float64(-1)))
+		Expect(summary.AverageTimePerImage).To(BeNumerically("~", summary.Lifecycle.Create.Average, 0.000001))
+	})
+
+	Context("when create fails", func() {
+		It("does not try to delete the image", func() {
+			freshRunner := fake_command_runner.New()
+			freshRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				return errors.New("exit status 1")
+			})
+			job.Runner = freshRunner
+
+			summary := job.Run(context.Background())
+			Expect(freshRunner.ExecutedCommands()).To(HaveLen(3))
+			Expect(summary.TotalErrorsAmt).To(Equal(3))
+			Expect(summary.Lifecycle.Create.Errors).To(Equal(3))
+			Expect(summary.Lifecycle.Total.Errors).To(Equal(3))
+			Expect(summary.Lifecycle.Delete.Count).To(Equal(0))
+			Expect(summary.ErrorMessages[0]).To(HavePrefix("lifecycle of image 1 failed: create: exit status 1"))
+		})
+	})
+
+	Context("when writing into the rootfs fails", func() {
+		It("still deletes the image and reports the failed step", func() {
+			job.WriteBytes = 10
+			freshRunner := fake_command_runner.New()
+			freshRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("/this/rootfs/does/not/exist\n"))
+				return nil
+			})
+			job.Runner = freshRunner
+
+			summary := job.Run(context.Background())
+			Expect(freshRunner.ExecutedCommands()).To(HaveLen(6))
+			Expect(summary.TotalErrorsAmt).To(Equal(3))
+			Expect(summary.Lifecycle.Write.Errors).To(Equal(3))
+			Expect(summary.Lifecycle.Delete.Count).To(Equal(3))
+			Expect(summary.ErrorMessages[0]).To(ContainSubstring("write: open /this/rootfs/does/not/exist/grootfs-bench-data"))
+		})
+	})
+
+	Context("when the context is done while the images dwell", func() {
+		It("deletes them without cycling the others", func() {
+			job.DwellTime = time.Minute
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			summary := job.Run(ctx)
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(summary.TotalImages).To(Equal(2))
+			Expect(summary.Lifecycle.Dwell.Errors).To(Equal(2))
+			Expect(summary.Lifecycle.Delete.Count).To(Equal(2))
+			Expect(summary.ErrorMessages[0]).To(ContainSubstring("dwell: context deadline exceeded"))
+		})
+	})
+})
@@ -0,0 +1,420 @@
+package bench
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats the matrix can be printed in
+const (
+	MatrixText = "text"
+	MatrixJSON = "json"
+	MatrixCSV  = "csv"
+)
+
+var MatrixFormats = []string{MatrixText, MatrixJSON, MatrixCSV}
+
+// maxMatrixShapes bounds the values of a range and the shapes of a matrix,
+// each shape being a run of its own
+const maxMatrixShapes = 1000
+
+// MatrixShape is the number of layers and total size of a base image
+type MatrixShape struct {
+	Layers    int
+	SizeBytes int64
+}
+
+// Tag is the tag of the generated image of the shape
+func (s MatrixShape) Tag() string {
+	return fmt.Sprintf("layers-%d-size-%s", s.Layers, FormatSize(s.SizeBytes))
+}
+
+// MatrixCell holds the results of the run with one shape
+type MatrixCell struct {
+	Layers              int     `json:"layers"`
+	SizeBytes           int64   `json:"size_bytes"`
+	BaseImage           string  `json:"base_image"`
+	ImagesPerSecond     float64 `json:"images_per_second"`
+	AverageTimePerImage float64 `json:"average_time_per_image"`
+	LatencyP50          float64 `json:"latency_p50"`
+	LatencyP95          float64 `json:"latency_p95"`
+	LatencyMax          float64 `json:"latency_max"`
+	TotalErrorsAmt      int     `json:"total_errors_amt"`
+	ErrorRate           float64 `json:"error_rate"`
+	// Error is why the run of the shape did not complete, empty when it did
+	Error string `json:"error"`
+}
+
+// Matrix benchmarks the creation of images from base images of every
+// combination of layer counts and sizes. The base images are generated in an
+// OCI image layout at FixturesPath, or selected from it when they are
+// already there.
+type Matrix struct {
+	FixturesPath         string
+	FilesPerLayer        int
+	FileSizeDistribution string
+	Seed                 int64
+
+	// NewBenchmark returns the benchmark of a base image
+	NewBenchmark func(baseImage string) (*Benchmark, error)
+}
+
+// MatrixShapes combines every layer count with every size
+func MatrixShapes(layerCounts []int64, sizes []int64) ([]MatrixShape, error) {
+	shapes := []MatrixShape{}
+	for _, layers := range layerCounts {
+		for _, size := range sizes {
+			if size < layers {
+				return nil, fmt.Errorf("an image of %d bytes cannot have %d layers", size, layers)
+			}
+			if len(shapes) == maxMatrixShapes {
+				return nil, fmt.Errorf("the matrix has more than %d shapes", maxMatrixShapes)
+			}
+			shapes = append(shapes, MatrixShape{Layers: int(layers), SizeBytes: size})
+		}
+	}
+
+	return shapes, nil
+}
+
+// ParseRange reads comma separated values and ranges, each value being read
+// with parse. A range <from>..<to> doubles from `from` up to `to`, unless it
+// steps by n with <from>..<to>+n or multiplies by n with <from>..<to>*n.
+func ParseRange(expression string, parse func(string) (int64, error)) ([]int64, error) {
+	values := []int64{}
+	seen := map[int64]bool{}
+	add := func(value int64) error {
+		if seen[value] {
+			return nil
+		}
+		if len(values) == maxMatrixShapes {
+			return fmt.Errorf("parsing range `%s`: more than %d values", expression, maxMatrixShapes)
+		}
+		seen[value] = true
+		values = append(values, value)
+		return nil
+	}
+
+	for _, part := range strings.Split(expression, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "..", 2)
+		from, err := parse(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing range `%s`: %s", expression, err)
+		}
+		if len(bounds) == 1 {
+			if err := add(from); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		to, next, err := parseRangeEnd(bounds[1], parse)
+		if err != nil {
+			return nil, fmt.Errorf("parsing range `%s`: %s", expression, err)
+		}
+		if to < from {
+			return nil, fmt.Errorf("parsing range `%s`: `%s` ends before it starts", expression, part)
+		}
+		for value := from; value <= to; value = next(value) {
+			if err := add(value); err != nil {
+				return nil, err
+			}
+			if next(value) <= value {
+				break
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// parseRangeEnd reads the end of a range and how it steps. The step returns
+// its value unchanged once the next one would overflow.
+func parseRangeEnd(end string, parse func(string) (int64, error)) (int64, func(int64) int64, error) {
+	var step string
+	factor := int64(2)
+	if i := strings.IndexAny(end, "+*"); i >= 0 {
+		end, step = end[:i], end[i:]
+	}
+
+	to, err := parse(end)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if strings.HasPrefix(step, "+") {
+		increment, err := parse(step[1:])
+		if err != nil {
+			return 0, nil, err
+		}
+		return to, func(value int64) int64 {
+			if value > math.MaxInt64-increment {
+				return value
+			}
+			return value + increment
+		}, nil
+	}
+
+	if strings.HasPrefix(step, "*") {
+		factor, err = strconv.ParseInt(step[1:], 10, 64)
+		if err != nil || factor < 2 {
+			return 0, nil, fmt.Errorf("invalid factor `%s`", step[1:])
+		}
+	}
+
+	return to, func(value int64) int64 {
+		if value > math.MaxInt64/factor {
+			return value
+		}
+		return value * factor
+	}, nil
+}
+
+// ParseCount reads a positive number, to use with ParseRange
+func ParseCount(count string) (int64, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(count), 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid count `%s`", count)
+	}
+
+	return value, nil
+}
+
+// Run benchmarks each shape in turn, stopping at the first base image that
+// cannot be generated or benchmarked, or once ctx is done. The cells of the
+// shapes benchmarked so far are returned either way, the one interrupted by
+// ctx included.
+func (m *Matrix) Run(ctx context.Context, shapes []MatrixShape) ([]MatrixCell, error) {
+	cells := []MatrixCell{}
+	for _, shape := range shapes {
+		if err := ctx.Err(); err != nil {
+			return cells, err
+		}
+
+		baseImage, err := m.BaseImage(shape)
+		if err != nil {
+			return cells, err
+		}
+
+		benchmark, err := m.NewBenchmark(baseImage)
+		if err != nil {
+			return cells, err
+		}
+		summary, err := benchmark.Run(ctx)
+		if err != nil && err != ctx.Err() {
+			return cells, err
+		}
+
+		failures := []string{}
+		if err != nil {
+			failures = append(failures, "interrupted")
+		}
+		if summary.Aborted != "" {
+			failures = append(failures, "aborted: "+summary.Aborted)
+		}
+		if summary.Store != nil {
+			for _, message := range summary.Store.ErrorMessages {
+				failures = append(failures, strings.TrimSpace(message))
+			}
+		}
+
+		cells = append(cells, MatrixCell{
+			Layers:              shape.Layers,
+			SizeBytes:           shape.SizeBytes,
+			BaseImage:           baseImage,
+			ImagesPerSecond:     summary.ImagesPerSecond,
+			AverageTimePerImage: summary.AverageTimePerImage,
+			LatencyP50:          summary.LatencyP50,
+			LatencyP95:          summary.LatencyP95,
+			LatencyMax:          summary.LatencyMax,
+			TotalErrorsAmt:      summary.TotalErrorsAmt,
+			ErrorRate:           summary.ErrorRate,
+			Error:               strings.Join(failures, "; "),
+		})
+		if err != nil {
+			return cells, err
+		}
+	}
+
+	return cells, nil
+}
+
+// BaseImage returns the base image of a shape, generating it unless the
+// fixtures already have it
+func (m *Matrix) BaseImage(shape MatrixShape) (string, error) {
+	fixturesPath, err := filepath.Abs(m.FixturesPath)
+	if err != nil {
+		return "", fmt.Errorf("resolving fixtures path: %s", err)
+	}
+
+	image := OCIImage{Path: fixturesPath, Tag: shape.Tag()}
+	if hasOCIImage(fixturesPath, image.Tag) {
+		return image.BaseImage(), nil
+	}
+
+	layerSize := shape.SizeBytes / int64(shape.Layers)
+	files := m.FilesPerLayer
+	if int64(files) > layerSize {
+		files = int(layerSize)
+	}
+
+	image, err = GenerateOCIImage(fixturesPath, OCIImageSpec{
+		Tag:                  image.Tag,
+		Layers:               shape.Layers,
+		LayerSizes:           []int64{layerSize},
+		FilesPerLayer:        files,
+		FileSizeDistribution: m.FileSizeDistribution,
+		Seed:                 m.Seed,
+	})
+	if err != nil {
+		return "", fmt.Errorf("generating image with %d layers of %s: %s", shape.Layers, FormatSize(layerSize), err)
+	}
+
+	return image.BaseImage(), nil
+}
+
+func hasOCIImage(imagePath, tag string) bool {
+	contents, err := ioutil.ReadFile(filepath.Join(imagePath, "index.json"))
+	if err != nil {
+		return false
+	}
+
+	var index ociIndex
+	if err := json.Unmarshal(contents, &index); err != nil {
+		return false
+	}
+
+	for _, manifest := range index.Manifests {
+		if manifest.Annotations[ociRefAnnotation] == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateMatrixFormat(format string) error {
+	for _, known := range MatrixFormats {
+		if format == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format `%s`, must be one of: %s", format, strings.Join(MatrixFormats, ", "))
+}
+
+// PrintMatrix prints the results of every shape. The text format follows
+// them with a grid of the images per second, a row per layer count and a
+// column per size.
+func PrintMatrix(out io.Writer, format string, cells []MatrixCell) error {
+	switch format {
+	case MatrixJSON:
+		return json.NewEncoder(out).Encode(cells)
+	case MatrixCSV:
+		return printMatrixCSV(out, cells)
+	case MatrixText:
+		return printMatrixText(out, cells)
+	}
+
+	return ValidateMatrixFormat(format)
+}
+
+func printMatrixCSV(out io.Writer, cells []MatrixCell) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"layers", "size_bytes", "base_image", "images_per_second", "average_time_per_image", "latency_p50", "latency_p95", "latency_max", "total_errors_amt", "error_rate", "error"})
+	for _, cell := range cells {
+		w.Write([]string{
+			strconv.Itoa(cell.Layers),
+			strconv.FormatInt(cell.SizeBytes, 10),
+			cell.BaseImage,
+			strconv.FormatFloat(cell.ImagesPerSecond, 'f', -1, 64),
+			strconv.FormatFloat(cell.AverageTimePerImage, 'f', -1, 64),
+			strconv.FormatFloat(cell.LatencyP50, 'f', -1, 64),
+			strconv.FormatFloat(cell.LatencyP95, 'f', -1, 64),
+			strconv.FormatFloat(cell.LatencyMax, 'f', -1, 64),
+			strconv.Itoa(cell.TotalErrorsAmt),
+			strconv.FormatFloat(cell.ErrorRate, 'f', -1, 64),
+			cell.Error,
+		})
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+func printMatrixText(out io.Writer, cells []MatrixCell) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LAYERS\tSIZE\tIMAGES/S\tAVG TIME\tP50\tP95\tMAX\tERROR RATE\tERROR")
+	for _, cell := range cells {
+		cellError := cell.Error
+		if cellError == "" {
+			cellError = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%.3f\t%.3fs\t%.3fs\t%.3fs\t%.3fs\t%.3f\t%s\n",
+			cell.Layers,
+			FormatSize(cell.SizeBytes),
+			cell.ImagesPerSecond,
+			cell.AverageTimePerImage,
+			cell.LatencyP50,
+			cell.LatencyP95,
+			cell.LatencyMax,
+			cell.ErrorRate,
+			cellError,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	layerCounts, sizes := []int{}, []int64{}
+	grid := map[int]map[int64]float64{}
+	for _, cell := range cells {
+		if _, ok := grid[cell.Layers]; !ok {
+			grid[cell.Layers] = map[int64]float64{}
+			layerCounts = append(layerCounts, cell.Layers)
+		}
+		if !containsSize(sizes, cell.SizeBytes) {
+			sizes = append(sizes, cell.SizeBytes)
+		}
+		grid[cell.Layers][cell.SizeBytes] = cell.ImagesPerSecond
+	}
+
+	fmt.Fprintln(out, "\nImages per second by layers (rows) and size (columns):")
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "LAYERS")
+	for _, size := range sizes {
+		fmt.Fprintf(w, "\t%s", FormatSize(size))
+	}
+	fmt.Fprintln(w)
+	for _, layers := range layerCounts {
+		fmt.Fprintf(w, "%d", layers)
+		for _, size := range sizes {
+			if imagesPerSecond, ok := grid[layers][size]; ok {
+				fmt.Fprintf(w, "\t%.3f", imagesPerSecond)
+			} else {
+				fmt.Fprint(w, "\t-")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+func containsSize(sizes []int64, size int64) bool {
+	for _, existing := range sizes {
+		if existing == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+package bench_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Matrix", func() {
+	DescribeTable("ParseRange",
+		func(expression string, expected ...int64) {
+			values, err := bench.ParseRange(expression, bench.ParseCount)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).To(Equal(expected))
+		},
+		Entry("a single value", "4", int64(4)),
+		Entry("a list", "1,4,16", int64(1), int64(4), int64(16)),
+		Entry("a doubling range", "1..16", int64(1), int64(2), int64(4), int64(8), int64(16)),
+		Entry("a stepping range", "1..10+3", int64(1), int64(4), int64(7), int64(10)),
+		Entry("a multiplying range", "1..64*4", int64(1), int64(4), int64(16), int64(64)),
+		Entry("ranges and values, without duplicates", "1..4, 4, 10", int64(1), int64(2), int64(4), int64(10)),
+		Entry("a doubling range ending past the last value", "4611686018427387904..9223372036854775807", int64(4611686018427387904)),
+		Entry("a stepping range ending past the last value", "9223372036854775800..9223372036854775807+5", int64(9223372036854775800), int64(9223372036854775805)),
+	)
+
+	It("parses ranges of sizes", func() {
+		values, err := bench.ParseRange("16M..64M+16M", bench.ParseSize)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values).To(Equal([]int64{16 << 20, 32 << 20, 48 << 20, 64 << 20}))
+	})
+
+	DescribeTable("invalid ranges",
+		func(expression, message string) {
+			_, err := bench.ParseRange(expression, bench.ParseCount)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("a bad value", "1,lots", "invalid count `lots`"),
+		Entry("a backwards range", "8..2", "`8..2` ends before it starts"),
+		Entry("a bad factor", "1..8*1", "invalid factor `1`"),
+		Entry("too many values", "1..2000+1", "more than 1000 values"),
+	)
+
+	Describe("MatrixShapes", func() {
+		It("combines every layer count with every size", func() {
+			shapes, err := bench.MatrixShapes([]int64{1, 4}, []int64{1024, 2048})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shapes).To(Equal([]bench.MatrixShape{
+				{Layers: 1, SizeBytes: 1024},
+				{Layers: 1, SizeBytes: 2048},
+				{Layers: 4, SizeBytes: 1024},
+				{Layers: 4, SizeBytes: 2048},
+			}))
+		})
+
+		It("rejects images smaller than their layer count", func() {
+			_, err := bench.MatrixShapes([]int64{16}, []int64{8})
+			Expect(err).To(MatchError("an image of 8 bytes cannot have 16 layers"))
+		})
+
+		It("rejects too many shapes", func() {
+			layerCounts, err := bench.ParseRange("1..100+1", bench.ParseCount)
+			Expect(err).NotTo(HaveOccurred())
+			sizes, err := bench.ParseRange("1000..1100+10", bench.ParseCount)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = bench.MatrixShapes(layerCounts, sizes)
+			Expect(err).To(MatchError("the matrix has more than 1000 shapes"))
+		})
+	})
+
+	Describe("Run", func() {
+		var (
+			fixturesPath  string
+			matrix        *bench.Matrix
+			fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		)
+
+		BeforeEach(func() {
+			var err error
+			fixturesPath, err = ioutil.TempDir("", "matrix")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeCmdRunner = fake_command_runner.New()
+			matrix = &bench.Matrix{
+				FixturesPath:         fixturesPath,
+				FilesPerLayer:        100,
+				FileSizeDistribution: bench.FileSizesEven,
+				NewBenchmark: func(baseImage string) (*bench.Benchmark, error) {
+					return bench.NewBenchmark(bench.Options{
+						GrootFSBinPath: "/path/to/grootfs",
+						StorePath:      "/store/path",
+						BaseImages:     []string{baseImage},
+						Images:         2,
+						Concurrency:    1,
+						SkipTeardown:   true,
+						Runner:         fakeCmdRunner,
+					})
+				},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(fixturesPath)).To(Succeed())
+		})
+
+		It("benchmarks an image of every shape", func() {
+			cells, err := matrix.Run(context.Background(), []bench.MatrixShape{{Layers: 1, SizeBytes: 1024}, {Layers: 2, SizeBytes: 4096}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cells).To(HaveLen(2))
+
+			Expect(cells[0].Layers).To(Equal(1))
+			Expect(cells[0].BaseImage).To(Equal("oci://" + fixturesPath + ":layers-1-size-1KiB"))
+			Expect(cells[1].BaseImage).To(Equal("oci://" + fixturesPath + ":layers-2-size-4KiB"))
+			Expect(cells[1].ImagesPerSecond).To(BeNumerically(">", 0))
+
+			baseImages := []string{}
+			for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+				if len(cmd.Args) > 3 && cmd.Args[len(cmd.Args)-3] == "create" {
+					baseImages = append(baseImages, cmd.Args[len(cmd.Args)-2])
+				}
+			}
+			Expect(baseImages).To(Equal([]string{cells[0].BaseImage, cells[0].BaseImage, cells[1].BaseImage, cells[1].BaseImage}))
+		})
+
+		It("fails when a shape cannot be benchmarked", func() {
+			matrix.NewBenchmark = func(baseImage string) (*bench.Benchmark, error) {
+				return bench.NewBenchmark(bench.Options{BaseImages: []string{baseImage}, Images: 2, CacheMode: "lukewarm"})
+			}
+
+			cells, err := matrix.Run(context.Background(), []bench.MatrixShape{{Layers: 1, SizeBytes: 1024}})
+			Expect(err).To(MatchError(ContainSubstring("lukewarm")))
+			Expect(cells).To(BeEmpty())
+		})
+
+		It("returns the shapes benchmarked before a failure", func() {
+			shapes := []bench.MatrixShape{{Layers: 1, SizeBytes: 1024}, {Layers: 2, SizeBytes: 1}}
+
+			cells, err := matrix.Run(context.Background(), shapes)
+			Expect(err).To(MatchError(ContainSubstring("generating image with 2 layers")))
+			Expect(cells).To(HaveLen(1))
+			Expect(cells[0].Layers).To(Equal(1))
+			Expect(cells[0].Error).To(BeEmpty())
+		})
+
+		It("reports the shapes whose run was aborted", func() {
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				return errors.New("grootfs failed")
+			})
+			matrix.NewBenchmark = func(baseImage string) (*bench.Benchmark, error) {
+				return bench.NewBenchmark(bench.Options{
+					GrootFSBinPath: "/path/to/grootfs",
+					StorePath:      "/store/path",
+					BaseImages:     []string{baseImage},
+					Images:         4,
+					Concurrency:    1,
+					SkipTeardown:   true,
+					AbortErrorRate: 50,
+					AbortMinImages: 2,
+					Runner:         fakeCmdRunner,
+				})
+			}
+
+			cells, err := matrix.Run(context.Background(), []bench.MatrixShape{{Layers: 1, SizeBytes: 1024}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cells).To(HaveLen(1))
+			Expect(cells[0].Error).To(HavePrefix("aborted: "))
+		})
+
+		It("returns the shape interrupted by the context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cancel()
+				return nil
+			})
+
+			cells, err := matrix.Run(ctx, []bench.MatrixShape{{Layers: 1, SizeBytes: 1024}, {Layers: 2, SizeBytes: 4096}})
+			Expect(err).To(Equal(context.Canceled))
+			Expect(cells).To(HaveLen(1))
+			Expect(cells[0].Error).To(Equal("interrupted"))
+		})
+
+		It("stops once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			cells, err := matrix.Run(ctx, []bench.MatrixShape{{Layers: 1, SizeBytes: 1024}})
+			Expect(err).To(Equal(context.Canceled))
+			Expect(cells).To(BeEmpty())
+			Expect(fakeCmdRunner.ExecutedCommands()).To(BeEmpty())
+		})
+
+		It("generates images of the shape", func() {
+			_, err := matrix.Run(context.Background(), []bench.MatrixShape{{Layers: 3, SizeBytes: 3 * 1024}})
+			Expect(err).NotTo(HaveOccurred())
+
+			var index struct{ Manifests []struct{ Digest string } }
+			contents, err := ioutil.ReadFile(filepath.Join(fixturesPath, "index.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(contents, &index)).To(Succeed())
+			Expect(index.Manifests).To(HaveLen(1))
+
+			var manifest struct{ Layers []struct{ Digest string } }
+			contents, err = ioutil.ReadFile(filepath.Join(fixturesPath, "blobs", "sha256", index.Manifests[0].Digest[len("sha256:"):]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(contents, &manifest)).To(Succeed())
+			Expect(manifest.Layers).To(HaveLen(3))
+		})
+
+		It("selects the images already in the fixtures", func() {
+			shape := bench.MatrixShape{Layers: 1, SizeBytes: 1024}
+			existing, err := bench.GenerateOCIImage(fixturesPath, bench.OCIImageSpec{
+				Tag:                  shape.Tag(),
+				Layers:               1,
+				LayerSizes:           []int64{10},
+				FilesPerLayer:        1,
+				FileSizeDistribution: bench.FileSizesEven,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = matrix.Run(context.Background(), []bench.MatrixShape{shape})
+			Expect(err).NotTo(HaveOccurred())
+
+			var index struct{ Manifests []struct{ Digest string } }
+			contents, err := ioutil.ReadFile(filepath.Join(fixturesPath, "index.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(contents, &index)).To(Succeed())
+			Expect(index.Manifests).To(HaveLen(1))
+			Expect(index.Manifests[0].Digest).To(Equal(existing.ManifestDigest))
+		})
+	})
+
+	Describe("PrintMatrix", func() {
+		var cells []bench.MatrixCell
+
+		BeforeEach(func() {
+			cells = []bench.MatrixCell{
+				{Layers: 1, SizeBytes: 1 << 20, BaseImage: "oci:///fixtures:a", ImagesPerSecond: 4, AverageTimePerImage: 0.25, LatencyP50: 0.2, LatencyP95: 0.3, LatencyMax: 0.4},
+				{Layers: 1, SizeBytes: 4 << 20, BaseImage: "oci:///fixtures:b", ImagesPerSecond: 2},
+				{Layers: 8, SizeBytes: 1 << 20, BaseImage: "oci:///fixtures:c", ImagesPerSecond: 1, TotalErrorsAmt: 1, ErrorRate: 50, Error: "interrupted"},
+			}
+		})
+
+		It("prints a row per shape and a grid of the throughputs", func() {
+			buffer := gbytes.NewBuffer()
+			Expect(bench.PrintMatrix(buffer, bench.MatrixText, cells)).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`LAYERS\s+SIZE\s+IMAGES/S\s+AVG TIME\s+P50\s+P95\s+MAX\s+ERROR RATE\s+ERROR`))
+			Expect(buffer).To(gbytes.Say(`1\s+1MiB\s+4\.000\s+0\.250s\s+0\.200s\s+0\.300s\s+0\.400s\s+0\.000\s+-\n`))
+			Expect(buffer).To(gbytes.Say(`8\s+1MiB\s+1\.000\s+.*50\.000\s+interrupted\n`))
+			Expect(buffer).To(gbytes.Say(`LAYERS\s+1MiB\s+4MiB\n`))
+			Expect(buffer).To(gbytes.Say(`1\s+4\.000\s+2\.000\n`))
+			Expect(buffer).To(gbytes.Say(`8\s+1\.000\s+-\n`))
+		})
+
+		It("prints csv", func() {
+			buffer := gbytes.NewBuffer()
+			Expect(bench.PrintMatrix(buffer, bench.MatrixCSV, cells[:1])).To(Succeed())
+			Expect(string(buffer.Contents())).To(Equal(
+				"layers,size_bytes,base_image,images_per_second,average_time_per_image,latency_p50,latency_p95,latency_max,total_errors_amt,error_rate,error\n" +
+					"1,1048576,oci:///fixtures:a,4,0.25,0.2,0.3,0.4,0,0,\n"))
+		})
+
+		It("prints json", func() {
+			buffer := gbytes.NewBuffer()
+			Expect(bench.PrintMatrix(buffer, bench.MatrixJSON, cells[:1])).To(Succeed())
+			Expect(buffer.Contents()).To(MatchJSON(`[{"layers":1,"size_bytes":1048576,"base_image":"oci:///fixtures:a","images_per_second":4,"average_time_per_image":0.25,"latency_p50":0.2,"latency_p95":0.3,"latency_max":0.4,"total_errors_amt":0,"error_rate":0,"error":""}]`))
+		})
+
+		It("rejects unknown formats", func() {
+			Expect(bench.PrintMatrix(gbytes.NewBuffer(), "yaml", cells)).To(MatchError("unknown format `yaml`, must be one of: text, json, csv"))
+		})
+	})
+})
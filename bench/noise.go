@@ -0,0 +1,323 @@
+package bench
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Kinds of background noise
+const (
+	NoiseDisk   = "disk"
+	NoiseCPU    = "cpu"
+	NoiseMemory = "memory"
+)
+
+var NoiseKinds = []string{NoiseDisk, NoiseCPU, NoiseMemory}
+
+// DefaultNoiseFileBytes is how large the disk writer's file grows before it
+// is rewritten from the start, so the noise does not fill the disk
+const DefaultNoiseFileBytes = 1 << 30
+
+const (
+	noiseChunkBytes = 1 << 20
+	noisePageBytes  = 4096
+	// noiseSlice is the period the cpu burner is busy for a share of
+	noiseSlice = 10 * time.Millisecond
+	// rusageThread asks getrusage for the usage of the calling thread
+	rusageThread = 1
+)
+
+// Noise loads the host while the jobs run, so their latency can be measured
+// under contention. The disk writer writes BytesPerSecond into a file in
+// Path, syncing it every SyncInterval; the cpu burner keeps CPUs busy; the
+// memory hog holds MemoryBytes resident.
+type Noise struct {
+	Kind string
+
+	Path           string
+	BytesPerSecond int64
+	SyncInterval   time.Duration
+	MaxFileBytes   int64
+
+	CPUs float64
+
+	MemoryBytes int64
+}
+
+// NoiseSummary compares the load a noise worker achieved to the one it was
+// asked for, in bytes per second for the disk writer, CPUs for the cpu burner
+// and bytes for the memory hog
+type NoiseSummary struct {
+	Kind     string  `json:"kind"`
+	Target   float64 `json:"target"`
+	Achieved float64 `json:"achieved"`
+	Duration float64 `json:"duration"`
+	Syncs    int     `json:"syncs"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func ValidateNoise(noise Noise) error {
+	switch noise.Kind {
+	case NoiseDisk:
+		if noise.BytesPerSecond <= 0 {
+			return fmt.Errorf("the disk noise rate must be positive")
+		}
+		if noise.Path == "" {
+			return fmt.Errorf("the disk noise needs a directory to write to")
+		}
+	case NoiseCPU:
+		if noise.CPUs <= 0 {
+			return fmt.Errorf("the cpu noise must burn a positive number of CPUs")
+		}
+	case NoiseMemory:
+		if noise.MemoryBytes <= 0 {
+			return fmt.Errorf("the memory noise must hold a positive number of bytes")
+		}
+	default:
+		return fmt.Errorf("unknown noise `%s`, must be one of: %s", noise.Kind, strings.Join(NoiseKinds, ", "))
+	}
+
+	return nil
+}
+
+// Run loads the host until done is closed
+func (n *Noise) Run(done chan bool) NoiseSummary {
+	switch n.Kind {
+	case NoiseDisk:
+		return n.writeDisk(done)
+	case NoiseCPU:
+		return n.burnCPU(done)
+	case NoiseMemory:
+		return n.hogMemory(done)
+	}
+
+	return NoiseSummary{Kind: n.Kind, Error: ValidateNoise(*n).Error()}
+}
+
+// writeDisk writes chunks into a file at the rate asked for, rewriting it
+// from the start when it reaches MaxFileBytes
+func (n *Noise) writeDisk(done chan bool) NoiseSummary {
+	summary := NoiseSummary{Kind: n.Kind, Target: float64(n.BytesPerSecond)}
+	start := time.Now()
+
+	dir, err := ioutil.TempDir(n.Path, "grootfs-bench-noise")
+	if err != nil {
+		summary.Error = fmt.Sprintf("creating disk noise directory: %s", err)
+		return summary
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := os.Create(filepath.Join(dir, "noise"))
+	if err != nil {
+		summary.Error = fmt.Sprintf("creating disk noise file: %s", err)
+		return summary
+	}
+	defer file.Close()
+
+	maxFileBytes := n.MaxFileBytes
+	if maxFileBytes <= 0 {
+		maxFileBytes = DefaultNoiseFileBytes
+	}
+
+	chunk := make([]byte, noiseChunkBytes)
+	for i := range chunk {
+		chunk[i] = byte(i)
+	}
+
+	var written, offset int64
+	lastSync := time.Now()
+	for {
+		select {
+		case <-done:
+			summary.Duration = time.Since(start).Seconds()
+			summary.Achieved = float64(written) / summary.Duration
+			return summary
+		default:
+		}
+
+		size := int64(len(chunk))
+		if size > n.BytesPerSecond {
+			size = n.BytesPerSecond
+		}
+		if offset+size > maxFileBytes {
+			offset = 0
+		}
+		if _, err := file.WriteAt(chunk[:size], offset); err != nil {
+			summary.Error = fmt.Sprintf("writing disk noise: %s", err)
+		}
+		written += size
+		offset += size
+
+		if n.SyncInterval > 0 && time.Since(lastSync) >= n.SyncInterval {
+			if err := file.Sync(); err != nil {
+				summary.Error = fmt.Sprintf("syncing disk noise: %s", err)
+			}
+			summary.Syncs++
+			lastSync = time.Now()
+		}
+		if summary.Error != "" {
+			summary.Duration = time.Since(start).Seconds()
+			summary.Achieved = float64(written) / summary.Duration
+			return summary
+		}
+
+		// sleep until the bytes written are due, waking up to stop
+		due := start.Add(time.Duration(float64(written) / float64(n.BytesPerSecond) * float64(time.Second)))
+		select {
+		case <-done:
+		case <-time.After(time.Until(due)):
+		}
+	}
+}
+
+// burnCPU keeps a thread per CPU asked for busy for the share of every slice
+// the CPUs add up to. The load achieved is the CPU time the threads got.
+func (n *Noise) burnCPU(done chan bool) NoiseSummary {
+	summary := NoiseSummary{Kind: n.Kind, Target: n.CPUs}
+	start := time.Now()
+
+	threads := int(math.Ceil(n.CPUs))
+	busy := time.Duration(float64(noiseSlice) * n.CPUs / float64(threads))
+
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		cpuTime time.Duration
+	)
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			// the thread may have run other goroutines before
+			before := threadCPUTime()
+			for {
+				select {
+				case <-done:
+					mutex.Lock()
+					cpuTime += threadCPUTime() - before
+					mutex.Unlock()
+					return
+				default:
+				}
+
+				sliceStart := time.Now()
+				for time.Since(sliceStart) < busy {
+				}
+				if idle := noiseSlice - time.Since(sliceStart); idle > 0 {
+					time.Sleep(idle)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	summary.Duration = time.Since(start).Seconds()
+	summary.Achieved = cpuTime.Seconds() / summary.Duration
+	return summary
+}
+
+func threadCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &usage); err != nil {
+		return 0
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// hogMemory allocates the bytes asked for and touches every page of them
+// every second, so they stay resident. The load achieved is how much the
+// resident memory of the process grew, as pages may be swapped out or
+// reclaimed under pressure.
+func (n *Noise) hogMemory(done chan bool) NoiseSummary {
+	summary := NoiseSummary{Kind: n.Kind, Target: float64(n.MemoryBytes)}
+	start := time.Now()
+
+	resident := residentBytes()
+	memory := make([]byte, n.MemoryBytes)
+	for {
+		for i := 0; i < len(memory); i += noisePageBytes {
+			memory[i]++
+		}
+		summary.Achieved = math.Min(math.Max(float64(residentBytes()-resident), 0), summary.Target)
+
+		select {
+		case <-done:
+			summary.Duration = time.Since(start).Seconds()
+			return summary
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// residentBytes is the resident memory of the process, from /proc
+func residentBytes() int64 {
+	for _, fields := range readFields("/proc/self/status") {
+		if fields[0] == "VmRSS:" && len(fields) == 3 {
+			kilobytes, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kilobytes * 1024
+		}
+	}
+
+	return 0
+}
+
+// runNoise starts the noise workers, returning a function stopping them and
+// returning their summaries
+func runNoise(noises []*Noise) func() []NoiseSummary {
+	if len(noises) == 0 {
+		return func() []NoiseSummary { return nil }
+	}
+
+	done := make(chan bool)
+	summaries := make([]NoiseSummary, len(noises))
+
+	var wg sync.WaitGroup
+	wg.Add(len(noises))
+	for i, noise := range noises {
+		go func(i int, noise *Noise) {
+			defer wg.Done()
+			summaries[i] = noise.Run(done)
+		}(i, noise)
+	}
+
+	return func() []NoiseSummary {
+		close(done)
+		wg.Wait()
+		return summaries
+	}
+}
+
+func formatNoise(summary NoiseSummary) string {
+	switch summary.Kind {
+	case NoiseDisk:
+		return fmt.Sprintf("%s/s written of %s/s, %d syncs", formatBytes(summary.Achieved), formatBytes(summary.Target), summary.Syncs)
+	case NoiseCPU:
+		return fmt.Sprintf("%.2f CPUs burnt of %.2f", summary.Achieved, summary.Target)
+	default:
+		return fmt.Sprintf("%s held of %s", formatBytes(summary.Achieved), formatBytes(summary.Target))
+	}
+}
+
+// formatBytes rounds bytes to the largest unit they fill, unlike FormatSize
+func formatBytes(bytes float64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if bytes >= float64(sizeUnits[unit]) {
+			return fmt.Sprintf("%.1f%siB", bytes/float64(sizeUnits[unit]), unit)
+		}
+	}
+
+	return fmt.Sprintf("%.0fB", bytes)
+}
@@ -0,0 +1,137 @@
+package bench_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Noise", func() {
+	runFor := func(noise *bench.Noise, duration time.Duration) bench.NoiseSummary {
+		done := make(chan bool)
+		go func() {
+			time.Sleep(duration)
+			close(done)
+		}()
+		return noise.Run(done)
+	}
+
+	Describe("ValidateNoise", func() {
+		It("accepts noise with a load", func() {
+			Expect(bench.ValidateNoise(bench.Noise{Kind: bench.NoiseDisk, Path: "/tmp", BytesPerSecond: 1024})).To(Succeed())
+			Expect(bench.ValidateNoise(bench.Noise{Kind: bench.NoiseCPU, CPUs: 0.5})).To(Succeed())
+			Expect(bench.ValidateNoise(bench.Noise{Kind: bench.NoiseMemory, MemoryBytes: 1024})).To(Succeed())
+		})
+
+		It("rejects noise without a load", func() {
+			Expect(bench.ValidateNoise(bench.Noise{Kind: bench.NoiseDisk, Path: "/tmp"})).To(MatchError("the disk noise rate must be positive"))
+			Expect(bench.ValidateNoise(bench.Noise{Kind: bench.NoiseCPU})).To(MatchError("the cpu noise must burn a positive number of CPUs"))
+			Expect(bench.ValidateNoise(bench.Noise{Kind: bench.NoiseMemory})).To(MatchError("the memory noise must hold a positive number of bytes"))
+		})
+
+		It("rejects unknown noise", func() {
+			Expect(bench.ValidateNoise(bench.Noise{Kind: "network"})).To(MatchError("unknown noise `network`, must be one of: disk, cpu, memory"))
+		})
+	})
+
+	Describe("disk", func() {
+		var path string
+
+		BeforeEach(func() {
+			var err error
+			path, err = ioutil.TempDir("", "noise")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(path)).To(Succeed())
+		})
+
+		It("writes at the rate asked for", func() {
+			summary := runFor(&bench.Noise{Kind: bench.NoiseDisk, Path: path, BytesPerSecond: 4 << 20}, 500*time.Millisecond)
+
+			Expect(summary.Error).To(BeEmpty())
+			Expect(summary.Target).To(Equal(float64(4 << 20)))
+			Expect(summary.Achieved).To(BeNumerically("~", 4<<20, 2<<20))
+			Expect(summary.Syncs).To(Equal(0))
+		})
+
+		It("syncs the writes", func() {
+			summary := runFor(&bench.Noise{Kind: bench.NoiseDisk, Path: path, BytesPerSecond: 64 << 20, SyncInterval: 10 * time.Millisecond}, 200*time.Millisecond)
+			Expect(summary.Syncs).To(BeNumerically(">", 0))
+		})
+
+		It("rewrites its file instead of filling the disk", func() {
+			runFor(&bench.Noise{Kind: bench.NoiseDisk, Path: path, BytesPerSecond: 64 << 20, MaxFileBytes: 2 << 20}, 200*time.Millisecond)
+			Expect(ioutil.ReadDir(path)).To(BeEmpty())
+		})
+
+		It("reports when it cannot write", func() {
+			summary := runFor(&bench.Noise{Kind: bench.NoiseDisk, Path: "/does/not/exist", BytesPerSecond: 1024}, 0)
+			Expect(summary.Error).To(ContainSubstring("creating disk noise directory"))
+		})
+	})
+
+	Describe("cpu", func() {
+		It("burns the CPU asked for", func() {
+			summary := runFor(&bench.Noise{Kind: bench.NoiseCPU, CPUs: 0.5}, 500*time.Millisecond)
+
+			Expect(summary.Target).To(Equal(0.5))
+			Expect(summary.Achieved).To(BeNumerically(">", 0.1))
+			Expect(summary.Achieved).To(BeNumerically("<", 1))
+			Expect(summary.Duration).To(BeNumerically("~", 0.5, 0.1))
+		})
+	})
+
+	Describe("memory", func() {
+		It("holds the memory asked for", func() {
+			summary := runFor(&bench.Noise{Kind: bench.NoiseMemory, MemoryBytes: 64 << 20}, 100*time.Millisecond)
+
+			Expect(summary.Target).To(Equal(float64(64 << 20)))
+			Expect(summary.Achieved).To(BeNumerically(">", 32<<20))
+			Expect(summary.Achieved).To(BeNumerically("<=", 64<<20))
+		})
+	})
+
+	Describe("running with jobs", func() {
+		It("loads the host until the jobs are done", func() {
+			job := createJob()
+			job.TotalImages = 2
+			executor := &bench.JobExecutor{
+				Jobs:  []*bench.Job{job},
+				Noise: []*bench.Noise{{Kind: bench.NoiseCPU, CPUs: 1}, {Kind: bench.NoiseMemory, MemoryBytes: 1 << 20}},
+			}
+
+			summary := executor.Run(context.Background())
+			Expect(summary.Noise).To(HaveLen(2))
+			Expect(summary.Noise[0].Kind).To(Equal(bench.NoiseCPU))
+			Expect(summary.Noise[1].Kind).To(Equal(bench.NoiseMemory))
+
+			buffer := gbytes.NewBuffer()
+			Expect(bench.NewTextPrinter(buffer, gbytes.NewBuffer()).Print(summary)).To(Succeed())
+			Expect(buffer).To(gbytes.Say(`Noise cpu\.*: \d+\.\d{2} CPUs burnt of 1\.00`))
+			Expect(buffer).To(gbytes.Say(`Noise memory\.*: .*B held of 1\.0MiB`))
+		})
+
+		It("does not report noise it was not asked for", func() {
+			job := createJob()
+			job.TotalImages = 1
+			Expect((&bench.JobExecutor{Jobs: []*bench.Job{job}}).Run(context.Background()).Noise).To(BeNil())
+		})
+	})
+
+	It("prints the disk noise and its errors", func() {
+		summary := bench.Summary{Noise: []bench.NoiseSummary{{Kind: bench.NoiseDisk, Target: 20 << 20, Achieved: 19.5 * (1 << 20), Syncs: 4, Error: "o noes"}}}
+		out, errOut := gbytes.NewBuffer(), gbytes.NewBuffer()
+		Expect(bench.NewTextPrinter(out, errOut).Print(summary)).To(Succeed())
+
+		Expect(out).To(gbytes.Say(`Noise disk\.*: 19\.5MiB/s written of 20\.0MiB/s, 4 syncs`))
+		Expect(errOut).To(gbytes.Say("disk noise failed: o noes"))
+	})
+})
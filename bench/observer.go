@@ -0,0 +1,126 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultAbortMinImages is how many images ErrorRateAbort waits for before
+// judging the error rate, so a first failure does not abort the run
+const DefaultAbortMinImages = 10
+
+// Observer is told about the grootfs commands of the jobs as they start and
+// complete: the images created or cycled and the runs of the repeated
+// commands. The teardown and the cache preparation are not observed.
+// Observers of an executor are never called concurrently.
+type Observer interface {
+	CommandStarted(event CommandEvent)
+	CommandCompleted(event CommandEvent, result Result)
+}
+
+// CommandEvent is a command of a job. Args are the ones grootfs is given,
+// those of the create in lifecycle mode.
+type CommandEvent struct {
+	Command   Command
+	Args      []string
+	StartedAt time.Time
+}
+
+// ErrorRateAbort cancels the run once more than MaxErrorRate percent of the
+// images failed, counting from MinImages images (default:
+// DefaultAbortMinImages)
+type ErrorRateAbort struct {
+	MaxErrorRate float64
+	MinImages    int
+	Cancel       context.CancelFunc
+
+	images  int
+	errors  int
+	aborted bool
+}
+
+func (a *ErrorRateAbort) CommandStarted(event CommandEvent) {}
+
+func (a *ErrorRateAbort) CommandCompleted(event CommandEvent, result Result) {
+	if !event.Command.CreatesImages() {
+		return
+	}
+
+	a.images++
+	if result.Err != nil {
+		a.errors++
+	}
+
+	minImages := a.MinImages
+	if minImages == 0 {
+		minImages = DefaultAbortMinImages
+	}
+	if !a.aborted && a.images >= minImages && a.errorRate() > a.MaxErrorRate {
+		a.aborted = true
+		a.Cancel()
+	}
+}
+
+// Aborted tells whether the run was cancelled, once it is done
+func (a *ErrorRateAbort) Aborted() bool {
+	return a.aborted
+}
+
+func (a *ErrorRateAbort) String() string {
+	return fmt.Sprintf("error rate %.2f%% over %.2f%% after %d images", a.errorRate(), a.MaxErrorRate, a.images)
+}
+
+func (a *ErrorRateAbort) errorRate() float64 {
+	if a.images == 0 {
+		return 0
+	}
+
+	return float64(a.errors*100) / float64(a.images)
+}
+
+// LogObserver writes a line to Out for every command started and completed,
+// with passwords redacted
+type LogObserver struct {
+	Out io.Writer
+}
+
+func (l *LogObserver) CommandStarted(event CommandEvent) {
+	fmt.Fprintf(l.Out, "%s %s started: %s\n", event.StartedAt.Format(time.RFC3339Nano), event.Command, strings.Join(RedactArgs(event.Args), " "))
+}
+
+func (l *LogObserver) CommandCompleted(event CommandEvent, result Result) {
+	now := time.Now().Format(time.RFC3339Nano)
+	if result.Err != nil {
+		fmt.Fprintf(l.Out, "%s %s failed after %.3fs: %s\n", now, event.Command, result.Duration.Seconds(), strings.TrimSpace(result.Err.Error()))
+		return
+	}
+
+	fmt.Fprintf(l.Out, "%s %s completed in %.3fs\n", now, event.Command, result.Duration.Seconds())
+}
+
+// observeStart tells the observers a command of the job started, returning
+// the event to complete
+func (j *Job) observeStart(args []string, startedAt time.Time) CommandEvent {
+	event := CommandEvent{Command: j.Command, Args: append([]string{}, args...), StartedAt: startedAt}
+	j.notify(func(observer Observer) { observer.CommandStarted(event) })
+	return event
+}
+
+func (j *Job) observeCompletion(event CommandEvent, result Result) {
+	j.notify(func(observer Observer) { observer.CommandCompleted(event, result) })
+}
+
+func (j *Job) notify(fn func(Observer)) {
+	if len(j.observers) == 0 {
+		return
+	}
+
+	j.observerMutex.Lock()
+	defer j.observerMutex.Unlock()
+	for _, observer := range j.observers {
+		fn(observer)
+	}
+}
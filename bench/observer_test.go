@@ -0,0 +1,174 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type recordingObserver struct {
+	started   []bench.CommandEvent
+	completed []bench.CommandEvent
+	results   []bench.Result
+	inFlight  int
+}
+
+func (o *recordingObserver) CommandStarted(event bench.CommandEvent) {
+	o.started = append(o.started, event)
+	o.inFlight++
+}
+
+func (o *recordingObserver) CommandCompleted(event bench.CommandEvent, result bench.Result) {
+	o.completed = append(o.completed, event)
+	o.results = append(o.results, result)
+	o.inFlight--
+}
+
+var _ = Describe("Observers", func() {
+	var observer *recordingObserver
+
+	BeforeEach(func() {
+		observer = &recordingObserver{}
+	})
+
+	It("is told about every image as it is created", func() {
+		job := createJob()
+		job.TotalImages = 3
+		job.Concurrency = 3
+		summary := (&bench.JobExecutor{Jobs: []*bench.Job{job}, Observers: []bench.Observer{observer}}).Run(context.Background())
+
+		Expect(observer.started).To(HaveLen(3))
+		Expect(observer.completed).To(ConsistOf(observer.started))
+		Expect(observer.results).To(ConsistOf(summary.Results))
+		Expect(observer.started[0].Command).To(Equal(bench.CommandCreate))
+		Expect(observer.started[0].Args).To(ContainElement("docker:///busybox"))
+		Expect(observer.started[0].StartedAt).NotTo(BeZero())
+		Expect(observer.inFlight).To(BeZero())
+	})
+
+	It("is told about the lifecycles and the repeated commands", func() {
+		lifecycle := createJob()
+		lifecycle.Command = bench.CommandLifecycle
+		lifecycle.TotalImages = 2
+		listRunner := fake_command_runner.New()
+		listed := make(chan bool)
+		listRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			close(listed)
+			return errors.New("o noes")
+		})
+		lifecycleRunner := fake_command_runner.New()
+		lifecycleRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			<-listed
+			return nil
+		})
+		lifecycle.Runner = lifecycleRunner
+		list := genericJob()
+		list.Command = bench.CommandList
+		list.Runner = listRunner
+		list.Interval = 60
+
+		(&bench.JobExecutor{Jobs: []*bench.Job{lifecycle, list}, Observers: []bench.Observer{observer}}).Run(context.Background())
+
+		commands := map[bench.Command]int{}
+		for i, event := range observer.completed {
+			commands[event.Command]++
+			if event.Command == bench.CommandList {
+				Expect(observer.results[i].Err).To(MatchError(HavePrefix("o noes")))
+			} else {
+				Expect(event.Args).To(ContainElement("create"))
+			}
+		}
+		Expect(commands).To(Equal(map[bench.Command]int{bench.CommandLifecycle: 2, bench.CommandList: 1}))
+	})
+
+	Describe("ErrorRateAbort", func() {
+		var (
+			abort     *bench.ErrorRateAbort
+			cancelled int
+		)
+
+		BeforeEach(func() {
+			cancelled = 0
+			abort = &bench.ErrorRateAbort{MaxErrorRate: 20, MinImages: 4, Cancel: func() { cancelled++ }}
+		})
+
+		complete := func(command bench.Command, err error) {
+			abort.CommandCompleted(bench.CommandEvent{Command: command}, bench.Result{Err: err})
+		}
+
+		It("waits for the minimum number of images", func() {
+			for i := 0; i < 3; i++ {
+				complete(bench.CommandCreate, errors.New("o noes"))
+			}
+			Expect(abort.Aborted()).To(BeFalse())
+
+			complete(bench.CommandCreate, nil)
+			Expect(abort.Aborted()).To(BeTrue())
+			Expect(cancelled).To(Equal(1))
+			Expect(abort.String()).To(Equal("error rate 75.00% over 20.00% after 4 images"))
+		})
+
+		It("does not abort under the rate", func() {
+			for i := 0; i < 9; i++ {
+				complete(bench.CommandLifecycle, nil)
+			}
+			complete(bench.CommandLifecycle, errors.New("o noes"))
+			Expect(abort.Aborted()).To(BeFalse())
+		})
+
+		It("cancels once", func() {
+			for i := 0; i < 6; i++ {
+				complete(bench.CommandCreate, errors.New("o noes"))
+			}
+			Expect(cancelled).To(Equal(1))
+		})
+
+		It("ignores the repeated commands", func() {
+			for i := 0; i < 6; i++ {
+				complete(bench.CommandClean, errors.New("o noes"))
+			}
+			Expect(abort.Aborted()).To(BeFalse())
+		})
+
+		It("stops the run", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			abort.Cancel = cancel
+			abort.MinImages = 2
+
+			job := createJob()
+			job.TotalImages = 20
+			fakeCmdRunner := fake_command_runner.New()
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				return errors.New("o noes")
+			})
+			job.Runner = fakeCmdRunner
+
+			summary := (&bench.JobExecutor{Jobs: []*bench.Job{job}, Observers: []bench.Observer{abort}}).Run(ctx)
+			Expect(summary.TotalImages).To(Equal(2))
+		})
+	})
+
+	Describe("LogObserver", func() {
+		It("logs the commands, with passwords redacted", func() {
+			buffer := gbytes.NewBuffer()
+			logger := &bench.LogObserver{Out: buffer}
+			event := bench.CommandEvent{Command: bench.CommandCreate, Args: []string{"create", "--password=secret", "docker:///busybox", "image"}, StartedAt: time.Now()}
+
+			logger.CommandStarted(event)
+			logger.CommandCompleted(event, bench.Result{Duration: 1500 * time.Millisecond})
+			logger.CommandCompleted(event, bench.Result{Duration: time.Second, Err: errors.New("exit status 1, o noes\n")})
+
+			Expect(buffer).To(gbytes.Say(`\S+ create started: create --password=<redacted> docker:///busybox image\n`))
+			Expect(buffer).To(gbytes.Say(`\S+ create completed in 1\.500s\n`))
+			Expect(buffer).To(gbytes.Say(`\S+ create failed after 1\.000s: exit status 1, o noes\n`))
+		})
+	})
+})
@@ -0,0 +1,458 @@
+package bench
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File size distributions of the generated layers, deciding how the size of
+// a layer is split between its files
+const (
+	FileSizesEven        = "even"
+	FileSizesUniform     = "uniform"
+	FileSizesExponential = "exponential"
+)
+
+// FileSizeDistributions lists the distributions accepted by
+// ValidateOCIImageSpec
+var FileSizeDistributions = []string{FileSizesEven, FileSizesUniform, FileSizesExponential}
+
+const (
+	ociLayoutVersion  = "1.0.0"
+	ociManifestType   = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigType     = "application/vnd.oci.image.config.v1+json"
+	ociLayerType      = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociRefAnnotation  = "org.opencontainers.image.ref.name"
+	ociWhiteoutPrefix = ".wh."
+
+	// files are spread over directories of this many files
+	filesPerDir = 100
+)
+
+// generatedAt is the time of every file and history entry, keeping the
+// digests reproducible
+var generatedAt = time.Unix(0, 0).UTC()
+
+// OCIImageSpec describes a synthetic image. Layer sizes are used in turn, so
+// a single size applies to every layer. Every layer but the first has
+// Whiteouts files of the previous layer removed.
+type OCIImageSpec struct {
+	Tag                  string
+	Layers               int
+	LayerSizes           []int64
+	FilesPerLayer        int
+	FileSizeDistribution string
+	Hardlinks            int
+	Symlinks             int
+	Whiteouts            int
+	Seed                 int64
+}
+
+// OCIImage describes an image written by GenerateOCIImage
+type OCIImage struct {
+	Path           string
+	Tag            string
+	ManifestDigest string
+	Layers         []OCILayer
+}
+
+// OCILayer describes a generated layer. Size is the size of its uncompressed
+// files.
+type OCILayer struct {
+	Digest string
+	DiffID string
+	Size   int64
+	Files  int
+}
+
+// BaseImage is the grootfs base image of the image
+func (i OCIImage) BaseImage() string {
+	return "oci://" + i.Path + ":" + i.Tag
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociConfig struct {
+	Created      time.Time    `json:"created"`
+	Architecture string       `json:"architecture"`
+	OS           string       `json:"os"`
+	Config       struct{}     `json:"config"`
+	RootFS       ociRootFS    `json:"rootfs"`
+	History      []ociHistory `json:"history"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociHistory struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+}
+
+func ValidateOCIImageSpec(spec OCIImageSpec) error {
+	if spec.Tag == "" || strings.ContainsAny(spec.Tag, "/:") {
+		return fmt.Errorf("invalid tag `%s`", spec.Tag)
+	}
+
+	if spec.Layers <= 0 {
+		return fmt.Errorf("the image must have at least one layer")
+	}
+
+	if len(spec.LayerSizes) == 0 {
+		return fmt.Errorf("at least one layer size is required")
+	}
+
+	if spec.FilesPerLayer <= 0 {
+		return fmt.Errorf("every layer must have at least one file")
+	}
+
+	for _, size := range spec.LayerSizes {
+		if size < int64(spec.FilesPerLayer) {
+			return fmt.Errorf("layer size %d is smaller than the %d files of the layer", size, spec.FilesPerLayer)
+		}
+	}
+
+	if spec.Hardlinks < 0 || spec.Symlinks < 0 || spec.Whiteouts < 0 {
+		return fmt.Errorf("the number of hardlinks, symlinks and whiteouts cannot be negative")
+	}
+
+	if spec.Whiteouts > spec.FilesPerLayer {
+		return fmt.Errorf("cannot whiteout %d files of layers with %d files", spec.Whiteouts, spec.FilesPerLayer)
+	}
+
+	for _, distribution := range FileSizeDistributions {
+		if spec.FileSizeDistribution == distribution {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown file size distribution `%s`, must be one of: %s", spec.FileSizeDistribution, strings.Join(FileSizeDistributions, ", "))
+}
+
+// GenerateOCIImage writes a synthetic image as an OCI image layout at
+// imagePath, adding it to the layout already there if any. The contents are
+// random but only depend on the spec, so the same spec always gives the same
+// digests.
+func GenerateOCIImage(imagePath string, spec OCIImageSpec) (OCIImage, error) {
+	if err := ValidateOCIImageSpec(spec); err != nil {
+		return OCIImage{}, err
+	}
+
+	imagePath, err := filepath.Abs(imagePath)
+	if err != nil {
+		return OCIImage{}, fmt.Errorf("resolving image path: %s", err)
+	}
+
+	blobsPath := filepath.Join(imagePath, "blobs", "sha256")
+	if err := os.MkdirAll(blobsPath, 0755); err != nil {
+		return OCIImage{}, fmt.Errorf("creating image layout: %s", err)
+	}
+
+	image := OCIImage{Path: imagePath, Tag: spec.Tag}
+	random := rand.New(rand.NewSource(spec.Seed))
+	config := ociConfig{
+		Created:      generatedAt,
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ociRootFS{Type: "layers", DiffIDs: []string{}},
+		History:      []ociHistory{},
+	}
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestType, Layers: []ociDescriptor{}}
+
+	for n := 0; n < spec.Layers; n++ {
+		layer, descriptor, err := writeOCILayer(blobsPath, spec, n, random)
+		if err != nil {
+			return OCIImage{}, fmt.Errorf("writing layer %d: %s", n, err)
+		}
+
+		image.Layers = append(image.Layers, layer)
+		manifest.Layers = append(manifest.Layers, descriptor)
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, layer.DiffID)
+		config.History = append(config.History, ociHistory{
+			Created:   generatedAt,
+			CreatedBy: fmt.Sprintf("grootfs-bench generate-image: layer %d, %d files, %d bytes", n, layer.Files, layer.Size),
+		})
+	}
+
+	manifest.Config, err = writeOCIBlob(blobsPath, ociConfigType, config)
+	if err != nil {
+		return OCIImage{}, fmt.Errorf("writing config: %s", err)
+	}
+
+	manifestDescriptor, err := writeOCIBlob(blobsPath, ociManifestType, manifest)
+	if err != nil {
+		return OCIImage{}, fmt.Errorf("writing manifest: %s", err)
+	}
+	manifestDescriptor.Annotations = map[string]string{ociRefAnnotation: spec.Tag}
+	image.ManifestDigest = manifestDescriptor.Digest
+
+	if err := writeOCIIndex(imagePath, manifestDescriptor); err != nil {
+		return OCIImage{}, err
+	}
+
+	return image, nil
+}
+
+// writeOCIIndex points the tag of the manifest to it in the index of the
+// layout, keeping the other tags
+func writeOCIIndex(imagePath string, manifest ociDescriptor) error {
+	index := ociIndex{SchemaVersion: 2}
+	indexPath := filepath.Join(imagePath, "index.json")
+
+	contents, err := ioutil.ReadFile(indexPath)
+	if err == nil {
+		if err := json.Unmarshal(contents, &index); err != nil {
+			return fmt.Errorf("reading index: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("reading index: %s", err)
+	}
+
+	manifests := []ociDescriptor{}
+	for _, existing := range index.Manifests {
+		if existing.Annotations[ociRefAnnotation] != manifest.Annotations[ociRefAnnotation] {
+			manifests = append(manifests, existing)
+		}
+	}
+	index.Manifests = append(manifests, manifest)
+
+	if err := writeJSONFile(indexPath, index); err != nil {
+		return fmt.Errorf("writing index: %s", err)
+	}
+
+	layout := map[string]string{"imageLayoutVersion": ociLayoutVersion}
+	if err := writeJSONFile(filepath.Join(imagePath, "oci-layout"), layout); err != nil {
+		return fmt.Errorf("writing oci-layout: %s", err)
+	}
+
+	return nil
+}
+
+func writeJSONFile(filePath string, value interface{}) error {
+	contents, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filePath, contents, 0644)
+}
+
+func writeOCIBlob(blobsPath, mediaType string, value interface{}) (ociDescriptor, error) {
+	contents, err := json.Marshal(value)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	descriptor := ociDescriptor{
+		MediaType: mediaType,
+		Digest:    digestOf(contents),
+		Size:      int64(len(contents)),
+	}
+
+	return descriptor, ioutil.WriteFile(filepath.Join(blobsPath, strings.TrimPrefix(descriptor.Digest, "sha256:")), contents, 0644)
+}
+
+func digestOf(contents []byte) string {
+	digest := sha256.Sum256(contents)
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
+
+// writeOCILayer writes the gzipped tar of a layer to a blob named after its
+// digest
+func writeOCILayer(blobsPath string, spec OCIImageSpec, n int, random *rand.Rand) (OCILayer, ociDescriptor, error) {
+	blob, err := ioutil.TempFile(blobsPath, "layer")
+	if err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+	defer os.Remove(blob.Name())
+	defer blob.Close()
+
+	compressedHash := sha256.New()
+	compressed := &countingWriter{Writer: io.MultiWriter(blob, compressedHash)}
+	zipper, err := gzip.NewWriterLevel(compressed, gzip.BestSpeed)
+	if err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+	diffIDHash := sha256.New()
+	tarball := tar.NewWriter(io.MultiWriter(zipper, diffIDHash))
+
+	layer, err := writeLayerFiles(tarball, spec, n, random)
+	if err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+	if err := tarball.Close(); err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+	if err := zipper.Close(); err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+	if err := blob.Close(); err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+
+	digest := hex.EncodeToString(compressedHash.Sum(nil))
+	if err := os.Rename(blob.Name(), filepath.Join(blobsPath, digest)); err != nil {
+		return OCILayer{}, ociDescriptor{}, err
+	}
+
+	layer.Digest = "sha256:" + digest
+	layer.DiffID = "sha256:" + hex.EncodeToString(diffIDHash.Sum(nil))
+	return layer, ociDescriptor{MediaType: ociLayerType, Digest: layer.Digest, Size: compressed.count}, nil
+}
+
+// writeLayerFiles writes the whiteouts, files, hardlinks and symlinks of the
+// nth layer
+func writeLayerFiles(tarball *tar.Writer, spec OCIImageSpec, n int, random *rand.Rand) (OCILayer, error) {
+	layer := OCILayer{}
+	layerDir := fmt.Sprintf("layer%d", n)
+	dirs := map[string]bool{}
+
+	addEntry := func(header *tar.Header) error {
+		header.ModTime = generatedAt
+		return tarball.WriteHeader(header)
+	}
+
+	// parent directories are written before their contents
+	addDirs := func(name string) error {
+		parents := []string{}
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			dirs[dir] = true
+			if err := addEntry(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if n > 0 {
+		previousDir := fmt.Sprintf("layer%d", n-1)
+		for i := 0; i < spec.Whiteouts; i++ {
+			name := path.Join(path.Dir(layerFileName(previousDir, i)), ociWhiteoutPrefix+path.Base(layerFileName(previousDir, i)))
+			if err := addDirs(name); err != nil {
+				return layer, err
+			}
+			if err := addEntry(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+				return layer, err
+			}
+		}
+	}
+
+	sizes := fileSizes(spec.LayerSizes[n%len(spec.LayerSizes)], spec.FilesPerLayer, spec.FileSizeDistribution, random)
+	for i, size := range sizes {
+		name := layerFileName(layerDir, i)
+		if err := addDirs(name); err != nil {
+			return layer, err
+		}
+		if err := addEntry(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: size}); err != nil {
+			return layer, err
+		}
+		if _, err := io.CopyN(tarball, random, size); err != nil {
+			return layer, err
+		}
+		layer.Size += size
+		layer.Files++
+	}
+
+	for i := 0; i < spec.Hardlinks; i++ {
+		name := path.Join(layerDir, "links", fmt.Sprintf("hardlink%d", i))
+		if err := addDirs(name); err != nil {
+			return layer, err
+		}
+		target := layerFileName(layerDir, i%spec.FilesPerLayer)
+		if err := addEntry(&tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0644}); err != nil {
+			return layer, err
+		}
+	}
+
+	for i := 0; i < spec.Symlinks; i++ {
+		name := path.Join(layerDir, "links", fmt.Sprintf("symlink%d", i))
+		if err := addDirs(name); err != nil {
+			return layer, err
+		}
+		target := "/" + layerFileName(layerDir, i%spec.FilesPerLayer)
+		if err := addEntry(&tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}); err != nil {
+			return layer, err
+		}
+	}
+
+	return layer, nil
+}
+
+func layerFileName(layerDir string, i int) string {
+	return path.Join(layerDir, fmt.Sprintf("dir%d", i/filesPerDir), fmt.Sprintf("file%d", i))
+}
+
+// fileSizes splits total bytes between files following a distribution, each
+// file getting at least one byte
+func fileSizes(total int64, files int, distribution string, random *rand.Rand) []int64 {
+	weights := make([]float64, files)
+	sum := 0.0
+	for i := range weights {
+		switch distribution {
+		case FileSizesUniform:
+			weights[i] = random.Float64()
+		case FileSizesExponential:
+			weights[i] = random.ExpFloat64()
+		default:
+			weights[i] = 1
+		}
+		sum += weights[i]
+	}
+
+	sizes := make([]int64, files)
+	spare := total - int64(files)
+	assigned := int64(0)
+	for i, weight := range weights {
+		sizes[i] = 1 + int64(float64(spare)*weight/sum)
+		assigned += sizes[i]
+	}
+	// the rounding leftovers go to the first file
+	sizes[0] += total - assigned
+
+	return sizes
+}
+
+type countingWriter struct {
+	io.Writer
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,237 @@
+package bench_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OCI image", func() {
+	var (
+		imagePath string
+		spec      bench.OCIImageSpec
+	)
+
+	BeforeEach(func() {
+		tmpDir, err := ioutil.TempDir("", "oci-image")
+		Expect(err).NotTo(HaveOccurred())
+		imagePath = filepath.Join(tmpDir, "image")
+
+		spec = bench.OCIImageSpec{
+			Tag:                  "latest",
+			Layers:               2,
+			LayerSizes:           []int64{4096},
+			FilesPerLayer:        150,
+			FileSizeDistribution: bench.FileSizesEven,
+			Seed:                 42,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(filepath.Dir(imagePath))).To(Succeed())
+	})
+
+	readJSON := func(path string, value interface{}) {
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(contents, value)).To(Succeed())
+	}
+
+	blobPath := func(digest string) string {
+		return filepath.Join(imagePath, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+	}
+
+	// layerEntries reads the tar of a layer, checking its diff id
+	layerEntries := func(layer bench.OCILayer) []*tar.Header {
+		blob, err := os.Open(blobPath(layer.Digest))
+		Expect(err).NotTo(HaveOccurred())
+		defer blob.Close()
+
+		unzipped, err := gzip.NewReader(blob)
+		Expect(err).NotTo(HaveOccurred())
+		diffID := sha256.New()
+		tarball := tar.NewReader(io.TeeReader(unzipped, diffID))
+
+		headers := []*tar.Header{}
+		for {
+			header, err := tarball.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			headers = append(headers, header)
+		}
+		_, err = io.Copy(ioutil.Discard, unzipped)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect("sha256:" + hex.EncodeToString(diffID.Sum(nil))).To(Equal(layer.DiffID))
+		return headers
+	}
+
+	regularFiles := func(headers []*tar.Header) []*tar.Header {
+		files := []*tar.Header{}
+		for _, header := range headers {
+			if header.Typeflag == tar.TypeReg && !strings.HasPrefix(filepath.Base(header.Name), ".wh.") {
+				files = append(files, header)
+			}
+		}
+		return files
+	}
+
+	It("writes an OCI image layout", func() {
+		image, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(image.BaseImage()).To(Equal("oci://" + imagePath + ":latest"))
+
+		var layout map[string]string
+		readJSON(filepath.Join(imagePath, "oci-layout"), &layout)
+		Expect(layout["imageLayoutVersion"]).To(Equal("1.0.0"))
+
+		var index struct {
+			Manifests []struct {
+				Digest      string
+				Annotations map[string]string
+			}
+		}
+		readJSON(filepath.Join(imagePath, "index.json"), &index)
+		Expect(index.Manifests).To(HaveLen(1))
+		Expect(index.Manifests[0].Digest).To(Equal(image.ManifestDigest))
+		Expect(index.Manifests[0].Annotations["org.opencontainers.image.ref.name"]).To(Equal("latest"))
+
+		var manifest struct {
+			Config struct{ Digest string }
+			Layers []struct {
+				MediaType string
+				Digest    string
+				Size      int64
+			}
+		}
+		readJSON(blobPath(image.ManifestDigest), &manifest)
+		Expect(manifest.Layers).To(HaveLen(2))
+
+		var config struct {
+			RootFS struct {
+				DiffIDs []string `json:"diff_ids"`
+			}
+		}
+		readJSON(blobPath(manifest.Config.Digest), &config)
+
+		for n, layer := range image.Layers {
+			Expect(manifest.Layers[n].Digest).To(Equal(layer.Digest))
+			Expect(manifest.Layers[n].MediaType).To(Equal("application/vnd.oci.image.layer.v1.tar+gzip"))
+			Expect(config.RootFS.DiffIDs[n]).To(Equal(layer.DiffID))
+
+			info, err := os.Stat(blobPath(layer.Digest))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(Equal(manifest.Layers[n].Size))
+		}
+	})
+
+	It("fills every layer with files adding up to its size", func() {
+		spec.LayerSizes = []int64{4096, 8192}
+		spec.FileSizeDistribution = bench.FileSizesExponential
+		image, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+
+		for n, size := range []int64{4096, 8192} {
+			files := regularFiles(layerEntries(image.Layers[n]))
+			Expect(files).To(HaveLen(150))
+
+			total := int64(0)
+			for _, file := range files {
+				Expect(file.Size).To(BeNumerically(">", 0))
+				total += file.Size
+			}
+			Expect(total).To(Equal(size))
+			Expect(image.Layers[n].Size).To(Equal(size))
+			Expect(image.Layers[n].Files).To(Equal(150))
+		}
+	})
+
+	It("adds hardlinks, symlinks and whiteouts", func() {
+		spec.Hardlinks = 2
+		spec.Symlinks = 3
+		spec.Whiteouts = 4
+		image, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+
+		firstLayer := map[string]bool{}
+		for _, header := range layerEntries(image.Layers[0]) {
+			firstLayer[header.Name] = true
+			Expect(header.Name).NotTo(ContainSubstring(".wh."))
+		}
+
+		hardlinks, symlinks, whiteouts := 0, 0, 0
+		for _, header := range layerEntries(image.Layers[1]) {
+			switch {
+			case header.Typeflag == tar.TypeLink:
+				hardlinks++
+			case header.Typeflag == tar.TypeSymlink:
+				symlinks++
+			case strings.HasPrefix(filepath.Base(header.Name), ".wh."):
+				whiteouts++
+				deleted := filepath.Join(filepath.Dir(header.Name), strings.TrimPrefix(filepath.Base(header.Name), ".wh."))
+				Expect(firstLayer).To(HaveKey(deleted))
+			}
+		}
+		Expect([]int{hardlinks, symlinks, whiteouts}).To(Equal([]int{2, 3, 4}))
+	})
+
+	It("generates the same image from the same seed", func() {
+		first, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+
+		spec.Seed = 43
+		third, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third.ManifestDigest).NotTo(Equal(first.ManifestDigest))
+	})
+
+	It("keeps the other tags of the layout", func() {
+		_, err := bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+		spec.Tag = "small"
+		spec.Layers = 1
+		_, err = bench.GenerateOCIImage(imagePath, spec)
+		Expect(err).NotTo(HaveOccurred())
+
+		var index struct {
+			Manifests []struct{ Annotations map[string]string }
+		}
+		readJSON(filepath.Join(imagePath, "index.json"), &index)
+		Expect(index.Manifests).To(HaveLen(2))
+		Expect(index.Manifests[0].Annotations["org.opencontainers.image.ref.name"]).To(Equal("latest"))
+		Expect(index.Manifests[1].Annotations["org.opencontainers.image.ref.name"]).To(Equal("small"))
+	})
+
+	Describe("ValidateOCIImageSpec", func() {
+		It("rejects unknown file size distributions", func() {
+			spec.FileSizeDistribution = "normal"
+			Expect(bench.ValidateOCIImageSpec(spec)).To(MatchError("unknown file size distribution `normal`, must be one of: even, uniform, exponential"))
+		})
+
+		It("rejects layers too small for their files", func() {
+			spec.LayerSizes = []int64{100}
+			Expect(bench.ValidateOCIImageSpec(spec)).To(MatchError("layer size 100 is smaller than the 150 files of the layer"))
+		})
+
+		It("rejects more whiteouts than files", func() {
+			spec.Whiteouts = 151
+			Expect(bench.ValidateOCIImageSpec(spec)).To(MatchError("cannot whiteout 151 files of layers with 150 files"))
+		})
+	})
+})
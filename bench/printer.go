@@ -1,16 +1,42 @@
 package bench
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Printer interface {
 	Print(summary Summary) error
 }
 
+// Formats lists the output formats accepted by NewPrinter
+var Formats = []string{"text", "json", "csv", "markdown", "html", "junit"}
+
+func NewPrinter(format string, slos []SLO, out, err io.Writer) (Printer, error) {
+	switch format {
+	case "text":
+		return NewTextPrinter(out, err), nil
+	case "json":
+		return NewJsonPrinter(out, err), nil
+	case "csv":
+		return NewCSVPrinter(out, err), nil
+	case "markdown":
+		return NewMarkdownPrinter(out, err), nil
+	case "html":
+		return NewHTMLPrinter(out, err), nil
+	case "junit":
+		return NewJUnitPrinter(out, err, slos), nil
+	default:
+		return nil, fmt.Errorf("unknown format `%s`, must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
 func NewTextPrinter(out, err io.Writer) *TextPrinter {
 	return &TextPrinter{out: out, err: err}
 }
@@ -27,17 +53,52 @@ func (p *TextPrinter) Print(summary Summary) error {
 Total images requested: {{.TotalImages}}
 Concurrency factor....: {{.ConcurrencyFactor}}
 Using quota?..........: {{.RanWithQuota}}
+Rootless?.............: {{.RanRootless}}
 Parallel clean?.......: {{.RanWithParallelClean}}
 Number of cleans......: {{.NumberOfCleans}}
 Number of deletes.....: {{.NumberOfDeletes}}
-.......................
+{{with .DeleteStrategy}}Delete strategy.......: {{.}}
+{{end}}{{with .Cache}}Cache mode............: {{.Mode}}
+Cache preparation.....: {{template "stats" .Prepare}}
+{{end}}{{with .Registry}}Registry requests.....: {{.Requests}} ({{.InjectedErrors}} injected errors, {{.BytesServed}} bytes served)
+{{end}}{{with .Cgroup}}Cgroup limits.........: {{cgroupLimits .Limits}} (cgroup v{{.Version}})
+{{end}}.......................
 Total duration........: {{.TotalDuration}}
 Images per second.....: {{printf "%.3f" .ImagesPerSecond}}
 Average time per image: {{printf "%.3f" .AverageTimePerImage}}s
+Latency p50/p95/p99...: {{printf "%.3f" .LatencyP50}}s / {{printf "%.3f" .LatencyP95}}s / {{printf "%.3f" .LatencyP99}}s
 Total errors..........: {{.TotalErrorsAmt}}
+Invalid rootfs........: {{.InvalidRootFSAmt}}
 Error Rate............: {{printf "%.3f" .ErrorRate}}
-`
-	tmpl, err := template.New("groot").Parse(tmplText)
+{{with .Aborted}}Aborted...............: {{.}}
+{{end}}{{with .Lifecycle}}.......................
+Lifecycle create......: {{template "stats" .Create}}
+Lifecycle write.......: {{template "stats" .Write}}
+Lifecycle dwell.......: {{template "stats" .Dwell}}
+Lifecycle delete......: {{template "stats" .Delete}}
+Lifecycle total.......: {{template "stats" .Total}}
+{{end}}{{with .Teardown}}.......................
+Teardown delete.......: {{template "stats" .Delete}}
+{{if .Clean}}Teardown clean........: {{printf "%.3f" .CleanDuration}}s
+{{end}}Teardown duration.....: {{printf "%.3f" .Duration}}s
+{{end}}{{if .Quotas}}.......................
+{{end}}{{range .Quotas}}{{label (printf "Quota %s" (size .SizeBytes))}}: {{template "stats" .Latency}}
+{{end}}{{if .BaseImages}}.......................
+{{end}}{{range .BaseImages}}{{label (printf "Image %s" .BaseImage)}}: {{.Images}} images ({{percent .Share}}), {{template "stats" .Latency}}
+{{end}}{{if .Commands}}.......................
+{{end}}{{range .Commands}}{{label (printf "%s" .Command)}}: {{template "stats" .Latency}}
+{{end}}{{with .Cgroup}}.......................
+Cgroup CPU usage......: {{printf "%.3f" .CPUUsage}}s ({{.ThrottledPeriods}} throttled periods, {{printf "%.3f" .ThrottledTime}}s throttled)
+Cgroup memory peak....: {{size .MemoryPeakBytes}}
+Cgroup IO.............: {{size .IOReadBytes}} read, {{size .IOWriteBytes}} written
+{{end}}{{if .Noise}}.......................
+{{end}}{{range .Noise}}{{label (printf "Noise %s" .Kind)}}: {{noise .}}
+{{end}}{{with .Store}}.......................
+{{if .Initialized}}Init store............: {{printf "%.3f" .InitDuration}}s
+{{end}}{{if .Deleted}}Delete store..........: {{printf "%.3f" .DeleteDuration}}s
+{{end}}{{end}}
+{{- define "stats"}}avg {{printf "%.3f" .Average}}s, p95 {{printf "%.3f" .P95}}s, max {{printf "%.3f" .Max}}s, errors {{.Errors}}{{end}}`
+	tmpl, err := template.New("groot").Funcs(template.FuncMap{"label": textLabel, "size": FormatSize, "percent": formatPercent, "cgroupLimits": formatCgroupLimits, "noise": formatNoise}).Parse(tmplText)
 	if err != nil {
 		return err
 	}
@@ -60,10 +121,181 @@ func (j *JsonPrinter) Print(summary Summary) error {
 	return json.NewEncoder(j.out).Encode(summary)
 }
 
+// summaryColumns is the schema of the tabular printers. Columns must never be
+// renamed, removed or reordered: new ones go at the end, so spreadsheets built
+// from older results keep lining up.
+var summaryColumns = []struct {
+	name  string
+	value func(Summary) string
+}{
+	{"total_images", func(s Summary) string { return strconv.Itoa(s.TotalImages) }},
+	{"concurrency_factor", func(s Summary) string { return strconv.Itoa(s.ConcurrencyFactor) }},
+	{"ran_with_quota", func(s Summary) string { return strconv.FormatBool(s.RanWithQuota) }},
+	{"ran_with_parallel_clean", func(s Summary) string { return strconv.FormatBool(s.RanWithParallelClean) }},
+	{"number_of_cleans", func(s Summary) string { return strconv.Itoa(s.NumberOfCleans) }},
+	{"number_of_deletes", func(s Summary) string { return strconv.Itoa(s.NumberOfDeletes) }},
+	{"total_duration_seconds", func(s Summary) string { return formatFloat(s.TotalDuration.Seconds()) }},
+	{"images_per_second", func(s Summary) string { return formatFloat(s.ImagesPerSecond) }},
+	{"average_time_per_image", func(s Summary) string { return formatFloat(s.AverageTimePerImage) }},
+	{"total_errors_amt", func(s Summary) string { return strconv.Itoa(s.TotalErrorsAmt) }},
+	{"error_rate", func(s Summary) string { return formatFloat(s.ErrorRate) }},
+	{"latency_p50", func(s Summary) string { return formatFloat(s.LatencyP50) }},
+	{"latency_p90", func(s Summary) string { return formatFloat(s.LatencyP90) }},
+	{"latency_p95", func(s Summary) string { return formatFloat(s.LatencyP95) }},
+	{"latency_p99", func(s Summary) string { return formatFloat(s.LatencyP99) }},
+	{"latency_max", func(s Summary) string { return formatFloat(s.LatencyMax) }},
+	{"run_id", func(s Summary) string { return s.RunInfo.ID }},
+	{"started_at", func(s Summary) string { return formatTime(s.RunInfo.StartedAt) }},
+	{"driver", func(s Summary) string { return s.RunInfo.Config.Driver }},
+	{"grootfs_version", func(s Summary) string { return s.RunInfo.GrootFSVersion }},
+	{"kernel_version", func(s Summary) string { return s.RunInfo.Environment.KernelVersion }},
+	{"invalid_rootfs_amt", func(s Summary) string { return strconv.Itoa(s.InvalidRootFSAmt) }},
+	{"delete_strategy", func(s Summary) string { return s.DeleteStrategy }},
+	{"ran_rootless", func(s Summary) string { return strconv.FormatBool(s.RanRootless) }},
+	{"cache_mode", func(s Summary) string {
+		if s.Cache == nil {
+			return ""
+		}
+		return s.Cache.Mode
+	}},
+	{"cache_prepare_count", func(s Summary) string {
+		return cachePrepare(s, func(stats LatencyStats) string { return strconv.Itoa(stats.Count) })
+	}},
+	{"cache_prepare_average", func(s Summary) string {
+		return cachePrepare(s, func(stats LatencyStats) string { return formatFloat(stats.Average) })
+	}},
+	{"cache_prepare_p95", func(s Summary) string {
+		return cachePrepare(s, func(stats LatencyStats) string { return formatFloat(stats.P95) })
+	}},
+}
+
+// cachePrepare formats the stats of the cache preparation, empty when the
+// run left the cache alone
+func cachePrepare(s Summary, value func(LatencyStats) string) string {
+	if s.Cache == nil {
+		return ""
+	}
+
+	return value(s.Cache.Prepare)
+}
+
+// textLabel pads a label with dots to line it up with the others of the text
+// printer
+func textLabel(label string) string {
+	for len(label) < 22 {
+		label += "."
+	}
+
+	return label
+}
+
+func formatPercent(fraction float64) string {
+	return strconv.FormatFloat(fraction*100, 'f', 1, 64) + "%"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func summaryRow(summary Summary) (header, row []string) {
+	for _, column := range summaryColumns {
+		header = append(header, column.name)
+		row = append(row, column.value(summary))
+	}
+
+	return header, row
+}
+
+func NewCSVPrinter(out, err io.Writer) *CSVPrinter {
+	return &CSVPrinter{out: out, err: err}
+}
+
+type CSVPrinter struct {
+	out io.Writer
+	err io.Writer
+}
+
+func (p *CSVPrinter) Print(summary Summary) error {
+	printErrors(summary, p.err)
+
+	header, row := summaryRow(summary)
+	w := csv.NewWriter(p.out)
+	if err := w.WriteAll([][]string{header, row}); err != nil {
+		return err
+	}
+
+	return w.Error()
+}
+
+func NewMarkdownPrinter(out, err io.Writer) *MarkdownPrinter {
+	return &MarkdownPrinter{out: out, err: err}
+}
+
+type MarkdownPrinter struct {
+	out io.Writer
+	err io.Writer
+}
+
+func (p *MarkdownPrinter) Print(summary Summary) error {
+	printErrors(summary, p.err)
+
+	header, row := summaryRow(summary)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+
+	for _, line := range [][]string{header, separator, row} {
+		if _, err := fmt.Fprintf(p.out, "| %s |\n", strings.Join(line, " | ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func printErrors(summary Summary, buffer io.Writer) {
 	if len(summary.ErrorMessages) > 0 {
 		for _, message := range summary.ErrorMessages {
-			fmt.Fprintf(buffer, message)
+			fmt.Fprint(buffer, message)
+		}
+	}
+
+	if summary.Teardown != nil {
+		for _, message := range summary.Teardown.ErrorMessages {
+			fmt.Fprint(buffer, message)
+		}
+	}
+
+	if summary.Cache != nil {
+		for _, message := range summary.Cache.ErrorMessages {
+			fmt.Fprint(buffer, message)
+		}
+	}
+
+	if summary.Store != nil {
+		for _, message := range summary.Store.ErrorMessages {
+			fmt.Fprint(buffer, message)
+		}
+	}
+
+	if summary.Cgroup != nil {
+		for _, message := range summary.Cgroup.ErrorMessages {
+			fmt.Fprint(buffer, message)
+		}
+	}
+
+	for _, noise := range summary.Noise {
+		if noise.Error != "" {
+			fmt.Fprintf(buffer, "%s noise failed: %s\n", noise.Kind, noise.Error)
 		}
 	}
 }
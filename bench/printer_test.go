@@ -17,15 +17,30 @@ var _ = Describe("Printer", func() {
 			TotalDuration:        time.Millisecond,
 			ImagesPerSecond:      0.88,
 			RanWithQuota:         true,
+			RanRootless:          true,
 			RanWithParallelClean: true,
 			NumberOfCleans:       5,
 			NumberOfDeletes:      7,
+			DeleteStrategy:       "lifo",
 			AverageTimePerImage:  2,
+			LatencyP50:           1.5,
+			LatencyP90:           2.5,
+			LatencyP95:           3.5,
+			LatencyP99:           4.5,
+			LatencyMax:           5.5,
 			TotalErrorsAmt:       3,
+			InvalidRootFSAmt:     2,
 			ErrorRate:            4,
 			TotalImages:          5,
 			ConcurrencyFactor:    6,
 			ErrorMessages:        []string{"o noes"},
+			RunInfo: bench.RunInfo{
+				ID:             "1234",
+				StartedAt:      time.Date(2017, 4, 24, 14, 20, 0, 0, time.UTC),
+				GrootFSVersion: "0.16.0",
+				Config:         bench.RunConfig{Driver: "btrfs"},
+				Environment:    bench.Environment{KernelVersion: "4.4.0"},
+			},
 		}
 	})
 
@@ -41,16 +56,32 @@ var _ = Describe("Printer", func() {
 				Expect(outBuffer).Should(gbytes.Say(`Total images requested\.*: 5`))
 				Expect(outBuffer).Should(gbytes.Say(`Concurrency factor\.*: 6`))
 				Expect(outBuffer).Should(gbytes.Say(`Using quota\?\.*: true`))
+				Expect(outBuffer).Should(gbytes.Say(`Rootless\?\.*: true`))
 				Expect(outBuffer).Should(gbytes.Say(`Parallel clean\?\.*: true`))
 				Expect(outBuffer).Should(gbytes.Say(`Number of cleans\.*: 5`))
 				Expect(outBuffer).Should(gbytes.Say(`Number of deletes\.*: 7`))
+				Expect(outBuffer).Should(gbytes.Say(`Delete strategy\.*: lifo`))
 				Expect(outBuffer).Should(gbytes.Say(`Total duration\.*: 1ms`))
 				Expect(outBuffer).Should(gbytes.Say(`Images per second\.*: 0.880`))
 				Expect(outBuffer).Should(gbytes.Say(`Average time per image\.*: 2.000s`))
+				Expect(outBuffer).Should(gbytes.Say(`Latency p50/p95/p99\.*: 1.500s / 3.500s / 4.500s`))
 				Expect(outBuffer).Should(gbytes.Say(`Total errors\.*: 3`))
+				Expect(outBuffer).Should(gbytes.Say(`Invalid rootfs\.*: 2`))
 				Expect(outBuffer).Should(gbytes.Say(`Error Rate\.*: 4.000`))
 			})
 
+			It("prints the repeated commands", func() {
+				outBuffer := gbytes.NewBuffer()
+				summary.Commands = []bench.CommandSummary{
+					{Command: "stats", Latency: bench.LatencyStats{Count: 2, Average: 0.5, P95: 0.75, Max: 1}},
+				}
+
+				printer := bench.NewTextPrinter(outBuffer, gbytes.NewBuffer())
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(outBuffer).Should(gbytes.Say(`\nstats\.{17}: avg 0\.500s, p95 0\.750s, max 1\.000s, errors 0`))
+			})
+
 			It("prints the error messages if something went wrong", func() {
 				outBuffer := gbytes.NewBuffer()
 				errBuffer := gbytes.NewBuffer()
@@ -60,6 +91,20 @@ var _ = Describe("Printer", func() {
 
 				Expect(errBuffer).Should(gbytes.Say("o noes"))
 			})
+
+			It("prints the teardown, cache and store errors as they are", func() {
+				summary.Teardown = &bench.TeardownSummary{ErrorMessages: []string{"could not delete image-1: 100% full\n"}}
+				summary.Cache = &bench.CacheSummary{ErrorMessages: []string{"could not clean: 100% full\n"}}
+				summary.Store = &bench.StoreSummary{ErrorMessages: []string{"could not delete the store: 100% full\n"}}
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewTextPrinter(gbytes.NewBuffer(), errBuffer)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(errBuffer).Should(gbytes.Say(`could not delete image-1: 100% full\n`))
+				Expect(errBuffer).Should(gbytes.Say(`could not clean: 100% full\n`))
+				Expect(errBuffer).Should(gbytes.Say(`could not delete the store: 100% full\n`))
+			})
 		})
 	})
 
@@ -72,7 +117,7 @@ var _ = Describe("Printer", func() {
 				printer := bench.NewJsonPrinter(outBuffer, errBuffer)
 				Expect(printer.Print(summary)).To(Succeed())
 
-				Expect(outBuffer.Contents()).To(MatchJSON(`{"total_duration":1000000,"images_per_second":0.88,"ran_with_quota":true,"ran_with_parallel_clean":true,"number_of_cleans":5,"number_of_deletes":7,"average_time_per_image":2,"total_errors_amt":3,"error_rate":4,"total_images":5,"concurrency_factor":6}`))
+				Expect(outBuffer.Contents()).To(MatchJSON(`{"schema_version":1,"total_duration":0.001,"images_per_second":0.88,"ran_with_quota":true,"ran_rootless":true,"ran_with_parallel_clean":true,"number_of_cleans":5,"number_of_deletes":7,"delete_strategy":"lifo","average_time_per_image":2,"latency_p50":1.5,"latency_p90":2.5,"latency_p95":3.5,"latency_p99":4.5,"latency_max":5.5,"total_errors_amt":3,"invalid_rootfs_amt":2,"error_rate":4,"total_images":5,"concurrency_factor":6,"error_messages":["o noes"],"run_info":{"id":"1234","started_at":"2017-04-24T14:20:00Z","finished_at":"0001-01-01T00:00:00Z","grootfs_version":"0.16.0","config":{"grootfs_bin_path":"","store_path":"","driver":"btrfs","log_level":"","metrics_enabled":false,"base_images":null,"base_image_weights":null,"base_image_distribution":"","base_image_seed":0,"zipf_exponent":0,"total_images":0,"concurrency":0,"use_quota":false,"quota_sizes":null,"quota_seed":0,"exclude_image_from_quota":false,"rootless":false,"cache_mode":"","drop_caches":false,"uid":0,"gid":0,"uid_mappings":null,"gid_mappings":null,"lifecycle":false,"write_bytes":0,"dwell_time":0,"verify_rootfs":false,"expected_files":null,"parallel_clean":false,"clean_interval":0,"delete_interval":0,"delete_strategy":"","delete_seed":0,"keep_live":0,"teardown":false,"teardown_clean":false,"init_store":false,"store_size_bytes":0,"delete_store":false,"grootfs_args":null,"command_args":null,"parallel_commands":null,"parallel_command_interval":0,"registry":"","registry_latency":0,"registry_bandwidth_bytes":0,"registry_error_rate":0,"registry_seed":0,"cgroup":false,"cgroup_root":"","cgroup_cpus":0,"cgroup_memory_bytes":0,"cgroup_io_device":"","cgroup_io_read_bps":0,"cgroup_io_write_bps":0,"noise_disk_path":"","noise_disk_bytes_per_second":0,"noise_disk_sync_interval":0,"noise_cpus":0,"noise_memory_bytes":0,"abort_error_rate":0,"abort_min_images":0,"slos":null,"format":""},"environment":{"hostname":"","os":"","arch":"","kernel_version":"4.4.0","num_cpu":0,"memory_bytes":0},"store":{"mount_point":"","filesystem_type":"","mount_options":""}}}`))
 			})
 
 			It("prints the error messages in plain text", func() {
@@ -86,4 +131,131 @@ var _ = Describe("Printer", func() {
 			})
 		})
 	})
+
+	Describe("CSVPrinter", func() {
+		Describe("Print", func() {
+			It("prints a header and the summary as a csv row", func() {
+				outBuffer := gbytes.NewBuffer()
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewCSVPrinter(outBuffer, errBuffer)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(string(outBuffer.Contents())).To(Equal(
+					"total_images,concurrency_factor,ran_with_quota,ran_with_parallel_clean,number_of_cleans,number_of_deletes,total_duration_seconds,images_per_second,average_time_per_image,total_errors_amt,error_rate,latency_p50,latency_p90,latency_p95,latency_p99,latency_max,run_id,started_at,driver,grootfs_version,kernel_version,invalid_rootfs_amt,delete_strategy,ran_rootless,cache_mode,cache_prepare_count,cache_prepare_average,cache_prepare_p95\n" +
+						"5,6,true,true,5,7,0.001,0.880,2.000,3,4.000,1.500,2.500,3.500,4.500,5.500,1234,2017-04-24T14:20:00Z,btrfs,0.16.0,4.4.0,2,lifo,true,,,,\n",
+				))
+			})
+
+			It("prints how the cache was prepared", func() {
+				summary.Cache = &bench.CacheSummary{Mode: bench.CacheWarm, Prepare: bench.LatencyStats{Count: 2, Average: 1.25, P95: 1.5}}
+				outBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewCSVPrinter(outBuffer, gbytes.NewBuffer())
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(string(outBuffer.Contents())).To(HaveSuffix(",warm,2,1.250,1.500\n"))
+			})
+
+			It("prints the error messages in plain text", func() {
+				outBuffer := gbytes.NewBuffer()
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewCSVPrinter(outBuffer, errBuffer)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(errBuffer).Should(gbytes.Say("o noes"))
+			})
+		})
+	})
+
+	Describe("MarkdownPrinter", func() {
+		Describe("Print", func() {
+			It("prints the summary as a markdown table", func() {
+				outBuffer := gbytes.NewBuffer()
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewMarkdownPrinter(outBuffer, errBuffer)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(string(outBuffer.Contents())).To(Equal(
+					"| total_images | concurrency_factor | ran_with_quota | ran_with_parallel_clean | number_of_cleans | number_of_deletes | total_duration_seconds | images_per_second | average_time_per_image | total_errors_amt | error_rate | latency_p50 | latency_p90 | latency_p95 | latency_p99 | latency_max | run_id | started_at | driver | grootfs_version | kernel_version | invalid_rootfs_amt | delete_strategy | ran_rootless | cache_mode | cache_prepare_count | cache_prepare_average | cache_prepare_p95 |\n" +
+						"| --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- |\n" +
+						"| 5 | 6 | true | true | 5 | 7 | 0.001 | 0.880 | 2.000 | 3 | 4.000 | 1.500 | 2.500 | 3.500 | 4.500 | 5.500 | 1234 | 2017-04-24T14:20:00Z | btrfs | 0.16.0 | 4.4.0 | 2 | lifo | true |  |  |  |  |\n",
+				))
+			})
+
+			It("prints the error messages in plain text", func() {
+				outBuffer := gbytes.NewBuffer()
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewMarkdownPrinter(outBuffer, errBuffer)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(errBuffer).Should(gbytes.Say("o noes"))
+			})
+		})
+	})
+
+	Describe("JUnitPrinter", func() {
+		Describe("Print", func() {
+			var slos []bench.SLO
+
+			BeforeEach(func() {
+				var err error
+				slos, err = bench.ParseSLOs([]string{"error_rate=4", "p95<3s", "bananas>1"})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("prints a test case per slo", func() {
+				outBuffer := gbytes.NewBuffer()
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewJUnitPrinter(outBuffer, errBuffer, slos)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(outBuffer).Should(gbytes.Say(`<\?xml version="1.0" encoding="UTF-8"\?>`))
+				Expect(outBuffer).Should(gbytes.Say(`<testsuite name="grootfs-bench" tests="3" failures="1" errors="1" time="0.001">`))
+				Expect(outBuffer).Should(gbytes.Say(`<property name="images_per_second" value="0.880"></property>`))
+				Expect(outBuffer).Should(gbytes.Say(`<testcase name="error_rate = 4" classname="grootfs-bench.slo" time="0"></testcase>`))
+				Expect(outBuffer).Should(gbytes.Say(`<testcase name="latency_p95 &lt; 3" classname="grootfs-bench.slo" time="0">\s*<failure message="latency_p95 was 3.500, expected latency_p95 &lt; 3" type="slo"></failure>`))
+				Expect(outBuffer).Should(gbytes.Say(`<testcase name="bananas &gt; 1" classname="grootfs-bench.slo" time="0">\s*<error message="unknown metric `))
+				Expect(outBuffer).Should(gbytes.Say(`<system-err>o noes</system-err>`))
+			})
+
+			It("prints the error messages in plain text", func() {
+				outBuffer := gbytes.NewBuffer()
+				errBuffer := gbytes.NewBuffer()
+
+				printer := bench.NewJUnitPrinter(outBuffer, errBuffer, slos)
+				Expect(printer.Print(summary)).To(Succeed())
+
+				Expect(errBuffer).Should(gbytes.Say("o noes"))
+			})
+		})
+	})
+
+	Describe("NewPrinter", func() {
+		It("returns the printer for the given format", func() {
+			for format, printer := range map[string]bench.Printer{
+				"text":     &bench.TextPrinter{},
+				"json":     &bench.JsonPrinter{},
+				"csv":      &bench.CSVPrinter{},
+				"markdown": &bench.MarkdownPrinter{},
+				"html":     &bench.HTMLPrinter{},
+				"junit":    &bench.JUnitPrinter{},
+			} {
+				p, err := bench.NewPrinter(format, nil, gbytes.NewBuffer(), gbytes.NewBuffer())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(p).To(BeAssignableToTypeOf(printer))
+			}
+		})
+
+		Context("when the format is unknown", func() {
+			It("returns an error", func() {
+				_, err := bench.NewPrinter("yaml", nil, gbytes.NewBuffer(), gbytes.NewBuffer())
+				Expect(err).To(MatchError("unknown format `yaml`, must be one of: text, json, csv, markdown, html, junit"))
+			})
+		})
+	})
 })
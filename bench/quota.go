@@ -0,0 +1,177 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultQuotaBytes is the disk limit of the images when quotas are used
+// without giving a size
+const DefaultQuotaBytes = 1019430400
+
+// QuotaSize is a disk limit images can be created with. Its weight is how
+// likely it is to be picked relative to the other sizes, 0 when the sizes are
+// used in turn.
+type QuotaSize struct {
+	Bytes  int64
+	Weight int
+}
+
+// QuotaSummary breaks the creations down by the disk limit they were given
+type QuotaSummary struct {
+	SizeBytes int64        `json:"size_bytes"`
+	Latency   LatencyStats `json:"latency"`
+}
+
+var sizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize reads a size in bytes, optionally suffixed with a binary unit
+// (e.g. 512M, 1GiB, 1073741824)
+func ParseSize(size string) (int64, error) {
+	number := strings.TrimSpace(size)
+	number = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(number), "B"), "I")
+
+	unit := ""
+	if len(number) > 0 {
+		if _, ok := sizeUnits[number[len(number)-1:]]; ok {
+			unit = number[len(number)-1:]
+			number = number[:len(number)-1]
+		}
+	}
+
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size `%s`", size)
+	}
+	if value > math.MaxInt64/sizeUnits[unit] {
+		return 0, fmt.Errorf("size `%s` is too large", size)
+	}
+
+	return value * sizeUnits[unit], nil
+}
+
+// ParseQuotaSizes reads quota sizes, either plain sizes used in turn or all
+// weighted with a `=<weight>` suffix, e.g. 512M=3 and 1G=1
+func ParseQuotaSizes(expressions []string) ([]QuotaSize, error) {
+	quotas := []QuotaSize{}
+	weighted := 0
+
+	for _, expression := range expressions {
+		parts := strings.SplitN(expression, "=", 2)
+		bytes, err := ParseSize(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing quota `%s`: %s", expression, err)
+		}
+
+		quota := QuotaSize{Bytes: bytes}
+		if len(parts) == 2 {
+			quota.Weight, err = strconv.Atoi(parts[1])
+			if err != nil || quota.Weight <= 0 {
+				return nil, fmt.Errorf("parsing quota `%s`: invalid weight `%s`", expression, parts[1])
+			}
+			weighted++
+		}
+		quotas = append(quotas, quota)
+	}
+
+	if weighted != 0 && weighted != len(quotas) {
+		return nil, fmt.Errorf("either all quotas or none must have a weight")
+	}
+
+	return quotas, nil
+}
+
+// FormatSize prints a size with the largest binary unit it is a multiple of
+func FormatSize(bytes int64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if bytes >= sizeUnits[unit] && bytes%sizeUnits[unit] == 0 {
+			return fmt.Sprintf("%d%siB", bytes/sizeUnits[unit], unit)
+		}
+	}
+
+	return fmt.Sprintf("%dB", bytes)
+}
+
+// nextQuota picks the disk limit of the next image
+func (j *Job) nextQuota() int64 {
+	if len(j.Quotas) == 0 {
+		return DefaultQuotaBytes
+	}
+
+	j.quotaMutex.Lock()
+	defer j.quotaMutex.Unlock()
+
+	if j.Quotas[0].Weight == 0 {
+		quota := j.Quotas[j.quotaCounter%len(j.Quotas)]
+		j.quotaCounter++
+		return quota.Bytes
+	}
+
+	if j.quotaRandom == nil {
+		j.quotaRandom = rand.New(rand.NewSource(j.QuotaSeed))
+	}
+
+	total := 0
+	for _, quota := range j.Quotas {
+		total += quota.Weight
+	}
+
+	pick := j.quotaRandom.Intn(total)
+	for _, quota := range j.Quotas {
+		if pick < quota.Weight {
+			return quota.Bytes
+		}
+		pick -= quota.Weight
+	}
+
+	return j.Quotas[len(j.Quotas)-1].Bytes
+}
+
+// quotaOf finds the disk limit a create command was given, 0 if none
+func quotaOf(args []string) int64 {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "--disk-limit-size-bytes" {
+			bytes, _ := strconv.ParseInt(args[i+1], 10, 64)
+			return bytes
+		}
+	}
+
+	return 0
+}
+
+func summarizeQuotas(results []Result) []QuotaSummary {
+	durations := map[int64][]time.Duration{}
+	errors := map[int64]int{}
+	sizes := []int64{}
+	for _, res := range results {
+		if _, seen := durations[res.QuotaBytes]; !seen {
+			durations[res.QuotaBytes] = []time.Duration{}
+			sizes = append(sizes, res.QuotaBytes)
+		}
+
+		if res.Err != nil {
+			errors[res.QuotaBytes]++
+		} else {
+			durations[res.QuotaBytes] = append(durations[res.QuotaBytes], res.Duration)
+		}
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	quotas := []QuotaSummary{}
+	for _, size := range sizes {
+		quotas = append(quotas, QuotaSummary{SizeBytes: size, Latency: NewLatencyStats(durations[size], errors[size])})
+	}
+
+	return quotas
+}
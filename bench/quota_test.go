@@ -0,0 +1,157 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quota", func() {
+	DescribeTable("ParseSize",
+		func(size string, expected int64) {
+			bytes, err := bench.ParseSize(size)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bytes).To(Equal(expected))
+		},
+		Entry("bytes", "1019430400", int64(1019430400)),
+		Entry("kibibytes", "4K", int64(4096)),
+		Entry("mebibytes", "512M", int64(512*1024*1024)),
+		Entry("with a unit suffix", "1GiB", int64(1024*1024*1024)),
+		Entry("lower case", "2gb", int64(2*1024*1024*1024)),
+	)
+
+	DescribeTable("ParseSize rejects invalid sizes",
+		func(size string) {
+			_, err := bench.ParseSize(size)
+			Expect(err).To(MatchError("invalid size `" + size + "`"))
+		},
+		Entry("no number", "G"),
+		Entry("unknown unit", "3X"),
+		Entry("zero", "0"),
+	)
+
+	It("rejects sizes that do not fit in 64 bits", func() {
+		_, err := bench.ParseSize("9000000T")
+		Expect(err).To(MatchError("size `9000000T` is too large"))
+	})
+
+	Describe("ParseQuotaSizes", func() {
+		It("reads weights", func() {
+			quotas, err := bench.ParseQuotaSizes([]string{"512M=3", "1G=1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quotas).To(Equal([]bench.QuotaSize{{Bytes: 512 * 1024 * 1024, Weight: 3}, {Bytes: 1024 * 1024 * 1024, Weight: 1}}))
+		})
+
+		It("does not mix weighted and unweighted sizes", func() {
+			_, err := bench.ParseQuotaSizes([]string{"512M=3", "1G"})
+			Expect(err).To(MatchError("either all quotas or none must have a weight"))
+		})
+
+		It("rejects invalid weights", func() {
+			_, err := bench.ParseQuotaSizes([]string{"512M=lots"})
+			Expect(err).To(MatchError("parsing quota `512M=lots`: invalid weight `lots`"))
+		})
+	})
+
+	Describe("FormatSize", func() {
+		It("uses the largest unit the size is a multiple of", func() {
+			Expect(bench.FormatSize(1024 * 1024 * 1024)).To(Equal("1GiB"))
+			Expect(bench.FormatSize(1536 * 1024 * 1024)).To(Equal("1536MiB"))
+			Expect(bench.FormatSize(1019430400)).To(Equal("1019430400B"))
+		})
+	})
+
+	Describe("creating images", func() {
+		var (
+			job           *bench.Job
+			fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		)
+
+		BeforeEach(func() {
+			job = createJob()
+			job.TotalImages = 6
+			job.Concurrency = 2
+			job.UseQuota = true
+			fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+		})
+
+		quotas := func() []string {
+			sizes := []string{}
+			for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+				Expect(cmd.Args[8]).To(Equal("--disk-limit-size-bytes"))
+				sizes = append(sizes, cmd.Args[9])
+			}
+			return sizes
+		}
+
+		It("uses the sizes in turn", func() {
+			job.Quotas = []bench.QuotaSize{{Bytes: 100}, {Bytes: 200}, {Bytes: 300}}
+			job.Run(context.Background())
+
+			Expect(quotas()).To(ConsistOf("100", "200", "300", "100", "200", "300"))
+		})
+
+		It("picks weighted sizes the same way for the same seed", func() {
+			job.Quotas = []bench.QuotaSize{{Bytes: 100, Weight: 1}, {Bytes: 200, Weight: 1000}}
+			job.QuotaSeed = 7
+			job.Run(context.Background())
+			first := quotas()
+			Expect(first).To(ContainElement("200"))
+
+			otherJob := createJob()
+			otherJob.TotalImages = 6
+			otherJob.Concurrency = 1
+			otherJob.UseQuota = true
+			otherJob.Quotas = job.Quotas
+			otherJob.QuotaSeed = 7
+			otherJob.Run(context.Background())
+
+			seen := []string{}
+			for _, cmd := range otherJob.Runner.(*fake_command_runner.FakeCommandRunner).ExecutedCommands() {
+				seen = append(seen, cmd.Args[9])
+			}
+			Expect(seen).To(ConsistOf(first))
+		})
+
+		It("excludes the image from the quota", func() {
+			job.ExcludeImageFromQuota = true
+			job.Run(context.Background())
+
+			for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+				Expect(cmd.Args[8:11]).To(Equal([]string{"--disk-limit-size-bytes", "1019430400", "--exclude-image-from-quota"}))
+			}
+		})
+
+		It("breaks the results down by quota size", func() {
+			job.Quotas = []bench.QuotaSize{{Bytes: 200}, {Bytes: 100}}
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				if cmd.Args[9] == "200" {
+					return errors.New("exit status 1")
+				}
+				return nil
+			})
+
+			summary := job.Run(context.Background())
+			Expect(summary.Quotas).To(HaveLen(2))
+			Expect(summary.Quotas[0].SizeBytes).To(Equal(int64(100)))
+			Expect(summary.Quotas[0].Latency.Count).To(Equal(3))
+			Expect(summary.Quotas[0].Latency.Errors).To(Equal(0))
+			Expect(summary.Quotas[1].SizeBytes).To(Equal(int64(200)))
+			Expect(summary.Quotas[1].Latency.Count).To(Equal(0))
+			Expect(summary.Quotas[1].Latency.Errors).To(Equal(3))
+		})
+
+		Context("without quota", func() {
+			It("does not break the results down", func() {
+				job.UseQuota = false
+				Expect(job.Run(context.Background()).Quotas).To(BeNil())
+			})
+		})
+	})
+})
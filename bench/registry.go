@@ -0,0 +1,394 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRegistryAddress is where the registry listens unless told otherwise
+const DefaultRegistryAddress = "127.0.0.1:5000"
+
+const (
+	dockerManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerConfigType   = "application/vnd.docker.container.image.v1+json"
+	dockerLayerType    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	// registry responses are throttled in chunks of this many bytes
+	throttleChunkBytes = 32 * 1024
+)
+
+// RegistryConfig holds the faults the registry injects. Latency delays every
+// request, BandwidthBytes limits the bytes per second sent by all the
+// responses together and ErrorRate is the fraction of manifest and blob
+// requests failing.
+type RegistryConfig struct {
+	Latency        time.Duration
+	BandwidthBytes int64
+	ErrorRate      float64
+	Seed           int64
+}
+
+// RegistrySummary counts what the registry served during the run
+type RegistrySummary struct {
+	Address        string `json:"address"`
+	Requests       int    `json:"requests"`
+	BytesServed    int64  `json:"bytes_served"`
+	InjectedErrors int    `json:"injected_errors"`
+}
+
+// Registry serves OCI image layouts over the Docker Registry HTTP API v2.
+// Every layout is a repository named after its directory, with the tags of
+// its index.
+type Registry struct {
+	config       RegistryConfig
+	repositories map[string]*registryRepository
+	throttle     *throttle
+	listener     net.Listener
+
+	mutex   sync.Mutex
+	random  *rand.Rand
+	summary RegistrySummary
+}
+
+type registryRepository struct {
+	blobsPath string
+	// manifests by tag and by digest, in both formats
+	ociManifests    map[string][]byte
+	dockerManifests map[string][]byte
+}
+
+func ValidateRegistryConfig(config RegistryConfig) error {
+	if config.Latency < 0 {
+		return fmt.Errorf("registry latency cannot be negative")
+	}
+
+	if config.BandwidthBytes < 0 {
+		return fmt.Errorf("registry bandwidth cannot be negative")
+	}
+
+	if config.ErrorRate < 0 || config.ErrorRate > 1 {
+		return fmt.Errorf("registry error rate must be between 0 and 1, got %g", config.ErrorRate)
+	}
+
+	return nil
+}
+
+// NewRegistry loads the image layouts of fixturesPath, either a layout itself
+// or a directory of layouts
+func NewRegistry(fixturesPath string, config RegistryConfig) (*Registry, error) {
+	if err := ValidateRegistryConfig(config); err != nil {
+		return nil, err
+	}
+
+	layouts := map[string]string{}
+	if _, err := os.Stat(filepath.Join(fixturesPath, "index.json")); err == nil {
+		layouts[filepath.Base(fixturesPath)] = fixturesPath
+	} else {
+		entries, err := ioutil.ReadDir(fixturesPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading registry fixtures: %s", err)
+		}
+		for _, entry := range entries {
+			layoutPath := filepath.Join(fixturesPath, entry.Name())
+			if _, err := os.Stat(filepath.Join(layoutPath, "index.json")); entry.IsDir() && err == nil {
+				layouts[entry.Name()] = layoutPath
+			}
+		}
+	}
+
+	if len(layouts) == 0 {
+		return nil, fmt.Errorf("no OCI image layout found in `%s`", fixturesPath)
+	}
+
+	registry := &Registry{
+		config:       config,
+		repositories: map[string]*registryRepository{},
+		throttle:     &throttle{rate: config.BandwidthBytes},
+		random:       rand.New(rand.NewSource(config.Seed)),
+	}
+	for name, layoutPath := range layouts {
+		repository, err := loadRegistryRepository(layoutPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading `%s`: %s", layoutPath, err)
+		}
+		registry.repositories[name] = repository
+	}
+
+	return registry, nil
+}
+
+// Repositories lists the names the images are served under
+func (r *Registry) Repositories() []string {
+	names := []string{}
+	for name := range r.repositories {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Start serves the registry on address in the background, returning the
+// address it listens on
+func (r *Registry) Start(address string) (string, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", fmt.Errorf("starting registry: %s", err)
+	}
+
+	r.listener = listener
+	r.summary.Address = listener.Addr().String()
+	go http.Serve(listener, r)
+
+	return r.summary.Address, nil
+}
+
+func (r *Registry) Stop() error {
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Close()
+}
+
+func (r *Registry) Summary() RegistrySummary {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.summary
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	r.summary.Requests++
+	r.mutex.Unlock()
+
+	time.Sleep(r.config.Latency)
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "the registry is read only")
+		return
+	}
+
+	if req.URL.Path == "/v2/" || req.URL.Path == "/v2" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+
+	name, kind, reference := parseRegistryPath(req.URL.Path)
+	repository, ok := r.repositories[name]
+	if !ok {
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository `%s` not found", name))
+		return
+	}
+
+	if r.injectError() {
+		registryError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "injected failure")
+		return
+	}
+
+	switch kind {
+	case "manifests":
+		r.serveManifest(w, req, repository, reference)
+	case "blobs":
+		r.serveBlob(w, req, repository, reference)
+	default:
+		registryError(w, http.StatusNotFound, "UNSUPPORTED", fmt.Sprintf("unknown path `%s`", req.URL.Path))
+	}
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repository *registryRepository, reference string) {
+	manifests, mediaType := repository.dockerManifests, dockerManifestType
+	accept := strings.Join(req.Header["Accept"], ",")
+	if strings.Contains(accept, ociManifestType) && !strings.Contains(accept, dockerManifestType) {
+		manifests, mediaType = repository.ociManifests, ociManifestType
+	}
+
+	manifest, ok := manifests[reference]
+	if !ok {
+		registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest `%s` not found", reference))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Docker-Content-Digest", digestOf(manifest))
+	w.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+	if req.Method == http.MethodHead {
+		return
+	}
+	r.send(w, strings.NewReader(string(manifest)))
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, repository *registryRepository, digest string) {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if hex == digest || strings.ContainsAny(hex, "/.") {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob `%s` not found", digest))
+		return
+	}
+
+	blob, err := os.Open(filepath.Join(repository.blobsPath, hex))
+	if err != nil {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob `%s` not found", digest))
+		return
+	}
+	defer blob.Close()
+
+	info, err := blob.Stat()
+	if err != nil {
+		registryError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if req.Method == http.MethodHead {
+		return
+	}
+	r.send(w, blob)
+}
+
+// send writes a response body within the bandwidth of the registry
+func (r *Registry) send(w io.Writer, body io.Reader) {
+	buffer := make([]byte, throttleChunkBytes)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			r.throttle.wait(n)
+			written, writeErr := w.Write(buffer[:n])
+
+			r.mutex.Lock()
+			r.summary.BytesServed += int64(written)
+			r.mutex.Unlock()
+
+			if writeErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *Registry) injectError() bool {
+	if r.config.ErrorRate == 0 {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.random.Float64() >= r.config.ErrorRate {
+		return false
+	}
+	r.summary.InjectedErrors++
+	return true
+}
+
+// parseRegistryPath splits /v2/<name>/<manifests|blobs>/<reference>, where
+// the name can contain slashes
+func parseRegistryPath(path string) (string, string, string) {
+	path = strings.TrimPrefix(path, "/v2/")
+	for _, kind := range []string{"manifests", "blobs"} {
+		if i := strings.LastIndex(path, "/"+kind+"/"); i >= 0 {
+			return path[:i], kind, path[i+len(kind)+2:]
+		}
+	}
+
+	return path, "", ""
+}
+
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// loadRegistryRepository reads the manifests of every tag of a layout,
+// converting them to the docker format most clients ask for
+func loadRegistryRepository(layoutPath string) (*registryRepository, error) {
+	repository := &registryRepository{
+		blobsPath:       filepath.Join(layoutPath, "blobs", "sha256"),
+		ociManifests:    map[string][]byte{},
+		dockerManifests: map[string][]byte{},
+	}
+
+	var index ociIndex
+	contents, err := ioutil.ReadFile(filepath.Join(layoutPath, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &index); err != nil {
+		return nil, fmt.Errorf("reading index: %s", err)
+	}
+
+	for _, descriptor := range index.Manifests {
+		ociManifestContents, err := ioutil.ReadFile(filepath.Join(repository.blobsPath, strings.TrimPrefix(descriptor.Digest, "sha256:")))
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest: %s", err)
+		}
+
+		var manifest ociManifest
+		if err := json.Unmarshal(ociManifestContents, &manifest); err != nil {
+			return nil, fmt.Errorf("reading manifest: %s", err)
+		}
+
+		manifest.MediaType = dockerManifestType
+		manifest.Config.MediaType = dockerConfigType
+		for i := range manifest.Layers {
+			manifest.Layers[i].MediaType = dockerLayerType
+		}
+		dockerManifestContents, err := json.Marshal(manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		repository.ociManifests[descriptor.Digest] = ociManifestContents
+		repository.dockerManifests[digestOf(dockerManifestContents)] = dockerManifestContents
+		if tag := descriptor.Annotations[ociRefAnnotation]; tag != "" {
+			repository.ociManifests[tag] = ociManifestContents
+			repository.dockerManifests[tag] = dockerManifestContents
+		}
+	}
+
+	return repository, nil
+}
+
+// throttle spaces out writes so that they add up to at most rate bytes per
+// second, 0 meaning no limit
+type throttle struct {
+	rate int64
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+func (t *throttle) wait(n int) {
+	if t.rate == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	until := t.next
+	t.mutex.Unlock()
+
+	time.Sleep(until.Sub(now))
+}
@@ -0,0 +1,207 @@
+package bench_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		fixturesPath string
+		image        bench.OCIImage
+		config       bench.RegistryConfig
+		registry     *bench.Registry
+		server       *httptest.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		fixturesPath, err = ioutil.TempDir("", "registry")
+		Expect(err).NotTo(HaveOccurred())
+
+		image, err = bench.GenerateOCIImage(filepath.Join(fixturesPath, "fixture"), bench.OCIImageSpec{
+			Tag:                  "latest",
+			Layers:               2,
+			LayerSizes:           []int64{64 * 1024},
+			FilesPerLayer:        10,
+			FileSizeDistribution: bench.FileSizesEven,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		config = bench.RegistryConfig{}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		registry, err = bench.NewRegistry(fixturesPath, config)
+		Expect(err).NotTo(HaveOccurred())
+		server = httptest.NewServer(registry)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(fixturesPath)).To(Succeed())
+	})
+
+	get := func(path string, accept ...string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, body
+	}
+
+	It("answers the version check", func() {
+		resp, _ := get("/v2/")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Docker-Distribution-API-Version")).To(Equal("registry/2.0"))
+	})
+
+	It("serves every layout of the fixtures directory as a repository", func() {
+		Expect(registry.Repositories()).To(ConsistOf("fixture"))
+	})
+
+	It("serves the manifest of a tag in the docker format", func() {
+		resp, body := get("/v2/fixture/manifests/latest", "application/vnd.docker.distribution.manifest.v2+json")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/vnd.docker.distribution.manifest.v2+json"))
+
+		var manifest struct {
+			MediaType string
+			Layers    []struct{ MediaType, Digest string }
+		}
+		Expect(json.Unmarshal(body, &manifest)).To(Succeed())
+		Expect(manifest.MediaType).To(Equal("application/vnd.docker.distribution.manifest.v2+json"))
+		Expect(manifest.Layers).To(HaveLen(2))
+		Expect(manifest.Layers[0].MediaType).To(Equal("application/vnd.docker.image.rootfs.diff.tar.gzip"))
+		Expect(manifest.Layers[0].Digest).To(Equal(image.Layers[0].Digest))
+
+		digest := resp.Header.Get("Docker-Content-Digest")
+		resp, byDigest := get("/v2/fixture/manifests/"+digest, "application/vnd.docker.distribution.manifest.v2+json")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(byDigest).To(Equal(body))
+	})
+
+	It("serves the OCI manifest to clients only accepting it", func() {
+		resp, _ := get("/v2/fixture/manifests/latest", "application/vnd.oci.image.manifest.v1+json")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Docker-Content-Digest")).To(Equal(image.ManifestDigest))
+	})
+
+	It("serves the blobs", func() {
+		resp, body := get("/v2/fixture/blobs/" + image.Layers[1].Digest)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Docker-Content-Digest")).To(Equal(image.Layers[1].Digest))
+
+		blob, err := ioutil.ReadFile(filepath.Join(image.Path, "blobs", "sha256", image.Layers[1].Digest[len("sha256:"):]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(Equal(blob))
+		Expect(registry.Summary().BytesServed).To(BeNumerically("==", len(blob)))
+	})
+
+	It("answers unknown repositories, manifests and blobs with registry errors", func() {
+		resp, body := get("/v2/nope/manifests/latest")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(string(body)).To(ContainSubstring("NAME_UNKNOWN"))
+
+		resp, body = get("/v2/fixture/manifests/nope")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(string(body)).To(ContainSubstring("MANIFEST_UNKNOWN"))
+
+		resp, body = get("/v2/fixture/blobs/sha256:abc")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(string(body)).To(ContainSubstring("BLOB_UNKNOWN"))
+	})
+
+	Context("when an error rate is given", func() {
+		BeforeEach(func() {
+			config.ErrorRate = 1
+		})
+
+		It("fails the requests and counts them", func() {
+			resp, body := get("/v2/fixture/manifests/latest")
+			Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+			Expect(string(body)).To(ContainSubstring("injected failure"))
+
+			resp, _ = get("/v2/")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			Expect(registry.Summary().Requests).To(Equal(2))
+			Expect(registry.Summary().InjectedErrors).To(Equal(1))
+		})
+	})
+
+	Context("when a latency is given", func() {
+		BeforeEach(func() {
+			config.Latency = 200 * time.Millisecond
+		})
+
+		It("delays every request", func() {
+			start := time.Now()
+			get("/v2/")
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+	})
+
+	Context("when a bandwidth is given", func() {
+		BeforeEach(func() {
+			config.BandwidthBytes = 128 * 1024
+		})
+
+		It("limits how fast the blobs are sent", func() {
+			start := time.Now()
+			get("/v2/fixture/blobs/" + image.Layers[0].Digest)
+			Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+		})
+	})
+
+	Describe("Start", func() {
+		It("listens on the address, reporting it", func() {
+			address, err := registry.Start("127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer registry.Stop()
+
+			resp, err := http.Get("http://" + address + "/v2/")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(registry.Summary().Address).To(Equal(address))
+		})
+	})
+
+	Describe("NewRegistry", func() {
+		It("serves a single layout under its directory name", func() {
+			registry, err := bench.NewRegistry(image.Path, config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registry.Repositories()).To(ConsistOf("fixture"))
+		})
+
+		It("fails when there is no layout", func() {
+			_, err := bench.NewRegistry(filepath.Join(image.Path, "blobs"), config)
+			Expect(err).To(MatchError(ContainSubstring("no OCI image layout found")))
+		})
+
+		It("rejects error rates above 1", func() {
+			config.ErrorRate = 1.5
+			_, err := bench.NewRegistry(fixturesPath, config)
+			Expect(err).To(MatchError("registry error rate must be between 0 and 1, got 1.5"))
+		})
+	})
+})
@@ -0,0 +1,167 @@
+package bench
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CreateOutput is what grootfs create returned for an image
+type CreateOutput struct {
+	RootFSPath string
+	Mounts     []Mount
+}
+
+// ImageSummary is what the json summary records of each image created or
+// cycled: the rootfs and mounts grootfs create returned, or why it failed
+type ImageSummary struct {
+	BaseImage  string  `json:"base_image"`
+	Duration   float64 `json:"duration"`
+	Error      string  `json:"error,omitempty"`
+	RootFSPath string  `json:"rootfs_path"`
+	Mounts     []Mount `json:"mounts,omitempty"`
+}
+
+func summarizeImages(results []Result) []ImageSummary {
+	images := []ImageSummary{}
+	for _, result := range results {
+		image := ImageSummary{
+			BaseImage:  result.BaseImage,
+			Duration:   result.Duration.Seconds(),
+			RootFSPath: result.RootFSPath,
+			Mounts:     result.Mounts,
+		}
+		if result.Err != nil {
+			image.Error = result.Err.Error()
+		}
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// Mount is a mount grootfs asks the container runtime to perform, as found
+// in the runtime spec printed by grootfs create
+type Mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options"`
+}
+
+// InvalidRootFSError is returned when grootfs create succeeded but the image
+// it returned cannot be used
+type InvalidRootFSError struct {
+	RootFSPath string
+	Reason     string
+}
+
+func (e *InvalidRootFSError) Error() string {
+	return fmt.Sprintf("invalid rootfs `%s`: %s", e.RootFSPath, e.Reason)
+}
+
+func isInvalidRootFS(err error) bool {
+	if stepErr, ok := err.(stepError); ok {
+		err = stepErr.err
+	}
+
+	_, ok := err.(*InvalidRootFSError)
+	return ok
+}
+
+// createImage runs grootfs create and records the rootfs it returned, along
+// with the stats of its cgroup. When VerifyRootFS is set, an unusable rootfs
+// is reported as an InvalidRootFSError.
+func (j *Job) createImage(cmd *exec.Cmd) (CreateOutput, *CgroupStats, error) {
+	stdout, cgroup, err := j.measure(cmd)
+	if err != nil {
+		return CreateOutput{}, cgroup, err
+	}
+
+	output, err := parseCreateOutput(stdout)
+	if !j.VerifyRootFS {
+		return output, cgroup, nil
+	}
+
+	if err != nil {
+		return output, cgroup, &InvalidRootFSError{RootFSPath: output.RootFSPath, Reason: err.Error()}
+	}
+
+	return output, cgroup, verifyRootFS(output, j.ExpectedFiles)
+}
+
+// parseCreateOutput reads the output of grootfs create, which is either the
+// rootfs path or a json runtime spec
+func parseCreateOutput(stdout string) (CreateOutput, error) {
+	stdout = strings.TrimSpace(stdout)
+
+	if strings.HasPrefix(stdout, "{") {
+		var spec struct {
+			Root struct {
+				Path string `json:"path"`
+			} `json:"root"`
+			Mounts []Mount `json:"mounts"`
+		}
+		if err := json.Unmarshal([]byte(stdout), &spec); err != nil {
+			return CreateOutput{}, fmt.Errorf("parsing grootfs create output: %s", err)
+		}
+
+		if spec.Root.Path == "" {
+			return CreateOutput{}, errors.New("grootfs create did not return a rootfs path")
+		}
+
+		return CreateOutput{RootFSPath: spec.Root.Path, Mounts: spec.Mounts}, nil
+	}
+
+	lines := strings.Split(stdout, "\n")
+	path := strings.TrimSpace(lines[len(lines)-1])
+	if path == "" {
+		return CreateOutput{}, errors.New("grootfs create did not return a rootfs path")
+	}
+
+	return CreateOutput{RootFSPath: path}, nil
+}
+
+// verifyRootFS checks the rootfs exists and holds the expected files. When
+// grootfs left mounting the rootfs to the runtime its contents cannot be
+// checked, so only its existence is.
+func verifyRootFS(output CreateOutput, expectedFiles []string) error {
+	invalid := func(format string, args ...interface{}) error {
+		return &InvalidRootFSError{RootFSPath: output.RootFSPath, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	info, err := os.Stat(output.RootFSPath)
+	if err != nil {
+		return invalid("%s", err)
+	}
+	if !info.IsDir() {
+		return invalid("not a directory")
+	}
+
+	for _, mount := range output.Mounts {
+		if mount.Destination == "/" {
+			return nil
+		}
+	}
+
+	entries, err := ioutil.ReadDir(output.RootFSPath)
+	if err != nil {
+		return invalid("%s", err)
+	}
+	if len(entries) == 0 {
+		return invalid("empty")
+	}
+
+	for _, file := range expectedFiles {
+		if _, err := os.Lstat(filepath.Join(output.RootFSPath, file)); err != nil {
+			return invalid("missing expected file `%s`", file)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package bench_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Rootfs verification", func() {
+	var (
+		job       *bench.Job
+		rootfsDir string
+		output    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		rootfsDir, err = ioutil.TempDir("", "rootfs")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(rootfsDir, "hello"), []byte("hi"), 0644)).To(Succeed())
+
+		job = genericJob()
+		job.TotalImages = 2
+		job.Concurrency = 1
+		job.Command = "create"
+		job.VerifyRootFS = true
+
+		output = rootfsDir + "\n"
+		fakeCmdRunner := job.Runner.(*fake_command_runner.FakeCommandRunner)
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(output))
+			return nil
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootfsDir)).To(Succeed())
+	})
+
+	It("records the rootfs returned by grootfs", func() {
+		summary := job.Run(context.Background())
+		Expect(summary.TotalErrorsAmt).To(Equal(0))
+		Expect(summary.Results[0].RootFSPath).To(Equal(rootfsDir))
+	})
+
+	It("records the rootfs and mounts of a runtime spec", func() {
+		output = `{"root":{"path":"` + rootfsDir + `"},"mounts":[{"destination":"/","type":"overlay","source":"overlay","options":["lowerdir=/a"]}]}`
+
+		summary := job.Run(context.Background())
+		Expect(summary.TotalErrorsAmt).To(Equal(0))
+		Expect(summary.Results[0].RootFSPath).To(Equal(rootfsDir))
+		Expect(summary.Results[0].Mounts).To(Equal([]bench.Mount{
+			{Destination: "/", Type: "overlay", Source: "overlay", Options: []string{"lowerdir=/a"}},
+		}))
+	})
+
+	It("prints the rootfs and mounts of every image in the json summary", func() {
+		output = `{"root":{"path":"` + rootfsDir + `"},"mounts":[{"destination":"/","type":"overlay","source":"overlay","options":["lowerdir=/a"]}]}`
+
+		buffer := gbytes.NewBuffer()
+		Expect(bench.NewJsonPrinter(buffer, gbytes.NewBuffer()).Print(*job.Run(context.Background()))).To(Succeed())
+
+		var summary bench.Summary
+		Expect(json.Unmarshal(buffer.Contents(), &summary)).To(Succeed())
+		Expect(summary.Images).To(HaveLen(2))
+		Expect(summary.Images[0].BaseImage).To(Equal("docker:///busybox"))
+		Expect(summary.Images[0].RootFSPath).To(Equal(rootfsDir))
+		Expect(summary.Images[0].Mounts).To(Equal([]bench.Mount{
+			{Destination: "/", Type: "overlay", Source: "overlay", Options: []string{"lowerdir=/a"}},
+		}))
+	})
+
+	It("checks the expected files exist", func() {
+		job.ExpectedFiles = []string{"hello", "bin/sh"}
+
+		summary := job.Run(context.Background())
+		Expect(summary.TotalErrorsAmt).To(Equal(2))
+		Expect(summary.InvalidRootFSAmt).To(Equal(2))
+		Expect(summary.ErrorMessages[0]).To(ContainSubstring("invalid rootfs `" + rootfsDir + "`: missing expected file `bin/sh`"))
+	})
+
+	Context("when the rootfs does not exist", func() {
+		BeforeEach(func() {
+			output = "/this/rootfs/does/not/exist\n"
+		})
+
+		It("counts the image as invalid", func() {
+			summary := job.Run(context.Background())
+			Expect(summary.TotalErrorsAmt).To(Equal(2))
+			Expect(summary.InvalidRootFSAmt).To(Equal(2))
+			Expect(summary.ErrorMessages[0]).To(ContainSubstring("invalid rootfs `/this/rootfs/does/not/exist`"))
+		})
+
+		It("does not check anything when verification is off", func() {
+			job.VerifyRootFS = false
+
+			summary := job.Run(context.Background())
+			Expect(summary.TotalErrorsAmt).To(Equal(0))
+			Expect(summary.Results[0].RootFSPath).To(Equal("/this/rootfs/does/not/exist"))
+		})
+	})
+
+	Context("when the rootfs is empty", func() {
+		It("counts the image as invalid", func() {
+			Expect(os.Remove(filepath.Join(rootfsDir, "hello"))).To(Succeed())
+
+			summary := job.Run(context.Background())
+			Expect(summary.InvalidRootFSAmt).To(Equal(2))
+			Expect(summary.ErrorMessages[0]).To(ContainSubstring(": empty"))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DefaultSubIDRange is the range of ids mapped to the users of the images
+// when running rootless without explicit mappings, after mapping root to the
+// user running grootfs
+const DefaultSubIDRange = "1:100000:65000"
+
+// ParseUser reads the <uid>:<gid> grootfs runs as in rootless mode
+func ParseUser(user string) (uint32, uint32, error) {
+	parts := strings.Split(user, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid user `%s`, expected <uid>:<gid>", user)
+	}
+
+	uid, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid `%s`", parts[0])
+	}
+	gid, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid `%s`", parts[1])
+	}
+
+	return uint32(uid), uint32(gid), nil
+}
+
+// ValidateMappings checks id mappings have the <namespace id>:<host id>:<size>
+// form grootfs expects
+func ValidateMappings(mappings []string) error {
+	for _, mapping := range mappings {
+		parts := strings.Split(mapping, ":")
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid mapping `%s`, expected <namespace id>:<host id>:<size>", mapping)
+		}
+
+		for _, part := range parts {
+			if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+				return fmt.Errorf("invalid mapping `%s`, expected <namespace id>:<host id>:<size>", mapping)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DefaultMappings maps root in the images to the given host id and the other
+// users to DefaultSubIDRange
+func DefaultMappings(hostID uint32) []string {
+	return []string{fmt.Sprintf("0:%d:1", hostID), DefaultSubIDRange}
+}
+
+// runAs makes the command run as the job's user in rootless mode
+func (j *Job) runAs(cmd *exec.Cmd) {
+	if !j.Rootless {
+		return
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: j.UID, Gid: j.GID},
+	}
+}
+
+// mappingArgs are the uid and gid mappings given to the commands that create
+// images or stores
+func (j *Job) mappingArgs() []string {
+	args := []string{}
+	for _, mapping := range j.UIDMappings {
+		args = append(args, "--uid-mapping", mapping)
+	}
+	for _, mapping := range j.GIDMappings {
+		args = append(args, "--gid-mapping", mapping)
+	}
+
+	return args
+}
@@ -0,0 +1,94 @@
+package bench_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rootless", func() {
+	var (
+		job           *bench.Job
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+	)
+
+	BeforeEach(func() {
+		job = createJob()
+		job.TotalImages = 2
+		job.Rootless = true
+		job.UID = 1000
+		job.GID = 1001
+		job.UIDMappings = []string{"0:1000:1", "1:100000:65000"}
+		job.GIDMappings = []string{"0:1001:1"}
+		fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+	})
+
+	It("runs grootfs as the given user", func() {
+		summary := job.Run(context.Background())
+		Expect(summary.RanRootless).To(BeTrue())
+
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			Expect(cmd.SysProcAttr.Credential.Uid).To(Equal(uint32(1000)))
+			Expect(cmd.SysProcAttr.Credential.Gid).To(Equal(uint32(1001)))
+		}
+	})
+
+	It("creates the images with the mappings", func() {
+		job.Run(context.Background())
+
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			Expect(cmd.Args[7:14]).To(Equal([]string{"create", "--uid-mapping", "0:1000:1", "--uid-mapping", "1:100000:65000", "--gid-mapping", "0:1001:1"}))
+		}
+	})
+
+	It("creates the store with the mappings", func() {
+		_, err := job.InitStore(0)
+		Expect(err).NotTo(HaveOccurred())
+
+		cmd := fakeCmdRunner.ExecutedCommands()[0]
+		Expect(cmd.Args[7:]).To(Equal([]string{"init-store", "--uid-mapping", "0:1000:1", "--uid-mapping", "1:100000:65000", "--gid-mapping", "0:1001:1"}))
+		Expect(cmd.SysProcAttr.Credential.Uid).To(Equal(uint32(1000)))
+	})
+
+	Context("when not rootless", func() {
+		It("runs grootfs as the current user", func() {
+			job.Rootless = false
+			summary := job.Run(context.Background())
+			Expect(summary.RanRootless).To(BeFalse())
+
+			for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+				Expect(cmd.SysProcAttr).To(BeNil())
+			}
+		})
+	})
+
+	Describe("ParseUser", func() {
+		It("reads the uid and gid", func() {
+			uid, gid, err := bench.ParseUser("1000:1001")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal(uint32(1000)))
+			Expect(gid).To(Equal(uint32(1001)))
+		})
+
+		It("rejects invalid users", func() {
+			_, _, err := bench.ParseUser("1000")
+			Expect(err).To(MatchError("invalid user `1000`, expected <uid>:<gid>"))
+			_, _, err = bench.ParseUser("me:1000")
+			Expect(err).To(MatchError("invalid uid `me`"))
+		})
+	})
+
+	Describe("ValidateMappings", func() {
+		It("accepts mappings", func() {
+			Expect(bench.ValidateMappings(bench.DefaultMappings(1000))).To(Succeed())
+		})
+
+		It("rejects invalid mappings", func() {
+			Expect(bench.ValidateMappings([]string{"0:1000"})).To(MatchError("invalid mapping `0:1000`, expected <namespace id>:<host id>:<size>"))
+			Expect(bench.ValidateMappings([]string{"0:me:1"})).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,252 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner"
+)
+
+// RunInfo describes what a summary measured and where, so results can be
+// compared without knowing how the bench was invoked
+type RunInfo struct {
+	ID             string      `json:"id"`
+	StartedAt      time.Time   `json:"started_at"`
+	FinishedAt     time.Time   `json:"finished_at"`
+	GrootFSVersion string      `json:"grootfs_version"`
+	Config         RunConfig   `json:"config"`
+	Environment    Environment `json:"environment"`
+	Store          StoreInfo   `json:"store"`
+}
+
+// RunConfig holds the options a benchmark was run with
+type RunConfig struct {
+	GrootFSBinPath          string   `json:"grootfs_bin_path"`
+	StorePath               string   `json:"store_path"`
+	Driver                  string   `json:"driver"`
+	LogLevel                string   `json:"log_level"`
+	MetricsEnabled          bool     `json:"metrics_enabled"`
+	BaseImages              []string `json:"base_images"`
+	BaseImageWeights        []int    `json:"base_image_weights"`
+	BaseImageDistribution   string   `json:"base_image_distribution"`
+	BaseImageSeed           int64    `json:"base_image_seed"`
+	ZipfExponent            float64  `json:"zipf_exponent"`
+	TotalImages             int      `json:"total_images"`
+	Concurrency             int      `json:"concurrency"`
+	UseQuota                bool     `json:"use_quota"`
+	QuotaSizes              []string `json:"quota_sizes"`
+	QuotaSeed               int64    `json:"quota_seed"`
+	ExcludeImageFromQuota   bool     `json:"exclude_image_from_quota"`
+	Rootless                bool     `json:"rootless"`
+	CacheMode               string   `json:"cache_mode"`
+	DropCaches              bool     `json:"drop_caches"`
+	UID                     uint32   `json:"uid"`
+	GID                     uint32   `json:"gid"`
+	UIDMappings             []string `json:"uid_mappings"`
+	GIDMappings             []string `json:"gid_mappings"`
+	Lifecycle               bool     `json:"lifecycle"`
+	WriteBytes              int64    `json:"write_bytes"`
+	DwellTime               float64  `json:"dwell_time"`
+	VerifyRootFS            bool     `json:"verify_rootfs"`
+	ExpectedFiles           []string `json:"expected_files"`
+	ParallelClean           bool     `json:"parallel_clean"`
+	CleanInterval           int      `json:"clean_interval"`
+	DeleteInterval          int      `json:"delete_interval"`
+	DeleteStrategy          string   `json:"delete_strategy"`
+	DeleteSeed              int64    `json:"delete_seed"`
+	KeepLive                int      `json:"keep_live"`
+	Teardown                bool     `json:"teardown"`
+	TeardownClean           bool     `json:"teardown_clean"`
+	InitStore               bool     `json:"init_store"`
+	StoreSizeBytes          int64    `json:"store_size_bytes"`
+	DeleteStore             bool     `json:"delete_store"`
+	GrootFSArgs             []string `json:"grootfs_args"`
+	CommandArgs             []string `json:"command_args"`
+	ParallelCommands        []string `json:"parallel_commands"`
+	ParallelCommandInterval int      `json:"parallel_command_interval"`
+	Registry                string   `json:"registry"`
+	RegistryLatency         float64  `json:"registry_latency"`
+	RegistryBandwidthBytes  int64    `json:"registry_bandwidth_bytes"`
+	RegistryErrorRate       float64  `json:"registry_error_rate"`
+	RegistrySeed            int64    `json:"registry_seed"`
+	Cgroup                  bool     `json:"cgroup"`
+	CgroupRoot              string   `json:"cgroup_root"`
+	CgroupCPUs              float64  `json:"cgroup_cpus"`
+	CgroupMemoryBytes       int64    `json:"cgroup_memory_bytes"`
+	CgroupIODevice          string   `json:"cgroup_io_device"`
+	CgroupIOReadBytes       int64    `json:"cgroup_io_read_bps"`
+	CgroupIOWriteBytes      int64    `json:"cgroup_io_write_bps"`
+	NoiseDiskPath           string   `json:"noise_disk_path"`
+	NoiseDiskBytes          int64    `json:"noise_disk_bytes_per_second"`
+	NoiseDiskSyncInterval   float64  `json:"noise_disk_sync_interval"`
+	NoiseCPUs               float64  `json:"noise_cpus"`
+	NoiseMemoryBytes        int64    `json:"noise_memory_bytes"`
+	AbortErrorRate          float64  `json:"abort_error_rate"`
+	AbortMinImages          int      `json:"abort_min_images"`
+	SLOs                    []string `json:"slos"`
+	Format                  string   `json:"format"`
+}
+
+// Environment describes the host a benchmark was run on
+type Environment struct {
+	Hostname      string `json:"hostname"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	KernelVersion string `json:"kernel_version"`
+	NumCPU        int    `json:"num_cpu"`
+	MemoryBytes   uint64 `json:"memory_bytes"`
+}
+
+// StoreInfo describes the filesystem the store lives on
+type StoreInfo struct {
+	MountPoint     string `json:"mount_point"`
+	FilesystemType string `json:"filesystem_type"`
+	MountOptions   string `json:"mount_options"`
+}
+
+// CollectRunInfo gathers the details of the host, store and grootfs binary.
+// Anything that cannot be found out is left empty rather than failing the run.
+func CollectRunInfo(runner commandrunner.CommandRunner, config RunConfig) RunInfo {
+	return RunInfo{
+		ID:             newRunID(),
+		StartedAt:      time.Now().UTC(),
+		GrootFSVersion: grootfsVersion(runner, config.GrootFSBinPath),
+		Config:         config,
+		Environment:    CurrentEnvironment(),
+		Store:          storeInfo(config.StorePath),
+	}
+}
+
+func CurrentEnvironment() Environment {
+	hostname, _ := os.Hostname()
+
+	return Environment{
+		Hostname:      hostname,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		KernelVersion: kernelVersion(),
+		NumCPU:        runtime.NumCPU(),
+		MemoryBytes:   totalMemory(),
+	}
+}
+
+func grootfsVersion(runner commandrunner.CommandRunner, grootfsBinPath string) string {
+	buffer := bytes.NewBuffer([]byte{})
+	cmd := exec.Command(grootfsBinPath, "--version")
+	cmd.Stdout = buffer
+	if err := runner.Run(cmd); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(buffer.String())
+}
+
+func kernelVersion() string {
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(release))
+}
+
+func totalMemory() uint64 {
+	meminfo, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer meminfo.Close()
+
+	scanner := bufio.NewScanner(meminfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+
+	return 0
+}
+
+// storeInfo finds the mount the store path belongs to. The store may not
+// exist yet, in which case the closest existing parent is used.
+func storeInfo(storePath string) StoreInfo {
+	path, err := filepath.Abs(storePath)
+	if err != nil {
+		return StoreInfo{}
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	mounts, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return StoreInfo{}
+	}
+	defer mounts.Close()
+
+	info := StoreInfo{}
+	scanner := bufio.NewScanner(mounts)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		mountPoint := unescapeMountPath(fields[1])
+		if !isPathUnder(path, mountPoint) || len(mountPoint) < len(info.MountPoint) {
+			continue
+		}
+
+		// later entries shadow earlier ones on the same mount point
+		info = StoreInfo{
+			MountPoint:     mountPoint,
+			FilesystemType: fields[2],
+			MountOptions:   fields[3],
+		}
+	}
+
+	return info
+}
+
+func isPathUnder(path, dir string) bool {
+	if dir == "/" || path == dir {
+		return true
+	}
+
+	return strings.HasPrefix(path, dir+"/")
+}
+
+// unescapeMountPath decodes the octal escapes used in /proc/self/mounts
+func unescapeMountPath(path string) string {
+	for _, escaped := range []string{`\040`, `\011`, `\012`, `\134`} {
+		code, _ := strconv.ParseUint(escaped[1:], 8, 8)
+		path = strings.Replace(path, escaped, string(rune(code)), -1)
+	}
+
+	return path
+}
+
+func newRunID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,97 @@
+package bench_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunInfo", func() {
+	Describe("CollectRunInfo", func() {
+		var (
+			fakeCmdRunner *fake_command_runner.FakeCommandRunner
+			config        bench.RunConfig
+			storePath     string
+		)
+
+		BeforeEach(func() {
+			var err error
+			storePath, err = ioutil.TempDir("", "store")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeCmdRunner = fake_command_runner.New()
+			fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "/path/to/grootfs",
+				Args: []string{"--version"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("grootfs version 0.16.0\n"))
+				return nil
+			})
+
+			config = bench.RunConfig{
+				GrootFSBinPath: "/path/to/grootfs",
+				StorePath:      filepath.Join(storePath, "not-there-yet"),
+				Driver:         "btrfs",
+				BaseImages:     []string{"docker:///busybox"},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(storePath)).To(Succeed())
+		})
+
+		It("keeps the configuration", func() {
+			info := bench.CollectRunInfo(fakeCmdRunner, config)
+			Expect(info.Config).To(Equal(config))
+		})
+
+		It("generates a unique id and records the start time", func() {
+			info := bench.CollectRunInfo(fakeCmdRunner, config)
+			other := bench.CollectRunInfo(fakeCmdRunner, config)
+
+			Expect(info.ID).To(HaveLen(16))
+			Expect(info.ID).NotTo(Equal(other.ID))
+			Expect(info.StartedAt).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("records the grootfs version", func() {
+			info := bench.CollectRunInfo(fakeCmdRunner, config)
+			Expect(info.GrootFSVersion).To(Equal("grootfs version 0.16.0"))
+		})
+
+		It("describes the host", func() {
+			info := bench.CollectRunInfo(fakeCmdRunner, config)
+			Expect(info.Environment.NumCPU).To(Equal(runtime.NumCPU()))
+			Expect(info.Environment.OS).To(Equal(runtime.GOOS))
+			Expect(info.Environment.KernelVersion).NotTo(BeEmpty())
+			Expect(info.Environment.MemoryBytes).To(BeNumerically(">", 0))
+		})
+
+		It("describes the filesystem of the closest existing store parent", func() {
+			info := bench.CollectRunInfo(fakeCmdRunner, config)
+			Expect(info.Store.MountPoint).NotTo(BeEmpty())
+			Expect(info.Store.FilesystemType).NotTo(BeEmpty())
+			Expect(info.Store.MountOptions).NotTo(BeEmpty())
+		})
+
+		Context("when grootfs --version fails", func() {
+			It("leaves the version empty", func() {
+				config.GrootFSBinPath = "/not/grootfs"
+				fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/not/grootfs"}, func(cmd *exec.Cmd) error {
+					return exec.ErrNotFound
+				})
+
+				info := bench.CollectRunInfo(fakeCmdRunner, config)
+				Expect(info.GrootFSVersion).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,46 @@
+package bench
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SchemaVersion is the version of the json summary format published in
+// schema/summary-v<version>.json. It is bumped on any change that is not
+// adding a field.
+const SchemaVersion = 1
+
+// summaryFields has the fields of Summary without its json methods
+type summaryFields Summary
+
+// summaryJSON shadows the fields whose json encoding differs from their Go
+// type
+type summaryJSON struct {
+	SchemaVersion int `json:"schema_version"`
+	summaryFields
+	TotalDuration float64 `json:"total_duration"`
+}
+
+func (s Summary) MarshalJSON() ([]byte, error) {
+	if s.ErrorMessages == nil {
+		s.ErrorMessages = []string{}
+	}
+
+	return json.Marshal(summaryJSON{
+		SchemaVersion: SchemaVersion,
+		summaryFields: summaryFields(s),
+		TotalDuration: s.TotalDuration.Seconds(),
+	})
+}
+
+func (s *Summary) UnmarshalJSON(data []byte) error {
+	var decoded summaryJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*s = Summary(decoded.summaryFields)
+	s.TotalDuration = time.Duration(decoded.TotalDuration * float64(time.Second))
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package bench_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Summary json schema", func() {
+	var (
+		schema  map[string]interface{}
+		summary bench.Summary
+	)
+
+	BeforeEach(func() {
+		contents, err := ioutil.ReadFile(fmt.Sprintf("../schema/summary-v%d.json", bench.SchemaVersion))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(contents, &schema)).To(Succeed())
+
+		summary = bench.Summary{
+			TotalDuration:     1500 * time.Millisecond,
+			ImagesPerSecond:   2,
+			TotalImages:       3,
+			TotalErrorsAmt:    1,
+			ConcurrencyFactor: 1,
+			ErrorMessages:     []string{"could not create image 1: o noes\n"},
+			RunInfo: bench.RunInfo{
+				ID:        "1234",
+				StartedAt: time.Date(2017, 4, 24, 14, 20, 0, 0, time.UTC),
+				Config:    bench.RunConfig{BaseImages: []string{"docker:///busybox"}},
+			},
+		}
+	})
+
+	It("describes the output of the json printer", func() {
+		stats := bench.NewLatencyStats([]time.Duration{time.Second}, 0)
+		summary.Lifecycle = &bench.LifecycleSummary{Create: stats}
+		summary.Teardown = &bench.TeardownSummary{Delete: stats, ErrorMessages: []string{}}
+		summary.Commands = []bench.CommandSummary{
+			{Command: "stats", Latency: stats, Samples: []bench.CommandSample{{LiveImages: 2, Duration: 1, Cgroup: &bench.CgroupStats{CPUUsage: 0.5}}, {Error: "o noes"}}},
+		}
+		summary.Quotas = []bench.QuotaSummary{{SizeBytes: 1024, Latency: stats}}
+		summary.BaseImages = []bench.BaseImageSummary{{BaseImage: "docker:///busybox", Weight: 80, Images: 4, Share: 0.8, Latency: stats}}
+		summary.Cache = &bench.CacheSummary{Mode: bench.CacheCold, Prepare: stats, ErrorMessages: []string{}}
+		summary.Store = &bench.StoreSummary{Initialized: true, ErrorMessages: []string{}}
+		summary.Registry = &bench.RegistrySummary{Address: "127.0.0.1:5000", Requests: 3}
+		summary.Noise = []bench.NoiseSummary{{Kind: bench.NoiseDisk, Target: 1024, Achieved: 1000, Syncs: 2}, {Kind: bench.NoiseCPU, Error: "o noes"}}
+		summary.Images = []bench.ImageSummary{
+			{BaseImage: "docker:///busybox", Duration: 1, RootFSPath: "/store/images/1/rootfs", Mounts: []bench.Mount{{Destination: "/", Type: "overlay", Source: "overlay", Options: []string{"ro"}}}},
+			{BaseImage: "docker:///busybox", Duration: 2, Error: "o noes"},
+		}
+		summary.Aborted = "error rate 50.00% over 20.00% after 10 images"
+		summary.Cgroup = &bench.CgroupSummary{Version: 2, Limits: bench.CgroupLimits{CPUs: 0.5}, Commands: 4, CgroupStats: bench.CgroupStats{MemoryPeakBytes: 1024}, ErrorMessages: []string{"could not remove cgroup command-1: busy\n"}}
+		buffer := gbytes.NewBuffer()
+		Expect(bench.NewJsonPrinter(buffer, gbytes.NewBuffer()).Print(summary)).To(Succeed())
+
+		var output interface{}
+		Expect(json.Unmarshal(buffer.Contents(), &output)).To(Succeed())
+		Expect(validateSchema(schema, output, "")).To(BeEmpty())
+	})
+
+	It("rejects output that does not follow it", func() {
+		var output map[string]interface{}
+		encoded, err := json.Marshal(summary)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(encoded, &output)).To(Succeed())
+
+		delete(output, "total_images")
+		output["total_duration"] = "1.5s"
+		output["bananas"] = 1
+
+		Expect(validateSchema(schema, output, "")).To(ConsistOf(
+			"/: missing required property `total_images`",
+			"/: unexpected property `bananas`",
+			"/total_duration: expected number, got string",
+		))
+	})
+
+	It("encodes the schema version, the errors and durations in seconds", func() {
+		encoded, err := json.Marshal(summary)
+		Expect(err).NotTo(HaveOccurred())
+
+		var output map[string]interface{}
+		Expect(json.Unmarshal(encoded, &output)).To(Succeed())
+		Expect(output["schema_version"]).To(BeNumerically("==", bench.SchemaVersion))
+		Expect(output["total_duration"]).To(BeNumerically("==", 1.5))
+		Expect(output["error_messages"]).To(ConsistOf("could not create image 1: o noes\n"))
+	})
+
+	It("decodes what it encodes", func() {
+		encoded, err := json.Marshal(summary)
+		Expect(err).NotTo(HaveOccurred())
+
+		var decoded bench.Summary
+		Expect(json.Unmarshal(encoded, &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(summary))
+	})
+})
+
+// validateSchema checks a decoded json value against the subset of JSON
+// Schema used by schema/summary-v*.json, returning one message per violation
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	return validateSchemaNode(schema, schema, value, path)
+}
+
+func validateSchemaNode(root, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		definitions := root["definitions"].(map[string]interface{})
+		schema = definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	}
+
+	location := path
+	if location == "" {
+		location = "/"
+	}
+
+	if types, ok := schema["type"]; ok {
+		allowed := []interface{}{types}
+		if list, ok := types.([]interface{}); ok {
+			allowed = list
+		}
+
+		matched := false
+		for _, t := range allowed {
+			if jsonTypeMatches(t.(string), value) {
+				matched = true
+			}
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: expected %v, got %s", location, types, jsonTypeOf(value))}
+		}
+	}
+
+	if expected, ok := schema["const"]; ok && expected != value {
+		return []string{fmt.Sprintf("%s: expected %v, got %v", location, expected, value)}
+	}
+
+	if allowed, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, expected := range allowed {
+			matched = matched || expected == value
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: expected one of %v, got %v", location, allowed, value)}
+		}
+	}
+
+	errors := []string{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				errors = append(errors, fmt.Sprintf("%s: missing required property `%s`", location, name))
+			}
+		}
+
+		names := []string{}
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					errors = append(errors, fmt.Sprintf("%s: unexpected property `%s`", location, name))
+				}
+				continue
+			}
+			errors = append(errors, validateSchemaNode(root, propertySchema, v[name], path+"/"+name)...)
+		}
+
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				errors = append(errors, validateSchemaNode(root, items, item, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+
+	case string:
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				errors = append(errors, fmt.Sprintf("%s: expected date-time, got %q", location, v))
+			}
+		}
+	}
+
+	return errors
+}
+
+func jsonTypeMatches(t string, value interface{}) bool {
+	if t == "integer" {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+
+	return jsonTypeOf(value) == t
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,194 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSLOs are checked unless an SLO is given on their metric: any
+// failure fails the run
+var DefaultSLOs = []string{"total_errors_amt=0"}
+
+// sloOperators is ordered so two-char operators are matched first
+var sloOperators = []string{"<=", ">=", "==", "!=", "<", ">", "="}
+
+// sloAliases are short names accepted for summary metrics
+var sloAliases = map[string]string{
+	"p50": "latency_p50",
+	"p90": "latency_p90",
+	"p95": "latency_p95",
+	"p99": "latency_p99",
+	"max": "latency_max",
+}
+
+// sloSuccessMetrics are measured on the images created successfully only:
+// without any, the latencies are -1 and the throughput 0, which must not
+// pass an objective
+var sloSuccessMetrics = map[string]bool{
+	"latency_p50":            true,
+	"latency_p90":            true,
+	"latency_p95":            true,
+	"latency_p99":            true,
+	"latency_max":            true,
+	"average_time_per_image": true,
+	"images_per_second":      true,
+}
+
+// SLO is a threshold a summary metric must meet, e.g. `error_rate=0`,
+// `p95<3s` or `images_per_second>2`
+type SLO struct {
+	Metric    string
+	Operator  string
+	Threshold float64
+}
+
+func ParseSLO(expression string) (SLO, error) {
+	for _, operator := range sloOperators {
+		idx := strings.Index(expression, operator)
+		if idx == -1 {
+			continue
+		}
+
+		metric := strings.TrimSpace(expression[:idx])
+		if alias, ok := sloAliases[metric]; ok {
+			metric = alias
+		}
+		if metric == "" {
+			return SLO{}, fmt.Errorf("invalid slo `%s`: missing metric", expression)
+		}
+
+		threshold, err := parseThreshold(strings.TrimSpace(expression[idx+len(operator):]))
+		if err != nil {
+			return SLO{}, fmt.Errorf("invalid slo `%s`: %s", expression, err)
+		}
+
+		if operator == "==" {
+			operator = "="
+		}
+
+		return SLO{Metric: metric, Operator: operator, Threshold: threshold}, nil
+	}
+
+	return SLO{}, fmt.Errorf("invalid slo `%s`: expected <metric><operator><value>, e.g. error_rate=0", expression)
+}
+
+func ParseSLOs(expressions []string) ([]SLO, error) {
+	slos := []SLO{}
+	for _, expression := range expressions {
+		slo, err := ParseSLO(expression)
+		if err != nil {
+			return nil, err
+		}
+		slos = append(slos, slo)
+	}
+
+	return slos, nil
+}
+
+// WithDefaultSLOs adds the DefaultSLOs to the expressions, except those on a
+// metric the expressions already check
+func WithDefaultSLOs(expressions []string) []string {
+	checked := map[string]bool{}
+	for _, expression := range expressions {
+		if slo, err := ParseSLO(expression); err == nil {
+			checked[slo.Metric] = true
+		}
+	}
+
+	withDefaults := append([]string{}, expressions...)
+	for _, expression := range DefaultSLOs {
+		slo, err := ParseSLO(expression)
+		if err != nil || !checked[slo.Metric] {
+			withDefaults = append(withDefaults, expression)
+		}
+	}
+
+	return withDefaults
+}
+
+// parseThreshold accepts plain numbers and durations, which are converted to
+// seconds to match the latency metrics
+func parseThreshold(value string) (float64, error) {
+	if threshold, err := strconv.ParseFloat(value, 64); err == nil {
+		return threshold, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("`%s` is neither a number nor a duration", value)
+	}
+
+	return duration.Seconds(), nil
+}
+
+func (s SLO) String() string {
+	return fmt.Sprintf("%s %s %s", s.Metric, s.Operator, strconv.FormatFloat(s.Threshold, 'f', -1, 64))
+}
+
+// SLOResult is the outcome of checking an SLO against a summary
+type SLOResult struct {
+	SLO    SLO
+	Value  float64
+	Passed bool
+	Err    error
+}
+
+func (r SLOResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s: %s", r.SLO, r.Err)
+	}
+
+	return fmt.Sprintf("%s (was %.3f)", r.SLO, r.Value)
+}
+
+func (s SLO) Check(summary Summary) SLOResult {
+	value, err := MetricValue(summary, s.Metric)
+	if err != nil {
+		return SLOResult{SLO: s, Err: err}
+	}
+	if sloSuccessMetrics[s.Metric] && summary.TotalImages == summary.TotalErrorsAmt {
+		return SLOResult{SLO: s, Value: value, Err: errors.New("no image was created successfully")}
+	}
+
+	var passed bool
+	switch s.Operator {
+	case "<":
+		passed = value < s.Threshold
+	case "<=":
+		passed = value <= s.Threshold
+	case ">":
+		passed = value > s.Threshold
+	case ">=":
+		passed = value >= s.Threshold
+	case "=":
+		passed = value == s.Threshold
+	case "!=":
+		passed = value != s.Threshold
+	}
+
+	return SLOResult{SLO: s, Value: value, Passed: passed}
+}
+
+func CheckSLOs(summary Summary, slos []SLO) []SLOResult {
+	results := []SLOResult{}
+	for _, slo := range slos {
+		results = append(results, slo.Check(summary))
+	}
+
+	return results
+}
+
+// FailedSLOs returns the results of the SLOs the summary does not meet
+func FailedSLOs(results []SLOResult) []SLOResult {
+	failed := []SLOResult{}
+	for _, result := range results {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,109 @@
+package bench_test
+
+import (
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SLO", func() {
+	Describe("ParseSLO", func() {
+		DescribeTable("parses metric, operator and threshold",
+			func(expression string, expected bench.SLO) {
+				slo, err := bench.ParseSLO(expression)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(slo).To(Equal(expected))
+			},
+			Entry("equality", "error_rate=0", bench.SLO{Metric: "error_rate", Operator: "=", Threshold: 0}),
+			Entry("double equals", "error_rate == 0", bench.SLO{Metric: "error_rate", Operator: "=", Threshold: 0}),
+			Entry("greater than", "images_per_second>2", bench.SLO{Metric: "images_per_second", Operator: ">", Threshold: 2}),
+			Entry("less or equal", "average_time_per_image <= 1.5", bench.SLO{Metric: "average_time_per_image", Operator: "<=", Threshold: 1.5}),
+			Entry("durations in seconds", "latency_p99<1500ms", bench.SLO{Metric: "latency_p99", Operator: "<", Threshold: 1.5}),
+			Entry("percentile aliases", "p95 < 3s", bench.SLO{Metric: "latency_p95", Operator: "<", Threshold: 3}),
+		)
+
+		DescribeTable("rejects invalid expressions",
+			func(expression, message string) {
+				_, err := bench.ParseSLO(expression)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("no operator", "error_rate", "expected <metric><operator><value>"),
+			Entry("no metric", "<3", "missing metric"),
+			Entry("bad threshold", "p95<soon", "`soon` is neither a number nor a duration"),
+		)
+	})
+
+	Describe("Check", func() {
+		var summary bench.Summary
+
+		BeforeEach(func() {
+			summary = bench.Summary{TotalImages: 10, TotalErrorsAmt: 1, ErrorRate: 10, ImagesPerSecond: 3, LatencyP95: 2.5}
+		})
+
+		It("passes when the metric meets the threshold", func() {
+			slo, err := bench.ParseSLO("p95<3s")
+			Expect(err).NotTo(HaveOccurred())
+
+			result := slo.Check(summary)
+			Expect(result.Passed).To(BeTrue())
+			Expect(result.Value).To(Equal(2.5))
+		})
+
+		It("fails when the metric does not meet the threshold", func() {
+			slo, err := bench.ParseSLO("error_rate=0")
+			Expect(err).NotTo(HaveOccurred())
+
+			result := slo.Check(summary)
+			Expect(result.Passed).To(BeFalse())
+			Expect(result.String()).To(Equal("error_rate = 0 (was 10.000)"))
+		})
+
+		It("fails when the metric does not exist", func() {
+			slo, err := bench.ParseSLO("bananas>0")
+			Expect(err).NotTo(HaveOccurred())
+
+			result := slo.Check(summary)
+			Expect(result.Passed).To(BeFalse())
+			Expect(result.Err).To(MatchError("unknown metric `bananas`"))
+		})
+
+		DescribeTable("fails the latency and throughput metrics when no image was created",
+			func(expression string) {
+				slo, err := bench.ParseSLO(expression)
+				Expect(err).NotTo(HaveOccurred())
+
+				summary = bench.Summary{TotalImages: 2, TotalErrorsAmt: 2, ErrorRate: 100, AverageTimePerImage: -1, LatencyP95: -1, LatencyMax: -1}
+				result := slo.Check(summary)
+				Expect(result.Passed).To(BeFalse())
+				Expect(result.Err).To(MatchError("no image was created successfully"))
+			},
+			Entry("percentile", "p95<3s"),
+			Entry("max", "max<=10s"),
+			Entry("average", "average_time_per_image<1"),
+			Entry("throughput", "images_per_second<100"),
+		)
+	})
+
+	Describe("WithDefaultSLOs", func() {
+		It("keeps checking the errors", func() {
+			Expect(bench.WithDefaultSLOs([]string{"p95<3s"})).To(Equal([]string{"p95<3s", "total_errors_amt=0"}))
+			Expect(bench.WithDefaultSLOs(nil)).To(Equal(bench.DefaultSLOs))
+		})
+
+		It("lets the errors objective be overridden", func() {
+			Expect(bench.WithDefaultSLOs([]string{"total_errors_amt<=2", "p95<3s"})).To(Equal([]string{"total_errors_amt<=2", "p95<3s"}))
+		})
+	})
+
+	Describe("FailedSLOs", func() {
+		It("returns only the failed results", func() {
+			slos, err := bench.ParseSLOs([]string{"error_rate=0", "images_per_second>2", "total_errors_amt=0"})
+			Expect(err).NotTo(HaveOccurred())
+
+			failed := bench.FailedSLOs(bench.CheckSLOs(bench.Summary{TotalImages: 1, ErrorRate: 1, ImagesPerSecond: 3}, slos))
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].SLO.Metric).To(Equal("error_rate"))
+		})
+	})
+})
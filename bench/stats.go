@@ -0,0 +1,62 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// percentile returns the nearest-rank percentile p (0-100) of the given
+// durations in seconds, or -1 when there are none
+func percentile(durations []time.Duration, p float64) float64 {
+	if len(durations) == 0 {
+		return -1
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank].Seconds()
+}
+
+// LatencyStats summarizes the durations of a set of operations, in seconds.
+// Percentiles are -1 when no operation succeeded.
+type LatencyStats struct {
+	Count   int     `json:"count"`
+	Errors  int     `json:"errors"`
+	Average float64 `json:"average"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+func NewLatencyStats(durations []time.Duration, errors int) LatencyStats {
+	stats := LatencyStats{
+		Count:   len(durations),
+		Errors:  errors,
+		Average: -1,
+		P50:     percentile(durations, 50),
+		P90:     percentile(durations, 90),
+		P95:     percentile(durations, 95),
+		P99:     percentile(durations, 99),
+		Max:     percentile(durations, 100),
+	}
+
+	if len(durations) > 0 {
+		total := time.Duration(0)
+		for _, duration := range durations {
+			total += duration
+		}
+		stats.Average = total.Seconds() / float64(len(durations))
+	}
+
+	return stats
+}
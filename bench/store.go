@@ -0,0 +1,46 @@
+package bench
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// StoreSummary times the creation of the store before the run and its
+// destruction after it
+type StoreSummary struct {
+	SizeBytes      int64    `json:"size_bytes"`
+	Initialized    bool     `json:"initialized"`
+	InitDuration   float64  `json:"init_duration"`
+	Deleted        bool     `json:"deleted"`
+	DeleteDuration float64  `json:"delete_duration"`
+	ErrorMessages  []string `json:"error_messages"`
+}
+
+// InitStore runs grootfs init-store with the job's store and driver. A store
+// size makes grootfs create a backing file of that size for the store.
+func (j *Job) InitStore(storeSizeBytes int64) (time.Duration, error) {
+	args := append(j.grootfsArgs(CommandInitStore, ArgValues{}), j.mappingArgs()...)
+	if storeSizeBytes > 0 {
+		args = append(args, "--store-size-bytes", strconv.FormatInt(storeSizeBytes, 10))
+	}
+
+	start := time.Now()
+	if _, err := j.execute(exec.Command(j.GrootFSBinPath, args...)); err != nil {
+		return time.Since(start), fmt.Errorf("initializing store: %s", err)
+	}
+
+	return time.Since(start), nil
+}
+
+// DeleteStore runs grootfs delete-store, removing the store and its backing
+// file
+func (j *Job) DeleteStore() (time.Duration, error) {
+	start := time.Now()
+	if _, err := j.execute(exec.Command(j.GrootFSBinPath, j.grootfsArgs(CommandDeleteStore, ArgValues{})...)); err != nil {
+		return time.Since(start), fmt.Errorf("deleting store: %s", err)
+	}
+
+	return time.Since(start), nil
+}
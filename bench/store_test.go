@@ -0,0 +1,73 @@
+package bench_test
+
+import (
+	"errors"
+	"os/exec"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		job           *bench.Job
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+	)
+
+	BeforeEach(func() {
+		job = genericJob()
+		fakeCmdRunner = job.Runner.(*fake_command_runner.FakeCommandRunner)
+	})
+
+	Describe("InitStore", func() {
+		It("runs grootfs init-store", func() {
+			_, err := job.InitStore(0)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCmdRunner.ExecutedCommands()).To(HaveLen(1))
+			Expect(fakeCmdRunner.ExecutedCommands()[0].Args).To(Equal([]string{"/path/to/grootfs", "--store", "/store/path", "--log-level", "debug", "--driver", "btrfs", "init-store"}))
+		})
+
+		It("sets the size of the store", func() {
+			_, err := job.InitStore(1024)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCmdRunner.ExecutedCommands()[0].Args[7:]).To(Equal([]string{"init-store", "--store-size-bytes", "1024"}))
+		})
+
+		Context("when grootfs fails", func() {
+			It("returns an error", func() {
+				fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("store already initialized"))
+					return errors.New("exit status 1")
+				})
+
+				_, err := job.InitStore(0)
+				Expect(err).To(MatchError("initializing store: exit status 1, store already initialized"))
+			})
+		})
+	})
+
+	Describe("DeleteStore", func() {
+		It("runs grootfs delete-store", func() {
+			_, err := job.DeleteStore()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCmdRunner.ExecutedCommands()).To(HaveLen(1))
+			Expect(fakeCmdRunner.ExecutedCommands()[0].Args[7:]).To(Equal([]string{"delete-store"}))
+		})
+
+		Context("when grootfs fails", func() {
+			It("returns an error", func() {
+				fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					return errors.New("exit status 1")
+				})
+
+				_, err := job.DeleteStore()
+				Expect(err).To(MatchError(HavePrefix("deleting store: exit status 1")))
+			})
+		})
+	})
+})
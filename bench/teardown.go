@@ -0,0 +1,76 @@
+package bench
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// TeardownSummary times the deletion of the images left behind by a run and
+// the final clean
+type TeardownSummary struct {
+	Duration      float64      `json:"duration"`
+	Delete        LatencyStats `json:"delete"`
+	Clean         bool         `json:"clean"`
+	CleanDuration float64      `json:"clean_duration"`
+	ErrorMessages []string     `json:"error_messages"`
+}
+
+// teardown deletes the given images, as many at once as the job creates, and
+// then runs clean if asked to
+func (j *Job) teardown(images []string, clean bool) *TeardownSummary {
+	start := time.Now()
+	summary := &TeardownSummary{Clean: clean, ErrorMessages: []string{}}
+
+	concurrency := j.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	imageNames := make(chan string, len(images))
+	for _, imageName := range images {
+		imageNames <- imageName
+	}
+	close(imageNames)
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		durations []time.Duration
+		errors    int
+	)
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for imageName := range imageNames {
+				cmdStart := time.Now()
+				_, err := j.execute(exec.Command(j.GrootFSBinPath, append(j.grootfsArgs(CommandDelete, ArgValues{ImageName: imageName}), imageName)...))
+				duration := time.Since(cmdStart)
+
+				mutex.Lock()
+				if err != nil {
+					errors++
+					summary.ErrorMessages = append(summary.ErrorMessages, fmt.Sprintf("could not delete image `%s`: %s\n", imageName, err))
+				} else {
+					durations = append(durations, duration)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	summary.Delete = NewLatencyStats(durations, errors)
+
+	if clean {
+		cleanStart := time.Now()
+		if _, err := j.execute(exec.Command(j.GrootFSBinPath, j.grootfsArgs(CommandClean, ArgValues{})...)); err != nil {
+			summary.ErrorMessages = append(summary.ErrorMessages, fmt.Sprintf("could not clean the store: %s\n", err))
+		}
+		summary.CleanDuration = time.Since(cleanStart).Seconds()
+	}
+
+	summary.Duration = time.Since(start).Seconds()
+	return summary
+}
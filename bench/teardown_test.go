@@ -0,0 +1,127 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/fake_command_runner"
+	"code.cloudfoundry.org/grootfs-bench/bench"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Teardown", func() {
+	var (
+		executor      bench.JobExecutor
+		fakeCmdRunner *fake_command_runner.FakeCommandRunner
+		createJob     *bench.Job
+
+		mutex       sync.Mutex
+		created     []string
+		failDeletes bool
+	)
+
+	BeforeEach(func() {
+		created = []string{}
+		failDeletes = false
+		fakeCmdRunner = fake_command_runner.New()
+		fakeCmdRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+			if cmd.Args[7] == "create" {
+				mutex.Lock()
+				created = append(created, cmd.Args[len(cmd.Args)-1])
+				mutex.Unlock()
+			}
+			if cmd.Args[7] == "delete" && failDeletes {
+				return errors.New("exit status 1")
+			}
+			return nil
+		})
+
+		createJob = genericJob()
+		createJob.Command = "create"
+		createJob.Runner = fakeCmdRunner
+		createJob.TotalImages = 4
+		createJob.Concurrency = 2
+
+		executor = bench.JobExecutor{Jobs: []*bench.Job{createJob}, Teardown: true}
+	})
+
+	commands := func(command string) []string {
+		images := []string{}
+		for _, cmd := range fakeCmdRunner.ExecutedCommands() {
+			if cmd.Args[7] == command {
+				images = append(images, cmd.Args[len(cmd.Args)-1])
+			}
+		}
+		return images
+	}
+
+	It("deletes every image the run created", func() {
+		summary := executor.Run(context.Background())
+
+		Expect(commands("delete")).To(ConsistOf(created))
+		Expect(summary.Teardown.Delete.Count).To(Equal(4))
+		Expect(summary.Teardown.Delete.Errors).To(Equal(0))
+		Expect(summary.Teardown.Clean).To(BeFalse())
+		Expect(commands("clean")).To(BeEmpty())
+	})
+
+	It("runs a final clean when asked to", func() {
+		executor.TeardownClean = true
+		summary := executor.Run(context.Background())
+
+		Expect(commands("clean")).To(HaveLen(1))
+		Expect(summary.Teardown.Clean).To(BeTrue())
+	})
+
+	It("only deletes the images the parallel delete left behind", func() {
+		deleteRunner := fake_command_runner.New()
+		deleteJob := deleteJob()
+		deleteJob.Runner = deleteRunner
+		deleteJob.Interval = 0
+		deleteJob.DeleteStrategy = bench.DeleteKeepLive
+		deleteJob.KeepLive = 1
+		executor.Jobs = append(executor.Jobs, deleteJob)
+
+		summary := executor.Run(context.Background())
+
+		deletedInParallel := []string{}
+		for _, cmd := range deleteRunner.ExecutedCommands() {
+			deletedInParallel = append(deletedInParallel, cmd.Args[8])
+		}
+		Expect(append(deletedInParallel, commands("delete")...)).To(ConsistOf(created))
+		Expect(summary.Teardown.Delete.Count).To(Equal(len(commands("delete"))))
+	})
+
+	It("does not hang when the parallel delete is waiting for images", func() {
+		createJob.TotalImages = 0
+		executor.Jobs = append(executor.Jobs, deleteJob())
+
+		done := make(chan bench.Summary)
+		go func() { done <- executor.Run(context.Background()) }()
+		Eventually(done, 5*time.Second).Should(Receive())
+	})
+
+	Context("when deleting fails", func() {
+		It("reports the errors", func() {
+			failDeletes = true
+
+			summary := executor.Run(context.Background())
+			Expect(summary.Teardown.Delete.Errors).To(Equal(4))
+			Expect(summary.Teardown.ErrorMessages[0]).To(MatchRegexp("could not delete image `base-image-\\d+`: exit status 1"))
+		})
+	})
+
+	Context("when teardown is off", func() {
+		It("leaves the images alone", func() {
+			executor.Teardown = false
+			summary := executor.Run(context.Background())
+
+			Expect(commands("delete")).To(BeEmpty())
+			Expect(summary.Teardown).To(BeNil())
+		})
+	})
+})
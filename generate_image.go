@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	benchpkg "code.cloudfoundry.org/grootfs-bench/bench"
+	"github.com/urfave/cli"
+)
+
+var generateImageCommand = cli.Command{
+	Name:      "generate-image",
+	Usage:     "write a synthetic OCI image, usable as an oci:/// base image",
+	UsageText: "grootfs-bench generate-image --path <image-dir> [--tag <tag>] [--layers <n>] [--layer-size <size>] [--files-per-layer <n>] [--file-size-distribution <even|uniform|exponential>] [--hardlinks <n>] [--symlinks <n>] [--whiteouts <n>] [--seed <n>]",
+
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "directory of the OCI image layout, created if needed. Images with other tags already in it are kept",
+		},
+		cli.StringFlag{
+			Name:  "tag",
+			Usage: "tag of the image in the layout",
+			Value: "latest",
+		},
+		cli.IntFlag{
+			Name:  "layers",
+			Usage: "number of layers",
+			Value: 1,
+		},
+		cli.StringSliceFlag{
+			Name:  "layer-size",
+			Usage: "size of the files of a layer (e.g. 64M). Several sizes are used in turn for the layers (default: 10M)",
+		},
+		cli.IntFlag{
+			Name:  "files-per-layer",
+			Usage: "number of files in each layer",
+			Value: 100,
+		},
+		cli.StringFlag{
+			Name:  "file-size-distribution",
+			Usage: "how the size of a layer is split between its files: " + strings.Join(benchpkg.FileSizeDistributions, ", "),
+			Value: benchpkg.FileSizesEven,
+		},
+		cli.IntFlag{
+			Name:  "hardlinks",
+			Usage: "number of hardlinks to files of the layer in each layer",
+		},
+		cli.IntFlag{
+			Name:  "symlinks",
+			Usage: "number of symlinks to files of the layer in each layer",
+		},
+		cli.IntFlag{
+			Name:  "whiteouts",
+			Usage: "number of files of the previous layer each layer deletes",
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed of the file contents and sizes, the same seed giving the same image",
+		},
+	},
+
+	Action: func(ctx *cli.Context) error {
+		imagePath := ctx.String("path")
+		if imagePath == "" {
+			return cli.NewExitError("--path is required", 1)
+		}
+
+		layerSizes := []int64{}
+		expressions := ctx.StringSlice("layer-size")
+		if len(expressions) == 0 {
+			expressions = []string{"10M"}
+		}
+		for _, expression := range expressions {
+			size, err := benchpkg.ParseSize(expression)
+			if err != nil {
+				return cli.NewExitError(fmt.Sprintf("parsing layer size: %s", err), 1)
+			}
+			layerSizes = append(layerSizes, size)
+		}
+
+		image, err := benchpkg.GenerateOCIImage(imagePath, benchpkg.OCIImageSpec{
+			Tag:                  ctx.String("tag"),
+			Layers:               ctx.Int("layers"),
+			LayerSizes:           layerSizes,
+			FilesPerLayer:        ctx.Int("files-per-layer"),
+			FileSizeDistribution: ctx.String("file-size-distribution"),
+			Hardlinks:            ctx.Int("hardlinks"),
+			Symlinks:             ctx.Int("symlinks"),
+			Whiteouts:            ctx.Int("whiteouts"),
+			Seed:                 ctx.Int64("seed"),
+		})
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Fprintf(os.Stdout, "Base image............: %s\n", image.BaseImage())
+		fmt.Fprintf(os.Stdout, "Manifest..............: %s\n", image.ManifestDigest)
+		for n, layer := range image.Layers {
+			label := fmt.Sprintf("Layer %d", n)
+			fmt.Fprintf(os.Stdout, "%s%s: %s (%d files, %s)\n", label, strings.Repeat(".", 22-len(label)), layer.Digest, layer.Files, benchpkg.FormatSize(layer.Size))
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+
+	benchpkg "code.cloudfoundry.org/grootfs-bench/bench"
+	"github.com/urfave/cli"
+)
+
+var historyCommand = cli.Command{
+	Name:      "history",
+	Usage:     "list past runs recorded in a history file",
+	UsageText: "grootfs-bench history --file <history-file> [--driver <driver>] [--image <docker:///img>] [--commit <sha>] [--cache-mode <cold|warm>] [--metric <name>]",
+
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "file",
+			Usage: "path to the results history file",
+		},
+		cli.StringFlag{
+			Name:  "driver",
+			Usage: "only show runs using this filesystem driver",
+		},
+		cli.StringFlag{
+			Name:  "image",
+			Usage: "only show runs using this base image",
+		},
+		cli.StringFlag{
+			Name:  "commit",
+			Usage: "only show runs of this grootfs commit (prefixes are accepted)",
+		},
+		cli.StringFlag{
+			Name:  "cache-mode",
+			Usage: "only show runs using this cache mode",
+		},
+		cli.StringFlag{
+			Name:  "metric",
+			Usage: "show the trend of this summary metric (e.g. images_per_second)",
+		},
+	},
+
+	Action: func(ctx *cli.Context) error {
+		historyPath := ctx.String("file")
+		if historyPath == "" {
+			return cli.NewExitError("--file is required", 1)
+		}
+
+		filter := benchpkg.HistoryFilter{
+			Driver:    ctx.String("driver"),
+			Image:     ctx.String("image"),
+			Commit:    ctx.String("commit"),
+			CacheMode: ctx.String("cache-mode"),
+		}
+
+		records, err := benchpkg.NewHistory(historyPath).Records(filter)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if metric := ctx.String("metric"); metric != "" {
+			err = benchpkg.PrintTrend(os.Stdout, records, metric)
+		} else {
+			err = benchpkg.PrintHistory(os.Stdout, records)
+		}
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		return nil
+	},
+}
@@ -2,7 +2,12 @@ package integration_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
 
 	"code.cloudfoundry.org/grootfs-bench/bench"
 
@@ -23,15 +28,69 @@ var _ = Describe("Bench", func() {
 		Expect(buffer).Should(gbytes.Say("Total images requested"))
 	})
 
-	Context("when --json is provided", func() {
+	Context("when --format json is provided", func() {
 		It("returns a json formatted summary", func() {
-			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "10", "--json", "--base-image", "docker:///busybox")
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "10", "--format", "json", "--base-image", "docker:///busybox")
 			out, err := cmd.Output()
 			Expect(err).NotTo(HaveOccurred())
 
-			var result bench.Result
-			err = json.Unmarshal(out, &result)
+			var summary bench.Summary
+			err = json.Unmarshal(out, &summary)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(summary.TotalImages).To(Equal(10))
+
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(out, &fields)).To(Succeed())
+			Expect(fields["schema_version"]).To(BeNumerically("==", bench.SchemaVersion))
+			Expect(fields["total_duration"]).To(BeNumerically("<", 60), "total_duration should be in seconds")
+		})
+
+		It("describes the run in the summary", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--format", "json", "--driver", "btrfs", "--base-image", "docker:///busybox")
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(out, &summary)).To(Succeed())
+			Expect(summary.RunInfo.ID).NotTo(BeEmpty())
+			Expect(summary.RunInfo.FinishedAt).To(BeTemporally(">=", summary.RunInfo.StartedAt))
+			Expect(summary.RunInfo.Config.Driver).To(Equal("btrfs"))
+			Expect(summary.RunInfo.Config.TotalImages).To(Equal(2))
+			Expect(summary.RunInfo.Config.BaseImages).To(Equal([]string{"docker:///busybox"}))
+		})
+	})
+
+	Context("when --format html is provided", func() {
+		It("returns an html report", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "10", "--format", "html", "--base-image", "docker:///busybox")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`<!DOCTYPE html>`))
+			Expect(buffer).To(gbytes.Say(`Total images requested</th><td>10</td>`))
+		})
+	})
+
+	Context("when --format csv is provided", func() {
+		It("returns a csv header and row", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "10", "--format", "csv", "--base-image", "docker:///busybox")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`total_images,concurrency_factor,`))
+			Expect(buffer).To(gbytes.Say(`10,5,false,false,`))
+		})
+	})
+
+	Context("when the format is unknown", func() {
+		It("fails with a helpful message", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--format", "yaml", "--base-image", "docker:///busybox")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("unknown format `yaml`"))
 		})
 	})
 
@@ -46,6 +105,274 @@ var _ = Describe("Bench", func() {
 		})
 	})
 
+	Context("when the run is over", func() {
+		It("deletes the images it created", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "3", "--base-image", "docker:///busybox", "--teardown-clean")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`Teardown delete\.*: avg \d+\.\d{3}s, p95 \d+\.\d{3}s, max \d+\.\d{3}s, errors 0`))
+			Expect(buffer).To(gbytes.Say(`Teardown clean\.*: \d+\.\d{3}s`))
+		})
+
+		It("tears down and prints the summary when interrupted", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--concurrency", "1", "--images", "1000", "--base-image", "slow-this")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(500 * time.Millisecond)
+			sess.Terminate()
+
+			Eventually(sess, 10).Should(gexec.Exit(1))
+			Expect(sess.Out).To(gbytes.Say("Total images requested"))
+			Expect(sess.Out).To(gbytes.Say(`Teardown delete`))
+			Expect(sess.Err).To(gbytes.Say("interrupted"))
+		})
+
+		It("leaves the images alone with --skip-teardown", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "3", "--base-image", "docker:///busybox", "--skip-teardown")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer.Contents()).NotTo(ContainSubstring("Teardown"))
+		})
+	})
+
+	Context("when --quota-size is provided", func() {
+		It("breaks the results down by quota size", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "4", "--base-image", "docker:///busybox", "--quota-size", "512M", "--quota-size", "1G")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`Using quota\?\.*: true`))
+			Expect(buffer).To(gbytes.Say(`Quota 512MiB\.*: avg \d+\.\d{3}s`))
+			Expect(buffer).To(gbytes.Say(`Quota 1GiB\.*: avg \d+\.\d{3}s`))
+		})
+
+		It("fails with a helpful message when a size is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--quota-size", "lots")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("parsing quota `lots`: invalid size `lots`"))
+		})
+	})
+
+	Context("when the base images are weighted", func() {
+		It("reports the mix of base images used", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "20", "--format", "json", "--base-image", "docker:///busybox=3", "--base-image", "docker:///ubuntu=1", "--base-image-seed", "1")
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(out, &summary)).To(Succeed())
+			Expect(summary.BaseImages).To(HaveLen(2))
+			Expect(summary.BaseImages[0].BaseImage).To(Equal("docker:///busybox"))
+			Expect(summary.BaseImages[0].Weight).To(Equal(3))
+			Expect(summary.BaseImages[0].Images + summary.BaseImages[1].Images).To(Equal(20))
+			Expect(summary.RunInfo.Config.BaseImages).To(Equal([]string{"docker:///busybox", "docker:///ubuntu"}))
+			Expect(summary.RunInfo.Config.BaseImageDistribution).To(Equal("weighted"))
+			Expect(summary.RunInfo.Config.BaseImageSeed).To(BeNumerically("==", 1))
+		})
+
+		It("fails with a helpful message when the distribution cannot use the weights", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox=3", "--base-image-distribution", "zipf")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("does not use weights"))
+		})
+	})
+
+	Context("when --cache-mode is provided", func() {
+		It("prepares the cache and reports the mode", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "4", "--concurrency", "2", "--base-image", "docker:///busybox", "--cache-mode", "cold")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`Cache mode\.*: cold`))
+			Expect(buffer).To(gbytes.Say(`Cache preparation\.*: avg \d+\.\d{3}s`))
+			Expect(buffer).To(gbytes.Say(`Total errors\.*: 0`))
+		})
+
+		It("fails with a helpful message when the mode is unknown", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--cache-mode", "tepid")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("unknown cache mode `tepid`"))
+		})
+	})
+
+	Context("when --rootless is provided", func() {
+		It("runs grootfs as that user and reports it", func() {
+			user := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--base-image", "docker:///busybox", "--rootless", user)
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`Rootless\?\.*: true`))
+			Expect(buffer).To(gbytes.Say(`Total errors\.*: 0`))
+		})
+
+		It("fails with a helpful message when a mapping is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--rootless", "1000:1000", "--uid-mapping", "0:1000")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("invalid mapping `0:1000`"))
+		})
+	})
+
+	Context("when extra grootfs args are provided", func() {
+		It("records them without passwords", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--base-image", "docker:///busybox",
+				"--grootfs-arg", "--config=/etc/grootfs.yml", "--command-arg", "create:--username=me", "--command-arg", "create:--password=secret", "--command-arg", "create:--label={{.Index}}", "--format", "json")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(buffer.Contents(), &summary)).To(Succeed())
+			Expect(summary.TotalErrorsAmt).To(Equal(0))
+			Expect(summary.RunInfo.Config.GrootFSArgs).To(Equal([]string{"--config=/etc/grootfs.yml"}))
+			Expect(summary.RunInfo.Config.CommandArgs).To(Equal([]string{"create:--username=me", "create:--password=<redacted>", "create:--label={{.Index}}"}))
+		})
+
+		It("fails with a helpful message when a template is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--command-arg", "create:{{.Nope}}")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("invalid arg `{{.Nope}}`"))
+		})
+	})
+
+	Context("when --parallel-command is provided", func() {
+		It("times the command while the images are created", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--base-image", "docker:///busybox", "--parallel-command", "list", "--parallel-command", "generate-volume-size-metadata --verbose", "--format", "json")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(buffer.Contents(), &summary)).To(Succeed())
+			Expect(summary.Commands).To(HaveLen(2))
+			Expect(summary.Commands[0].Command).To(Equal(bench.CommandList))
+			Expect(summary.Commands[1].Command).To(Equal(bench.Command("generate-volume-size-metadata")))
+			Expect(summary.Commands[1].ExtraArgs).To(Equal([]string{"--verbose"}))
+			Expect(summary.Commands[0].Latency.Count).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("when --init-store and --delete-store are provided", func() {
+		It("times the creation and destruction of the store", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--base-image", "docker:///busybox", "--init-store", "--store-size-bytes", "1073741824", "--delete-store", "--format", "json")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			var summary map[string]interface{}
+			Expect(json.Unmarshal(buffer.Contents(), &summary)).To(Succeed())
+			store := summary["store_lifecycle"].(map[string]interface{})
+			Expect(store["size_bytes"]).To(BeNumerically("==", 1073741824))
+			Expect(store["initialized"]).To(BeTrue())
+			Expect(store["deleted"]).To(BeTrue())
+			Expect(store["init_duration"]).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("when --verify-rootfs is provided", func() {
+		It("fails when the rootfs returned by grootfs does not exist", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--verify-rootfs")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit())
+			Expect(sess.ExitCode()).NotTo(Equal(0))
+
+			Expect(sess.Out).To(gbytes.Say(`Invalid rootfs\.*: 1`))
+			Expect(sess.Err).To(gbytes.Say("invalid rootfs `/var/lib/btrfs/image`"))
+		})
+	})
+
+	Context("when --lifecycle is provided", func() {
+		It("creates and deletes every image, timing each step", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "4", "--base-image", "docker:///busybox", "--lifecycle", "--lifecycle-dwell", "100ms")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`Total errors\.*: 0`))
+			Expect(buffer).To(gbytes.Say(`Lifecycle create\.*: avg \d+\.\d{3}s, p95 \d+\.\d{3}s, max \d+\.\d{3}s, errors 0`))
+			Expect(buffer).To(gbytes.Say(`Lifecycle dwell\.*: avg 0\.1\d{2}s`))
+			Expect(buffer).To(gbytes.Say(`Lifecycle delete\.*: avg`))
+			Expect(buffer).To(gbytes.Say(`Lifecycle total\.*: avg`))
+		})
+
+		It("reads the bytes to write as a size", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--lifecycle", "--lifecycle-write-bytes", "4K", "--format", "json")
+			// the fake rootfs cannot be written to, which fails the run
+			out, _ := cmd.Output()
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(out, &summary)).To(Succeed())
+			Expect(summary.RunInfo.Config.WriteBytes).To(Equal(int64(4096)))
+		})
+
+		It("fails with a helpful message when the bytes to write are invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--lifecycle", "--lifecycle-write-bytes", "lots")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("parsing --lifecycle-write-bytes: invalid size `lots`"))
+		})
+	})
+
+	Context("when --slo is provided", func() {
+		It("fails when an objective is not met", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--base-image", "docker:///busybox", "--slo", "error_rate=0", "--slo", "images_per_second>1000000")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say(`slo not met: images_per_second > 1000000`))
+		})
+
+		It("succeeds when the objectives are met, even with errors", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--concurrency", "1", "--images", "1", "--base-image", "fail-this", "--slo", "error_rate<=100", "--slo", "total_errors_amt<=1")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(0))
+		})
+
+		It("still fails on errors unless an objective is given on them", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--concurrency", "1", "--images", "1", "--base-image", "fail-this", "--slo", "error_rate<=100")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say(`slo not met: total_errors_amt = 0`))
+		})
+
+		It("fails the latency objectives when no image was created", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--concurrency", "1", "--images", "1", "--base-image", "fail-this", "--slo", "p95<3s", "--slo", "total_errors_amt<=1")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say(`slo not met: latency_p95 < 3: no image was created successfully`))
+		})
+
+		It("prints the objectives as junit test cases", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--base-image", "docker:///busybox", "--format", "junit", "--slo", "error_rate=0")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+			Expect(buffer).To(gbytes.Say(`<testcase name="error_rate = 0" classname="grootfs-bench.slo"`))
+		})
+	})
+
 	Context("when ParallelClean is True", func() {
 		It("runs delete and clean in parallel to create", func() {
 			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "10", "--base-image", "docker:///busybox", "--parallel-clean")
@@ -56,5 +383,307 @@ var _ = Describe("Bench", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(buffer).Should(gbytes.Say(`Parallel clean\?\.*: true`))
 		})
+
+		It("reports the delete strategy", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "10", "--base-image", "docker:///busybox", "--parallel-clean", "--delete-strategy", "lifo")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).Should(gbytes.Say(`Delete strategy\.*: lifo`))
+		})
+
+		Context("when the delete strategy is unknown", func() {
+			It("fails with a helpful message", func() {
+				cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--parallel-clean", "--delete-strategy", "banana")
+				sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(sess).Should(gexec.Exit(1))
+				Expect(sess.Err).To(gbytes.Say("unknown delete strategy `banana`"))
+			})
+		})
+	})
+
+	Context("when --history is provided", func() {
+		var historyFile string
+
+		BeforeEach(func() {
+			tmpDir, err := ioutil.TempDir("", "history")
+			Expect(err).NotTo(HaveOccurred())
+			historyFile = filepath.Join(tmpDir, "history.jsonl")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(filepath.Dir(historyFile))).To(Succeed())
+		})
+
+		It("records the run so it can be listed by the history command", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--driver", "btrfs", "--base-image", "docker:///busybox", "--history", historyFile, "--commit", "abcdef")
+			Expect(cmd.Run()).To(Succeed())
+
+			cmd = exec.Command(GrootFSBenchBin, "history", "--file", historyFile, "--driver", "btrfs")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+			Expect(buffer).To(gbytes.Say(`abcdef\s+btrfs\s+2\s+5`))
+
+			cmd = exec.Command(GrootFSBenchBin, "history", "--file", historyFile, "--metric", "error_rate")
+			buffer = gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+			Expect(buffer).To(gbytes.Say(`ERROR_RATE`))
+			Expect(buffer).To(gbytes.Say(`abcdef\s+0\.000`))
+		})
+	})
+
+	Context("when running generate-image", func() {
+		var imagePath string
+
+		BeforeEach(func() {
+			tmpDir, err := ioutil.TempDir("", "generate-image")
+			Expect(err).NotTo(HaveOccurred())
+			imagePath = filepath.Join(tmpDir, "image")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(filepath.Dir(imagePath))).To(Succeed())
+		})
+
+		It("writes an OCI image to use as base image", func() {
+			cmd := exec.Command(GrootFSBenchBin, "generate-image", "--path", imagePath, "--layers", "2", "--layer-size", "1M", "--files-per-layer", "10", "--whiteouts", "2")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`Base image\.*: oci://%s:latest`, imagePath))
+			Expect(buffer).To(gbytes.Say(`Layer 0\.*: sha256:[0-9a-f]{64} \(10 files, 1MiB\)`))
+			Expect(buffer).To(gbytes.Say(`Layer 1\.*: sha256:[0-9a-f]{64}`))
+			Expect(filepath.Join(imagePath, "index.json")).To(BeAnExistingFile())
+		})
+
+		It("fails with a helpful message when the layer size is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "generate-image", "--path", imagePath, "--layer-size", "huge")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("parsing layer size: invalid size `huge`"))
+		})
+	})
+
+	Context("when --registry is provided", func() {
+		var fixturesPath string
+
+		BeforeEach(func() {
+			var err error
+			fixturesPath, err = ioutil.TempDir("", "registry")
+			Expect(err).NotTo(HaveOccurred())
+
+			cmd := exec.Command(GrootFSBenchBin, "generate-image", "--path", filepath.Join(fixturesPath, "fixture"), "--layer-size", "64K", "--files-per-layer", "4")
+			Expect(cmd.Run()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(fixturesPath)).To(Succeed())
+		})
+
+		It("serves the fixtures while the images are created", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--format", "json", "--base-image", "docker://127.0.0.1:5000/fixture", "--registry", fixturesPath, "--registry-address", "127.0.0.1:0", "--registry-latency", "10ms")
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(out, &summary)).To(Succeed())
+			Expect(summary.Registry).NotTo(BeNil())
+			Expect(summary.Registry.Address).To(MatchRegexp(`^127\.0\.0\.1:\d+$`))
+			Expect(summary.RunInfo.Config.Registry).To(Equal(fixturesPath))
+			Expect(summary.RunInfo.Config.RegistryLatency).To(Equal(0.01))
+		})
+
+		It("fails with a helpful message when there are no fixtures", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--registry", filepath.Join(fixturesPath, "fixture", "blobs"))
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("no OCI image layout found"))
+		})
+
+		It("fails with a helpful message when the error rate is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--registry", fixturesPath, "--registry-error-rate", "2")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("registry error rate must be between 0 and 1"))
+		})
+	})
+
+	Context("when cgroup limits are provided", func() {
+		var cgroupRoot string
+
+		BeforeEach(func() {
+			var err error
+			cgroupRoot, err = ioutil.TempDir("", "cgroup")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(cgroupRoot, "cgroup.controllers"), []byte("cpu io memory"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(cgroupRoot)).To(Succeed())
+		})
+
+		It("runs every grootfs command in a cgroup and reports it", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--format", "json", "--base-image", "docker:///busybox", "--cgroup-root", cgroupRoot, "--cgroup-cpus", "0.5", "--cgroup-memory", "256M")
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(out, &summary)).To(Succeed())
+			Expect(summary.TotalErrorsAmt).To(Equal(0))
+			Expect(summary.Cgroup).NotTo(BeNil())
+			Expect(summary.Cgroup.Version).To(Equal(2))
+			Expect(summary.Cgroup.Commands).To(Equal(2))
+			Expect(summary.Cgroup.Limits.MemoryBytes).To(Equal(int64(256 << 20)))
+			Expect(summary.RunInfo.Config.Cgroup).To(BeTrue())
+			Expect(summary.RunInfo.Config.CgroupCPUs).To(Equal(0.5))
+
+			entries, err := ioutil.ReadDir(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2), "the cgroups of the run should be removed")
+		})
+
+		It("fails with a helpful message when an io limit has no device", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--cgroup-root", cgroupRoot, "--cgroup-io-write-bps", "10M")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("io limits need the <major>:<minor> device they apply to"))
+		})
+	})
+
+	Context("when noise is provided", func() {
+		var noisePath string
+
+		BeforeEach(func() {
+			var err error
+			noisePath, err = ioutil.TempDir("", "noise")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(noisePath)).To(Succeed())
+		})
+
+		It("loads the host during the run and reports the load achieved", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "2", "--format", "json", "--base-image", "docker:///busybox", "--noise-disk-rate", "1M", "--noise-disk-fsync-interval", "10ms", "--noise-disk-path", noisePath, "--noise-cpus", "0.5", "--noise-memory", "8M")
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(out, &summary)).To(Succeed())
+			Expect(summary.Noise).To(HaveLen(3))
+			Expect(summary.Noise[0].Kind).To(Equal(bench.NoiseDisk))
+			Expect(summary.Noise[0].Error).To(BeEmpty())
+			Expect(summary.Noise[0].Target).To(Equal(float64(1 << 20)))
+			Expect(summary.Noise[1].Kind).To(Equal(bench.NoiseCPU))
+			Expect(summary.Noise[2].Kind).To(Equal(bench.NoiseMemory))
+			Expect(summary.RunInfo.Config.NoiseDiskPath).To(Equal(noisePath))
+			Expect(summary.RunInfo.Config.NoiseMemoryBytes).To(Equal(int64(8 << 20)))
+
+			Expect(ioutil.ReadDir(noisePath)).To(BeEmpty())
+		})
+
+		It("fails with a helpful message when the noise has no load", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--noise-cpus", "0")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("the cpu noise must burn a positive number of CPUs"))
+		})
+	})
+
+	Context("when --abort-error-rate is provided", func() {
+		It("stops creating images once too many failed and fails", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--concurrency", "1", "--images", "50", "--base-image", "fail-this", "--abort-error-rate", "20", "--abort-min-images", "3", "--slo", "error_rate<=100", "--format", "json")
+			buffer := gbytes.NewBuffer()
+			sess, err := gexec.Start(cmd, buffer, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("aborted: error rate 100.00% over 20.00% after 3 images"))
+
+			var summary bench.Summary
+			Expect(json.Unmarshal(buffer.Contents(), &summary)).To(Succeed())
+			Expect(summary.TotalImages).To(Equal(3))
+			Expect(summary.Aborted).To(Equal("error rate 100.00% over 20.00% after 3 images"))
+			Expect(summary.RunInfo.Config.AbortErrorRate).To(Equal(20.0))
+			Expect(summary.RunInfo.Config.AbortMinImages).To(Equal(3))
+		})
+
+		It("fails with a helpful message when the rate is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--images", "1", "--base-image", "docker:///busybox", "--abort-error-rate", "100")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("the abort error rate must be between 0 and 100"))
+		})
+	})
+
+	Context("when --log-commands is provided", func() {
+		It("logs every command to stderr", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--nospin", "--concurrency", "1", "--images", "1", "--base-image", "docker:///busybox", "--command-arg", "create:--password=secret", "--log-commands")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(0))
+			Expect(sess.Err).To(gbytes.Say(`create started: .*--password=<redacted>.* docker:///busybox`))
+			Expect(sess.Err).To(gbytes.Say(`create completed in \d+\.\d{3}s`))
+		})
+	})
+
+	Context("when running matrix", func() {
+		var fixturesPath string
+
+		BeforeEach(func() {
+			var err error
+			fixturesPath, err = ioutil.TempDir("", "matrix")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(fixturesPath)).To(Succeed())
+		})
+
+		It("benchmarks every image shape", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--images", "2", "--concurrency", "1", "matrix", "--fixtures", fixturesPath, "--layers", "1..2", "--image-size", "4K,8K")
+			buffer := gbytes.NewBuffer()
+			cmd.Stdout = buffer
+			Expect(cmd.Run()).To(Succeed())
+
+			Expect(buffer).To(gbytes.Say(`1\s+4KiB\s+\d+\.\d{3}`))
+			Expect(buffer).To(gbytes.Say(`2\s+8KiB\s+\d+\.\d{3}`))
+			Expect(buffer).To(gbytes.Say(`LAYERS\s+4KiB\s+8KiB`))
+			Expect(filepath.Join(fixturesPath, "index.json")).To(BeAnExistingFile())
+		})
+
+		It("runs each shape with the global options", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--gbin", FakeGrootFS, "--images", "1", "--concurrency", "1", "--log-commands", "--quota-size", "512M", "matrix", "--fixtures", fixturesPath, "--layers", "1", "--image-size", "4K")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(0))
+			Expect(sess.Err).To(gbytes.Say(`create started: .*--disk-limit-size-bytes 536870912 .*layers-1-size-4KiB`))
+		})
+
+		It("fails with a helpful message when the global options are invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "--cache-mode", "lukewarm", "matrix", "--fixtures", fixturesPath, "--layers", "1", "--image-size", "4K")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("lukewarm"))
+		})
+
+		It("fails with a helpful message when a range is invalid", func() {
+			cmd := exec.Command(GrootFSBenchBin, "matrix", "--fixtures", fixturesPath, "--layers", "8..2")
+			sess, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess).Should(gexec.Exit(1))
+			Expect(sess.Err).To(gbytes.Say("`8..2` ends before it starts"))
+		})
 	})
 })
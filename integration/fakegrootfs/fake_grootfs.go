@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 func main() {
@@ -13,5 +14,9 @@ func main() {
 		os.Exit(1)
 	}
 
+	if baseImage == "slow-this" {
+		time.Sleep(100 * time.Millisecond)
+	}
+
 	fmt.Println("/var/lib/btrfs/image")
 }
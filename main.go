@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"code.cloudfoundry.org/commandrunner/linux_command_runner"
 	benchpkg "code.cloudfoundry.org/grootfs-bench/bench"
 	spinnerpkg "github.com/briandowns/spinner"
 	"github.com/urfave/cli"
@@ -55,19 +58,102 @@ func main() {
 		},
 		cli.StringSliceFlag{
 			Name:  "base-image",
-			Usage: "base image to use",
+			Usage: "base image to use, optionally weighted with a =<weight> suffix (e.g. docker:///cflinuxfs3=80 --base-image docker:///busybox=20)",
+		},
+		cli.StringFlag{
+			Name:  "base-image-distribution",
+			Usage: "how the base images are picked: " + strings.Join(benchpkg.BaseImageDistributions, ", ") + " (default: weighted when the base images have weights, round-robin otherwise)",
+		},
+		cli.Int64Flag{
+			Name:  "base-image-seed",
+			Usage: "seed of the weighted and zipf base image picks (default: current time)",
+		},
+		cli.Float64Flag{
+			Name:  "zipf-exponent",
+			Usage: "exponent of the zipf distribution, which picks the first base image most often, the second one less and so on. Must be greater than 1",
+			Value: benchpkg.DefaultZipfExponent,
 		},
 		cli.BoolFlag{
 			Name:  "with-quota",
 			Usage: "add quotas to the image creation",
 		},
+		cli.StringSliceFlag{
+			Name:  "quota-size",
+			Usage: "disk limit of the images (e.g. 512M, implies --with-quota). Several sizes are used in turn, or picked at random when weighted (e.g. 512M=3 --quota-size 1G=1)",
+		},
+		cli.Int64Flag{
+			Name:  "quota-seed",
+			Usage: "seed of the weighted quota picks (default: current time)",
+		},
+		cli.BoolFlag{
+			Name:  "exclude-image-from-quota",
+			Usage: "do not count the base image in the disk limit of the images",
+		},
+		cli.StringFlag{
+			Name:  "rootless",
+			Usage: "run grootfs as this <uid>:<gid> instead of root",
+		},
+		cli.StringSliceFlag{
+			Name:  "uid-mapping",
+			Usage: "uid mapping of the images and store, as <namespace id>:<host id>:<size> (default with --rootless: 0:<uid>:1 and " + benchpkg.DefaultSubIDRange + ")",
+		},
+		cli.StringSliceFlag{
+			Name:  "gid-mapping",
+			Usage: "gid mapping of the images and store, as <namespace id>:<host id>:<size> (default with --rootless: 0:<gid>:1 and " + benchpkg.DefaultSubIDRange + ")",
+		},
+		cli.StringFlag{
+			Name:  "cache-mode",
+			Usage: "cold: purge the layers with clean before each round of --concurrency images, deleting them after. warm: pull the layers before the run. Comparing the modes takes a run with each. (default: leave the store as it is)",
+		},
+		cli.BoolFlag{
+			Name:  "drop-caches",
+			Usage: "also drop the kernel page cache when purging the layers in cold cache mode",
+		},
+		cli.BoolFlag{
+			Name:  "verify-rootfs",
+			Usage: "check the rootfs returned by grootfs create exists and is not empty, counting it as a failure otherwise",
+		},
+		cli.StringSliceFlag{
+			Name:  "expect-file",
+			Usage: "file every rootfs must contain when verifying them (e.g. bin/sh)",
+		},
+		cli.BoolFlag{
+			Name:  "lifecycle",
+			Usage: "create, use and delete each image instead of only creating it",
+		},
+		cli.StringFlag{
+			Name:  "lifecycle-write-bytes",
+			Usage: "bytes written into the rootfs of each image in lifecycle mode (e.g. 64M)",
+		},
+		cli.DurationFlag{
+			Name:  "lifecycle-dwell",
+			Usage: "time each image is kept before being deleted in lifecycle mode (e.g. 5s)",
+		},
 		cli.BoolFlag{
 			Name:  "nospin",
 			Usage: "turn off the awesome spinner, you monster",
 		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "output format of the result: text, json, csv, markdown, html or junit",
+			Value: "text",
+		},
+		cli.StringSliceFlag{
+			Name:  "slo",
+			Usage: "objective the run must meet or it fails, e.g. error_rate=0, p95<3s, images_per_second>2; total_errors_amt=0 is checked unless given",
+		},
+		cli.Float64Flag{
+			Name:  "abort-error-rate",
+			Usage: "stop creating images, and fail, once more than this percent of them failed",
+		},
+		cli.IntFlag{
+			Name:  "abort-min-images",
+			Usage: "images to create before --abort-error-rate can stop the run",
+			Value: benchpkg.DefaultAbortMinImages,
+		},
 		cli.BoolFlag{
-			Name:  "json",
-			Usage: "return the result in json format",
+			Name:  "log-commands",
+			Usage: "log every grootfs command to stderr as it starts and completes",
 		},
 		cli.BoolFlag{
 			Name:  "parallel-clean",
@@ -76,99 +162,235 @@ func main() {
 		cli.IntFlag{
 			Name:  "parallel-clean-interval",
 			Usage: "interval at which to call clean during concurrent operations in seconds. parallel-clean must also be set",
-			Value: 6,
+			Value: benchpkg.DefaultCleanInterval,
 		},
 		cli.IntFlag{
 			Name:  "parallel-delete-interval",
 			Usage: "interval at which to call delete during concurrent operations in seconds. parallel-clean must also be set",
-			Value: 3,
+			Value: benchpkg.DefaultDeleteInterval,
+		},
+		cli.StringFlag{
+			Name:  "delete-strategy",
+			Usage: "order in which the parallel delete removes images: fifo, lifo, random or keep-live",
+			Value: benchpkg.DeleteFIFO,
+		},
+		cli.Int64Flag{
+			Name:  "delete-seed",
+			Usage: "seed of the random delete strategy (default: current time)",
+		},
+		cli.IntFlag{
+			Name:  "keep-live",
+			Usage: "number of images the keep-live delete strategy leaves alive, deleting the oldest ones above it",
+		},
+		cli.StringSliceFlag{
+			Name:  "grootfs-arg",
+			Usage: "extra global arg passed to every grootfs command (e.g. --config=/etc/grootfs.yml). {{.ImageName}}, {{.BaseImage}} and {{.Index}} are replaced with the values of each command",
+		},
+		cli.StringSliceFlag{
+			Name:  "command-arg",
+			Usage: "extra arg passed to a grootfs command, as <command>:<arg> (e.g. create:--insecure-registry=localhost:5000). Templated like --grootfs-arg",
+		},
+		cli.StringFlag{
+			Name:  "registry",
+			Usage: "serve the OCI image layouts in this directory (e.g. written by generate-image) from a local registry, as docker://<registry-address>/<layout directory>, and let grootfs pull from it",
+		},
+		cli.StringFlag{
+			Name:  "registry-address",
+			Usage: "address the local registry listens on",
+			Value: benchpkg.DefaultRegistryAddress,
+		},
+		cli.DurationFlag{
+			Name:  "registry-latency",
+			Usage: "delay added by the local registry to every request (e.g. 50ms)",
+		},
+		cli.StringFlag{
+			Name:  "registry-bandwidth",
+			Usage: "bytes per second the local registry sends at most, over all requests (e.g. 10M) (default: no limit)",
+		},
+		cli.Float64Flag{
+			Name:  "registry-error-rate",
+			Usage: "fraction of the manifest and blob requests the local registry fails (e.g. 0.05)",
+		},
+		cli.Int64Flag{
+			Name:  "registry-seed",
+			Usage: "seed of the local registry failures (default: current time)",
+		},
+		cli.BoolFlag{
+			Name:  "cgroup",
+			Usage: "run every grootfs command in a transient cgroup of its own and record the resources it used (implied by the cgroup limits)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-root",
+			Usage: "where the cgroup filesystem, v1 or v2, is mounted",
+			Value: benchpkg.DefaultCgroupRoot,
+		},
+		cli.Float64Flag{
+			Name:  "cgroup-cpus",
+			Usage: "CPUs each grootfs command may use (e.g. 0.5)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-memory",
+			Usage: "memory each grootfs command may use (e.g. 512M)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-io-device",
+			Usage: "<major>:<minor> of the block device the cgroup io limits apply to (e.g. 8:0)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-io-read-bps",
+			Usage: "bytes per second each grootfs command may read from --cgroup-io-device (e.g. 50M)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-io-write-bps",
+			Usage: "bytes per second each grootfs command may write to --cgroup-io-device (e.g. 50M)",
+		},
+		cli.StringFlag{
+			Name:  "noise-disk-rate",
+			Usage: "bytes per second written to disk in the background while the images are created (e.g. 20M)",
+		},
+		cli.DurationFlag{
+			Name:  "noise-disk-fsync-interval",
+			Usage: "interval at which the background disk writes are synced (e.g. 100ms) (default: never)",
+		},
+		cli.StringFlag{
+			Name:  "noise-disk-path",
+			Usage: "directory the background disk writes go to (default: the parent directory of the store)",
+		},
+		cli.Float64Flag{
+			Name:  "noise-cpus",
+			Usage: "CPUs kept busy in the background while the images are created (e.g. 1.5)",
+		},
+		cli.StringFlag{
+			Name:  "noise-memory",
+			Usage: "memory held in the background while the images are created (e.g. 2G)",
+		},
+		cli.StringSliceFlag{
+			Name:  "parallel-command",
+			Usage: "grootfs command, with its extra args, to run repeatedly during the run, e.g. stats, list or \"generate-volume-size-metadata --some-flag\"",
+		},
+		cli.IntFlag{
+			Name:  "parallel-command-interval",
+			Usage: "interval at which to run each parallel command in seconds",
+			Value: benchpkg.DefaultParallelCommandInterval,
+		},
+		cli.BoolFlag{
+			Name:  "skip-teardown",
+			Usage: "leave the images created by the run in the store instead of deleting them at the end",
+		},
+		cli.BoolFlag{
+			Name:  "teardown-clean",
+			Usage: "run grootfs clean after deleting the images at the end of the run",
+		},
+		cli.BoolFlag{
+			Name:  "init-store",
+			Usage: "create the store with grootfs init-store before the run",
+		},
+		cli.Int64Flag{
+			Name:  "store-size-bytes",
+			Usage: "size of the backing file of the store created by --init-store (default: grootfs decides)",
+		},
+		cli.BoolFlag{
+			Name:  "delete-store",
+			Usage: "destroy the store with grootfs delete-store after the run",
+		},
+		cli.StringFlag{
+			Name:  "history",
+			Usage: "path to a results history file the run is appended to",
+		},
+		cli.StringFlag{
+			Name:  "commit",
+			Usage: "grootfs commit being benchmarked, recorded in the history file",
 		},
 	}
 
+	bench.Commands = []cli.Command{
+		historyCommand,
+		generateImageCommand,
+		matrixCommand,
+	}
+
 	bench.Action = func(ctx *cli.Context) error {
-		storePath := ctx.String("store")
-		fsDriver := ctx.String("driver")
-		grootfsMetrics := ctx.Bool("enable-groot-metrics")
-		logLevel := ctx.String("log-level")
-		baseImages := ctx.StringSlice("base-image")
-		grootfs := ctx.String("gbin")
-		totalImagesAmt := ctx.Int("images")
-		concurrency := ctx.Int("concurrency")
-		withQuota := ctx.Bool("with-quota")
-		withParallelClean := ctx.Bool("parallel-clean")
-		parallelCleanInterval := ctx.Int("parallel-clean-interval")
-		parallelDeleteInterval := ctx.Int("parallel-delete-interval")
-		jsonify := ctx.Bool("json")
+		format := ctx.String("format")
+		sloExpressions := ctx.StringSlice("slo")
+		historyPath := ctx.String("history")
 		hasSpinner := !ctx.Bool("nospin")
 
+		sloExpressions = benchpkg.WithDefaultSLOs(sloExpressions)
+		slos, err := benchpkg.ParseSLOs(sloExpressions)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		options, err := benchmarkOptions(ctx)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		benchmark, err := benchpkg.NewBenchmark(options)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		printer, err := benchpkg.NewPrinter(format, slos, os.Stdout, os.Stderr)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
 		var spinner *spinnerpkg.Spinner
 		if hasSpinner {
 			now := time.Now().Format("15:04:05")
 			style := rand.New(rand.NewSource(time.Now().UnixNano())).Int() % 36
 			spinner = spinnerpkg.New(spinnerpkg.CharSets[style], 100*time.Millisecond)
-			spinner.Prefix = fmt.Sprintf("Doing crazy maths since %v (images: %d, conc: %d, parallel commands? %v) ", now, totalImagesAmt, concurrency, withParallelClean)
+			spinner.Prefix = fmt.Sprintf("Doing crazy maths since %v (images: %d, conc: %d, parallel commands? %v) ", now, options.Images, options.Concurrency, options.ParallelClean)
 			must(spinner.Color("green"))
 			spinner.Start()
 			defer spinner.Stop()
 		}
 
-		var printer benchpkg.Printer
-		printer = benchpkg.NewTextPrinter(os.Stdout, os.Stderr)
-		if jsonify {
-			printer = benchpkg.NewJsonPrinter(os.Stdout, os.Stderr)
-		}
-
-		cmdRunner := linux_command_runner.New()
-		executor := &benchpkg.JobExecutor{
-			Jobs: []*benchpkg.Job{
-				&benchpkg.Job{
-					Command:        "create",
-					Runner:         cmdRunner,
-					GrootFSBinPath: grootfs,
-					StorePath:      storePath,
-					Driver:         fsDriver,
-					MetricsEnabled: grootfsMetrics,
-					LogLevel:       logLevel,
-					UseQuota:       withQuota,
-					BaseImages:     baseImages,
-					Concurrency:    concurrency,
-					TotalImages:    totalImagesAmt,
-				},
-			},
-		}
-		if withParallelClean {
-			executor.Jobs = append(executor.Jobs,
-				&benchpkg.Job{
-					Command:        "clean",
-					Runner:         cmdRunner,
-					GrootFSBinPath: grootfs,
-					StorePath:      storePath,
-					Driver:         fsDriver,
-					MetricsEnabled: grootfsMetrics,
-					LogLevel:       logLevel,
-					Interval:       parallelCleanInterval,
-				})
-			executor.Jobs = append(executor.Jobs,
-				&benchpkg.Job{
-					Command:        "delete",
-					Runner:         cmdRunner,
-					GrootFSBinPath: grootfs,
-					StorePath:      storePath,
-					Driver:         fsDriver,
-					MetricsEnabled: grootfsMetrics,
-					LogLevel:       logLevel,
-					Interval:       parallelDeleteInterval,
-				})
-		}
-
-		summary := executor.Run()
-		summary.RanWithParallelClean = withParallelClean
+		runCtx, cancel := interruptContext()
+		defer cancel()
+		summary, err := benchmark.Run(runCtx)
+		if err != nil && err != runCtx.Err() {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		// an interrupted run still tore down its images, print what it got to
+		interrupted := err != nil
+
+		if spinner != nil {
+			spinner.Stop()
+		}
+		summary.RunInfo.Config.SLOs = sloExpressions
+		summary.RunInfo.Config.Format = format
 		if err := printer.Print(summary); err != nil {
 			return err
 		}
 
-		if summary.TotalErrorsAmt > 0 {
-			return fmt.Errorf("%s failed %d times\n", grootfs, summary.TotalErrorsAmt)
+		if interrupted {
+			return cli.NewExitError("interrupted", 1)
+		}
+
+		if historyPath != "" {
+			record := benchpkg.NewHistoryRecord(ctx.String("commit"), summary)
+			if err := benchpkg.NewHistory(historyPath).Append(record); err != nil {
+				return err
+			}
+		}
+
+		if summary.Store != nil && len(summary.Store.ErrorMessages) > 0 {
+			return cli.NewExitError("could not delete the store", 1)
+		}
+
+		if summary.Aborted != "" {
+			return cli.NewExitError("aborted: "+summary.Aborted, 1)
+		}
+
+		failed := benchpkg.FailedSLOs(benchpkg.CheckSLOs(summary, slos))
+		if len(failed) > 0 {
+			messages := []string{}
+			for _, result := range failed {
+				messages = append(messages, result.String())
+			}
+			return cli.NewExitError("slo not met: "+strings.Join(messages, ", "), 1)
 		}
 
 		return nil
@@ -179,6 +401,179 @@ func main() {
 	}
 }
 
+// benchmarkOptions reads the benchmark options from the global flags
+func benchmarkOptions(ctx *cli.Context) (benchpkg.Options, error) {
+	baseImages, baseImageWeights, err := benchpkg.ParseBaseImages(ctx.StringSlice("base-image"))
+	if err != nil {
+		return benchpkg.Options{}, err
+	}
+
+	parallelCommands := []benchpkg.ParallelCommand{}
+	for _, parallelCommand := range ctx.StringSlice("parallel-command") {
+		args := strings.Fields(parallelCommand)
+		if len(args) == 0 {
+			return benchpkg.Options{}, fmt.Errorf("parallel command cannot be empty")
+		}
+		parallelCommands = append(parallelCommands, benchpkg.ParallelCommand{Command: benchpkg.Command(args[0]), Args: args[1:]})
+	}
+
+	parsedCommandArgs, err := benchpkg.ParseCommandArgs(ctx.StringSlice("command-arg"))
+	if err != nil {
+		return benchpkg.Options{}, err
+	}
+	commandArgs := map[benchpkg.Command][]string{}
+	for command, args := range parsedCommandArgs {
+		commandArgs[benchpkg.Command(command)] = args
+	}
+
+	registryConfig := benchpkg.RegistryConfig{
+		Latency:   ctx.Duration("registry-latency"),
+		ErrorRate: ctx.Float64("registry-error-rate"),
+		Seed:      ctx.Int64("registry-seed"),
+	}
+	if bandwidth := ctx.String("registry-bandwidth"); bandwidth != "" {
+		registryConfig.BandwidthBytes, err = benchpkg.ParseSize(bandwidth)
+		if err != nil {
+			return benchpkg.Options{}, fmt.Errorf("parsing registry bandwidth: %s", err)
+		}
+	}
+	if !ctx.IsSet("registry-seed") {
+		registryConfig.Seed = time.Now().UnixNano()
+	}
+
+	cgroupLimits := benchpkg.CgroupLimits{
+		CPUs:     ctx.Float64("cgroup-cpus"),
+		IODevice: ctx.String("cgroup-io-device"),
+	}
+	var writeBytes, noiseDiskBytes, noiseMemoryBytes int64
+	for flag, size := range map[string]*int64{
+		"lifecycle-write-bytes": &writeBytes,
+		"cgroup-memory":         &cgroupLimits.MemoryBytes,
+		"cgroup-io-read-bps":    &cgroupLimits.IOReadBytes,
+		"cgroup-io-write-bps":   &cgroupLimits.IOWriteBytes,
+		"noise-disk-rate":       &noiseDiskBytes,
+		"noise-memory":          &noiseMemoryBytes,
+	} {
+		if value := ctx.String(flag); value != "" {
+			*size, err = benchpkg.ParseSize(value)
+			if err != nil {
+				return benchpkg.Options{}, fmt.Errorf("parsing --%s: %s", flag, err)
+			}
+		}
+	}
+
+	noises := []benchpkg.Noise{}
+	if ctx.IsSet("noise-disk-rate") {
+		noises = append(noises, benchpkg.Noise{Kind: benchpkg.NoiseDisk, Path: ctx.String("noise-disk-path"), BytesPerSecond: noiseDiskBytes, SyncInterval: ctx.Duration("noise-disk-fsync-interval")})
+	}
+	if ctx.IsSet("noise-cpus") {
+		noises = append(noises, benchpkg.Noise{Kind: benchpkg.NoiseCPU, CPUs: ctx.Float64("noise-cpus")})
+	}
+	if ctx.IsSet("noise-memory") {
+		noises = append(noises, benchpkg.Noise{Kind: benchpkg.NoiseMemory, MemoryBytes: noiseMemoryBytes})
+	}
+
+	var uid, gid uint32
+	if rootlessUser := ctx.String("rootless"); rootlessUser != "" {
+		uid, gid, err = benchpkg.ParseUser(rootlessUser)
+		if err != nil {
+			return benchpkg.Options{}, err
+		}
+	}
+
+	quotas, err := benchpkg.ParseQuotaSizes(ctx.StringSlice("quota-size"))
+	if err != nil {
+		return benchpkg.Options{}, err
+	}
+
+	options := benchpkg.Options{
+		GrootFSBinPath:          ctx.String("gbin"),
+		StorePath:               ctx.String("store"),
+		Driver:                  ctx.String("driver"),
+		LogLevel:                ctx.String("log-level"),
+		MetricsEnabled:          ctx.Bool("enable-groot-metrics"),
+		GrootFSArgs:             ctx.StringSlice("grootfs-arg"),
+		CommandArgs:             commandArgs,
+		Images:                  ctx.Int("images"),
+		Concurrency:             ctx.Int("concurrency"),
+		BaseImages:              baseImages,
+		BaseImageWeights:        baseImageWeights,
+		BaseImageDistribution:   ctx.String("base-image-distribution"),
+		BaseImageSeed:           ctx.Int64("base-image-seed"),
+		ZipfExponent:            ctx.Float64("zipf-exponent"),
+		UseQuota:                ctx.Bool("with-quota"),
+		Quotas:                  quotas,
+		QuotaSeed:               ctx.Int64("quota-seed"),
+		ExcludeImageFromQuota:   ctx.Bool("exclude-image-from-quota"),
+		CacheMode:               ctx.String("cache-mode"),
+		DropCaches:              ctx.Bool("drop-caches"),
+		Rootless:                ctx.String("rootless") != "",
+		UID:                     uid,
+		GID:                     gid,
+		UIDMappings:             ctx.StringSlice("uid-mapping"),
+		GIDMappings:             ctx.StringSlice("gid-mapping"),
+		Lifecycle:               ctx.Bool("lifecycle"),
+		WriteBytes:              writeBytes,
+		DwellTime:               ctx.Duration("lifecycle-dwell"),
+		VerifyRootFS:            ctx.Bool("verify-rootfs") || len(ctx.StringSlice("expect-file")) > 0,
+		ExpectedFiles:           ctx.StringSlice("expect-file"),
+		ParallelClean:           ctx.Bool("parallel-clean"),
+		CleanInterval:           ctx.Int("parallel-clean-interval"),
+		DeleteInterval:          ctx.Int("parallel-delete-interval"),
+		DeleteStrategy:          ctx.String("delete-strategy"),
+		DeleteSeed:              ctx.Int64("delete-seed"),
+		KeepLive:                ctx.Int("keep-live"),
+		ParallelCommands:        parallelCommands,
+		ParallelCommandInterval: ctx.Int("parallel-command-interval"),
+		SkipTeardown:            ctx.Bool("skip-teardown"),
+		TeardownClean:           ctx.Bool("teardown-clean"),
+		InitStore:               ctx.Bool("init-store"),
+		StoreSizeBytes:          ctx.Int64("store-size-bytes"),
+		DeleteStore:             ctx.Bool("delete-store"),
+		Registry:                ctx.String("registry"),
+		RegistryAddress:         ctx.String("registry-address"),
+		RegistryConfig:          registryConfig,
+		Cgroup:                  ctx.Bool("cgroup"),
+		CgroupRoot:              ctx.String("cgroup-root"),
+		CgroupLimits:            cgroupLimits,
+		Noise:                   noises,
+		AbortErrorRate:          ctx.Float64("abort-error-rate"),
+		AbortMinImages:          ctx.Int("abort-min-images"),
+	}
+	if ctx.Bool("log-commands") {
+		options.Observers = append(options.Observers, &benchpkg.LogObserver{Out: os.Stderr})
+	}
+	for flag, seed := range map[string]*int64{
+		"base-image-seed": &options.BaseImageSeed,
+		"quota-seed":      &options.QuotaSeed,
+		"delete-seed":     &options.DeleteSeed,
+	} {
+		if !ctx.IsSet(flag) {
+			*seed = time.Now().UnixNano()
+		}
+	}
+
+	return options, nil
+}
+
+// interruptContext is cancelled on the first SIGINT or SIGTERM, so the run
+// can tear down its images. A second signal kills grootfs-bench as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	benchpkg "code.cloudfoundry.org/grootfs-bench/bench"
+	"github.com/urfave/cli"
+)
+
+var matrixCommand = cli.Command{
+	Name:      "matrix",
+	Usage:     "benchmark image creation for every combination of layer counts and image sizes",
+	UsageText: "grootfs-bench --gbin <grootfs-bin> --store <store-path> --images <n> --concurrency <c> matrix --fixtures <image-dir> [--layers <counts>] [--image-size <sizes>] [--format <text|json|csv>]",
+
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "fixtures",
+			Usage: "directory of the OCI image layout the base images are generated in, or taken from when they are already there",
+		},
+		cli.StringFlag{
+			Name:  "layers",
+			Usage: "layer counts of the base images, as a list (1,4,16) or a range doubling (1..16), stepping (1..16+5) or multiplying (1..64*4)",
+			Value: "1,4,16",
+		},
+		cli.StringFlag{
+			Name:  "image-size",
+			Usage: "total sizes of the base images, as a list (16M,256M) or a range like --layers (16M..1G*4)",
+			Value: "16M,64M,256M",
+		},
+		cli.IntFlag{
+			Name:  "files-per-layer",
+			Usage: "number of files in each layer of the generated images",
+			Value: 100,
+		},
+		cli.StringFlag{
+			Name:  "file-size-distribution",
+			Usage: "how the size of a layer is split between its files: " + strings.Join(benchpkg.FileSizeDistributions, ", "),
+			Value: benchpkg.FileSizesEven,
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed of the generated images",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "output format of the matrix: " + strings.Join(benchpkg.MatrixFormats, ", "),
+			Value: benchpkg.MatrixText,
+		},
+	},
+
+	Action: func(ctx *cli.Context) error {
+		fixturesPath := ctx.String("fixtures")
+		if fixturesPath == "" {
+			return cli.NewExitError("--fixtures is required", 1)
+		}
+
+		format := ctx.String("format")
+		if err := benchpkg.ValidateMatrixFormat(format); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		layerCounts, err := benchpkg.ParseRange(ctx.String("layers"), benchpkg.ParseCount)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		sizes, err := benchpkg.ParseRange(ctx.String("image-size"), benchpkg.ParseSize)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		shapes, err := benchpkg.MatrixShapes(layerCounts, sizes)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		options, err := benchmarkOptions(ctx.Parent())
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		matrix := &benchpkg.Matrix{
+			FixturesPath:         fixturesPath,
+			FilesPerLayer:        ctx.Int("files-per-layer"),
+			FileSizeDistribution: ctx.String("file-size-distribution"),
+			Seed:                 ctx.Int64("seed"),
+			NewBenchmark: func(baseImage string) (*benchpkg.Benchmark, error) {
+				// every shape is a run with the global options, from its
+				// own base image
+				cellOptions := options
+				cellOptions.BaseImages = []string{baseImage}
+				cellOptions.BaseImageWeights = nil
+				cellOptions.BaseImageDistribution = ""
+				return benchpkg.NewBenchmark(cellOptions)
+			},
+		}
+
+		runCtx, cancel := interruptContext()
+		defer cancel()
+		cells, runErr := matrix.Run(runCtx, shapes)
+		// the shapes benchmarked before a failure are printed all the same
+		if len(cells) > 0 || runErr == nil {
+			if err := benchpkg.PrintMatrix(os.Stdout, format, cells); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+		}
+		if runErr != nil {
+			return cli.NewExitError(runErr.Error(), 1)
+		}
+
+		for _, cell := range cells {
+			if cell.Error != "" {
+				return cli.NewExitError("a shape did not complete: "+cell.Error, 1)
+			}
+		}
+
+		return nil
+	},
+}
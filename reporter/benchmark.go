@@ -49,6 +49,15 @@ func createMetricSeries(prefix string, result map[string]interface{}) []map[stri
 	for key, value := range result {
 		now := float64(time.Now().Unix())
 
+		if key == "schema_version" {
+			continue
+		}
+		if key == "total_duration" {
+			// it used to be in nanoseconds, a new name keeps the old series
+			// and the monitors on it consistent
+			key = "total_duration_seconds"
+		}
+
 		//convert value into float
 		metric, ok := value.(float64)
 		if !ok {